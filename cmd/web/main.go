@@ -1,35 +1,63 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/variety-jones/cfrss/pkg/web"
 	"go.uber.org/zap"
 
 	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/leader"
 	"github.com/variety-jones/cfrss/pkg/scheduler"
 	"github.com/variety-jones/cfrss/pkg/store/mongodb"
+	"github.com/variety-jones/cfrss/pkg/utils"
 )
 
 const (
-	kDefaultEnvironment     = "dev"
-	kDefaultCoolDownMinutes = 5
-	kDefaultBatchSize       = 100
-	kDefaultDatabaseName    = "cfrss-local"
-	kDefaultMongoAddr       = "mongodb://localhost:27017"
-	kDefaultServerAddr      = ":5000"
-
-	kDefaultCodeforcesTimeoutMinutes = 2
+	kDefaultEnvironment            = "dev"
+	kDefaultCoolDownMinutes        = 5
+	kDefaultMinCoolDownSeconds     = 30
+	kDefaultMaxCoolDownMinutes     = 30
+	kDefaultContestCoolDownMinutes = 60
+	kDefaultBatchSize              = 100
+	kDefaultDatabaseName           = "cfrss-local"
+	kDefaultMongoAddr              = "mongodb://localhost:27017"
+	kDefaultServerAddr             = ":5000"
+	kDefaultSessionTTLHours        = 7 * 24
+
+	kDefaultCodeforcesTimeoutSeconds = 120
+	kDefaultMongoTimeoutSeconds      = 30
+	kDefaultSyncTimeoutMinutes       = 5
+	kDefaultShutdownTimeoutSeconds   = 10
+	kDefaultLeaderLeaseSeconds       = 30
+	kDefaultCodeforcesMaxAttempts    = 3
+	kDefaultInitialBackoffSeconds    = 2
+	kDefaultMaxBackoffSeconds        = 60
 )
 
 func main() {
 	// Define the customizable flags.
-	var serverAddr, mongoAddr, databaseName, environment string
-	var coolDownInMinutes, batchSize int
-	var enableCodeforcesScheduler bool
+	var serverAddr, mongoAddr, databaseName, environment, cfBaseURL string
+	var cfAPIKey, cfAPISecretFile string
+	var coolDownInMinutes, contestCoolDownInMinutes, batchSize int
+	var sessionTTLInHours, cfBurst, cfMaxAttempts int
+	var initialBackoffInSeconds, maxBackoffInSeconds int
+	var cfTimeoutInSeconds, mongoTimeoutInSeconds, syncTimeoutInMinutes int
+	var shutdownTimeoutInSeconds, leaderLeaseInSeconds int
+	var replicaID, adminUsernames string
+	var cfRate float64
+	var minCoolDownInSeconds, maxCoolDownInMinutes int
+	var enableCodeforcesScheduler, adaptiveCoolDown bool
 	flag.StringVar(&serverAddr, "serverAddr", kDefaultServerAddr,
 		"The address on which to run the web server")
 	flag.StringVar(&environment, "environment", kDefaultEnvironment,
@@ -40,8 +68,65 @@ func main() {
 		"The name of the MongoDB database")
 	flag.IntVar(&coolDownInMinutes, "cooldown-minutes", kDefaultCoolDownMinutes,
 		"The cooldown (in minutes) for contacting Codeforces API")
+	flag.BoolVar(&adaptiveCoolDown, "adaptive-cooldown", false,
+		"If set to true, the cooldown adapts to the activity on Codeforces, "+
+			"starting from --cooldown-minutes")
+	flag.IntVar(&minCoolDownInSeconds, "min-cooldown-seconds",
+		kDefaultMinCoolDownSeconds,
+		"The shortest cooldown (in seconds) in the adaptive mode")
+	flag.IntVar(&maxCoolDownInMinutes, "max-cooldown-minutes",
+		kDefaultMaxCoolDownMinutes,
+		"The longest cooldown (in minutes) in the adaptive mode")
+	flag.IntVar(&contestCoolDownInMinutes, "contest-cooldown-minutes",
+		kDefaultContestCoolDownMinutes,
+		"The cooldown (in minutes) for refreshing the list of contests")
 	flag.IntVar(&batchSize, "cf-batch-size", kDefaultBatchSize,
 		"The number of recent actions to query on each API call")
+	flag.StringVar(&cfBaseURL, "cf-base-url", cfapi.DefaultBaseURL,
+		"The root of the Codeforces API, e.g. to use a mirror")
+	flag.StringVar(&cfAPIKey, "cf-api-key", "",
+		"The Codeforces API key. If set, every Codeforces API call is signed")
+	flag.StringVar(&cfAPISecretFile, "cf-api-secret-file", "",
+		"The file holding the Codeforces API secret, unless it is set in "+
+			"the "+cfapi.APISecretEnv+" environment variable")
+	flag.Float64Var(&cfRate, "cf-rate", cfapi.DefaultRate,
+		"The average number of Codeforces API calls per second")
+	flag.IntVar(&cfBurst, "cf-burst", cfapi.DefaultBurst,
+		"The number of Codeforces API calls that can be made in a burst")
+	flag.IntVar(&cfMaxAttempts, "cf-max-attempts",
+		kDefaultCodeforcesMaxAttempts,
+		"The number of attempts of a Codeforces API call, including retries")
+	flag.IntVar(&initialBackoffInSeconds, "cf-initial-backoff-seconds",
+		kDefaultInitialBackoffSeconds,
+		"The delay (in seconds) before retrying a failed Codeforces API call")
+	flag.IntVar(&maxBackoffInSeconds, "cf-max-backoff-seconds",
+		kDefaultMaxBackoffSeconds,
+		"The maximum delay (in seconds) between two Codeforces API attempts")
+	flag.IntVar(&cfTimeoutInSeconds, "cf-timeout-seconds",
+		kDefaultCodeforcesTimeoutSeconds,
+		"The deadline (in seconds) of a single Codeforces API attempt")
+	flag.IntVar(&mongoTimeoutInSeconds, "mongo-timeout-seconds",
+		kDefaultMongoTimeoutSeconds,
+		"The deadline (in seconds) of a single MongoDB operation")
+	flag.IntVar(&syncTimeoutInMinutes, "sync-timeout-minutes",
+		kDefaultSyncTimeoutMinutes,
+		"The deadline (in minutes) of a single sync with Codeforces, "+
+			"including retries")
+	flag.IntVar(&shutdownTimeoutInSeconds, "shutdown-timeout-seconds",
+		kDefaultShutdownTimeoutSeconds,
+		"The duration (in seconds) to wait for the requests in progress "+
+			"on shutdown")
+	flag.StringVar(&replicaID, "replica-id", "",
+		"The unique name of this replica in the leader election. "+
+			"Defaults to the hostname followed by a random suffix")
+	flag.IntVar(&leaderLeaseInSeconds, "leader-lease-seconds",
+		kDefaultLeaderLeaseSeconds,
+		"The duration (in seconds) after which another replica takes over "+
+			"the schedulers of a replica that stopped renewing its lease")
+	flag.IntVar(&sessionTTLInHours, "session-ttl-hours", kDefaultSessionTTLHours,
+		"The duration (in hours) after which login sessions expire")
+	flag.StringVar(&adminUsernames, "admin-usernames", "",
+		"The comma separated usernames allowed to use the admin routes")
 	flag.BoolVar(&enableCodeforcesScheduler, "enable-cf-scheduler", false,
 		"If set to true, DB is updated periodically with data from CF")
 
@@ -64,34 +149,159 @@ func main() {
 	zap.ReplaceGlobals(logger)
 
 	// Create the codeforces client to make API calls.
+	retryPolicy := cfapi.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = cfMaxAttempts
+	retryPolicy.InitialBackoff = time.Duration(initialBackoffInSeconds) *
+		time.Second
+	retryPolicy.MaxBackoff = time.Duration(maxBackoffInSeconds) * time.Second
+	cfOptions := []cfapi.ClientOption{
+		cfapi.WithBaseURL(cfBaseURL),
+		cfapi.WithRateLimit(cfRate, cfBurst),
+		cfapi.WithRetryPolicy(retryPolicy),
+	}
+	if cfAPIKey != "" {
+		// For security reasons, never log the secret.
+		secret, err := cfapi.LoadAPISecret(cfAPISecretFile)
+		if err != nil {
+			zap.S().Fatal(err)
+		}
+		if secret == "" {
+			zap.S().Fatalf("An API key is set, but the API secret is "+
+				"missing from both %s and --cf-api-secret-file",
+				cfapi.APISecretEnv)
+		}
+		zap.S().Info("Codeforces API calls will be signed")
+		cfOptions = append(cfOptions, cfapi.WithAPIKey(cfAPIKey, secret))
+	}
 	cfClient := cfapi.NewCodeforcesClient(
-		time.Duration(kDefaultCodeforcesTimeoutMinutes) * time.Minute)
+		time.Duration(cfTimeoutInSeconds)*time.Second,
+		cfOptions...)
 
 	// Create the cfStore to persist data to MongoDB.
 	// Also, query the last recorded timestamp.
-	cfStore, err := mongodb.NewMongoStore(mongoAddr, databaseName)
+	cfStore, err := mongodb.NewMongoStore(context.Background(), mongoAddr,
+		databaseName, mongodb.WithOperationTimeout(
+			time.Duration(mongoTimeoutInSeconds)*time.Second))
 	if err != nil {
 		zap.S().Fatal(err)
 	}
 
+	// The context is done on the first SIGINT/SIGTERM. A second signal
+	// kills the process right away.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT,
+		syscall.SIGTERM)
+	defer stop()
+
+	// workers tracks the goroutines running until the context is done, so
+	// that a sync in progress can persist what it fetched before the store is
+	// disconnected.
+	var workers sync.WaitGroup
+	start := func(run func(ctx context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(ctx)
+		}()
+	}
+
+	// Only the replica elected as the leader runs the schedulers.
+	var elector *leader.Elector
+	var sch scheduler.ControllableSchedulerInterface
 	if enableCodeforcesScheduler {
+		if replicaID == "" {
+			hostname, _ := os.Hostname()
+			replicaID = hostname + "-" + utils.GetNewUUID()[:8]
+		}
+		zap.S().Infof("Campaigning for the schedulers as %s", replicaID)
+		elector = leader.NewElector(cfStore, leader.SchedulerLease,
+			replicaID, leader.WithTTL(
+				time.Duration(leaderLeaseInSeconds)*time.Second))
+
+		// Campaign once before the schedulers start, so that the leader
+		// syncs right away.
+		if _, err := elector.Campaign(ctx); err != nil {
+			zap.S().Errorf("Campaign failed with error [%v]", err)
+		}
+		start(elector.Run)
+
+		schedulerOptions := []scheduler.Option{
+			scheduler.WithSyncTimeout(
+				time.Duration(syncTimeoutInMinutes) * time.Minute),
+			scheduler.WithElector(elector),
+		}
+
 		// Create the scheduler to contact CF and persist the result to MongoDB.
-		sch := scheduler.NewScheduler(cfClient, cfStore, batchSize,
-			time.Duration(coolDownInMinutes)*time.Minute)
+		actionOptions := schedulerOptions
+		if adaptiveCoolDown {
+			actionOptions = append(actionOptions,
+				scheduler.WithAdaptiveCooldown(
+					time.Duration(minCoolDownInSeconds)*time.Second,
+					time.Duration(maxCoolDownInMinutes)*time.Minute, cfRate))
+		}
+		sch = scheduler.NewScheduler(cfClient, cfStore, batchSize,
+			time.Duration(coolDownInMinutes)*time.Minute, actionOptions...)
 
-		// Start the scheduler in a new goroutine.
-		go sch.Start()
+		// The contests change far less often than the recent actions, so
+		// they are refreshed by a separate scheduler.
+		contestSch := scheduler.NewContestScheduler(cfClient, cfStore,
+			time.Duration(contestCoolDownInMinutes)*time.Minute,
+			schedulerOptions...)
+
+		// Start the schedulers in new goroutines.
+		start(sch.Start)
+		start(contestSch.Start)
 	}
 
+	var admins []string
+	for _, username := range strings.Split(adminUsernames, ",") {
+		if username = strings.TrimSpace(username); username != "" {
+			admins = append(admins, username)
+		}
+	}
+	serverOptions := []web.ServerOption{
+		web.WithSessionTTL(time.Duration(sessionTTLInHours) * time.Hour),
+		web.WithAdmins(admins...),
+	}
+	if sch != nil {
+		serverOptions = append(serverOptions, web.WithScheduler(sch))
+	}
+	webServer := web.CreateWebServer(cfStore, serverOptions...)
 	go func() {
-		if err := web.CreateWebServer(cfStore).
-			ListenAndServe(serverAddr); err != nil {
+		err := webServer.ListenAndServe(serverAddr)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			zap.S().Fatal(err)
 		}
 	}()
 
-	// Wait forever.
-	var wg sync.WaitGroup
-	wg.Add(1)
-	wg.Wait()
+	// Wait for a signal.
+	<-ctx.Done()
+	stop()
+	zap.S().Info("Received a signal, shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(shutdownTimeoutInSeconds)*time.Second)
+	defer cancel()
+	if err := webServer.Shutdown(shutdownCtx); err != nil {
+		zap.S().Errorf("Could not drain the web server with error [%v]", err)
+	}
+
+	// The calls to Codeforces of a sync in progress are cancelled, and only
+	// its writes to the store are left to finish, each within a few seconds.
+	// The scheduler also waits for the syncs triggered by the admins.
+	workers.Wait()
+
+	// The store is only disconnected once nothing uses it anymore.
+	closeCtx, cancelClose := context.WithTimeout(context.Background(),
+		time.Duration(shutdownTimeoutInSeconds)*time.Second)
+	defer cancelClose()
+	if elector != nil {
+		// Let another replica take over right away.
+		if err := elector.Release(closeCtx); err != nil {
+			zap.S().Errorf("Could not release the lease with error [%v]", err)
+		}
+	}
+	if err := cfStore.Close(closeCtx); err != nil {
+		zap.S().Errorf("Could not close the store with error [%v]", err)
+	}
+	zap.S().Info("Shut down gracefully")
 }
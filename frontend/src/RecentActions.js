@@ -9,21 +9,31 @@ const RecentActions = () => {
   useEffect(() => {
     fetchProducts();
   }, []);
+  // The session token is the one returned by /api/v1/public/user/login. Without
+  // it, the page falls back to the recent actions across all blogs.
   const fetchProducts = () => {
-    let v1Public = '/api/v1/public'
-    let endpoint = '/user/activity/recent-actions'
-    let uuid = 'f84d38d4-a949-40fd-a3b2-12f3cdf563e2'
-    let timestamp = '0'
-    let query = '?uuid=' + uuid + '&startTimestamp=' + timestamp
-    let url = v1Public + endpoint +  query
+    let token = localStorage.getItem('sessionToken')
+    let url = '/api/v1/public/activity/recent-actions'
+    let config = {}
+    if (token) {
+      url = '/api/v1/protected/user/activity/recent-actions'
+      config.headers = { Authorization: 'Bearer ' + token }
+    }
     axios
-      .get(url)
+      .get(url, config)
       .then((res) => {
-        console.log(res);
-        setProducts(res.data);
+        // The list is a plain array, of which only the comments are shown.
+        let actions = Array.isArray(res.data) ? res.data : []
+        setProducts(actions.filter((activity) =>
+          activity.blogEntry && activity.comment))
       })
       .catch((err) => {
         console.log(err);
+        // The session expired or was revoked.
+        if (token && err.response && err.response.status === 401) {
+          localStorage.removeItem('sessionToken')
+          fetchProducts()
+        }
       });
   };
 
@@ -48,6 +58,21 @@ const RecentActions = () => {
       activity.blogEntry.id + '#comment-' + activity.comment.id
   }
 
+  // The commentator profile is only present once the server has cached it.
+  const commentatorAvatar = (activity) => {
+    if (activity.commentator && activity.commentator.avatar) {
+      return activity.commentator.avatar
+    }
+    return "https://cdn-userpic.codeforces.com/1856032/avatar/73ea75ced650eedc.jpg"
+  }
+
+  const commentatorColor = (activity) => {
+    if (activity.commentator) {
+      return activity.commentator.color
+    }
+    return "black"
+  }
+
   const htmlToText = (html) => {
     var temp = document.createElement('div');
     temp.innerHTML = html;
@@ -69,8 +94,8 @@ const RecentActions = () => {
                   <td style={{width: 8 + 'em'}}>
                     <div>
                       <a href={"https://codeforces.com/profile/" + activity.comment.commentatorHandle} style={{position: 'relative'}}>
-                        <img src="https://cdn-userpic.codeforces.com/1856032/avatar/73ea75ced650eedc.jpg" alt="" /> </a>
-                      <div><a href={"https://codeforces.com/profile/" + activity.comment.commentatorHandle}>{activity.comment.commentatorHandle}</a></div>
+                        <img src={commentatorAvatar(activity)} alt="" /> </a>
+                      <div><a href={"https://codeforces.com/profile/" + activity.comment.commentatorHandle} style={{color: commentatorColor(activity)}}>{activity.comment.commentatorHandle}</a></div>
                     </div>
                   </td>
 
@@ -2,10 +2,13 @@
 package cfapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -15,45 +18,315 @@ import (
 )
 
 const (
-	baseUrl               = "https://codeforces.com/api"
-	recentActionsEndpoint = "/recentActions"
+	// DefaultBaseURL is the root of the official Codeforces API.
+	DefaultBaseURL = "https://codeforces.com/api"
+
+	// DefaultRate and DefaultBurst shape the calls to the API: Codeforces
+	// allows roughly one call every two seconds.
+	DefaultRate  = 0.5
+	DefaultBurst = 1
+
+	recentActionsEndpoint     = "/recentActions"
+	blogEntryViewEndpoint     = "/blogEntry.view"
+	blogEntryCommentsEndpoint = "/blogEntry.comments"
+	userInfoEndpoint          = "/user.info"
+	userBlogEntriesEndpoint   = "/user.blogEntries"
+	userRatingEndpoint        = "/user.rating"
+	contestListEndpoint       = "/contest.list"
+
+	// kMaxHandlesPerCall is the number of handles queried in a single
+	// user.info call. The API accepts up to 10000 handles, but the request
+	// line must also stay within the URL length limits of common servers.
+	kMaxHandlesPerCall = 300
 
 	kStatusOK = "OK"
 )
 
 // CodeforcesAPI contains all the methods of the Codeforces API.
 type CodeforcesAPI interface {
-	RecentActions(maxCount int) ([]models.RecentAction, error)
+	RecentActions(ctx context.Context, maxCount int) (
+		[]models.RecentAction, error)
+
+	// BlogEntryView returns a blog, including its full content.
+	BlogEntryView(ctx context.Context, blogEntryId int) (
+		*models.BlogEntry, error)
+
+	// BlogEntryComments returns all the comments of a blog.
+	BlogEntryComments(ctx context.Context, blogEntryId int) (
+		[]models.Comment, error)
+
+	// UserInfo returns the profiles of the given users.
+	UserInfo(ctx context.Context, handles ...string) (
+		[]models.CodeforcesUser, error)
+
+	// UserBlogEntries returns all the blogs written by a user, without
+	// their content.
+	UserBlogEntries(ctx context.Context, handle string) (
+		[]models.BlogEntry, error)
+
+	// UserRating returns the rating history of a user.
+	UserRating(ctx context.Context, handle string) (
+		[]models.RatingChange, error)
+
+	// ContestList returns all the contests, or all the gym contests.
+	ContestList(ctx context.Context, gym bool) ([]models.Contest, error)
 }
 
 // CodeforcesClient implements the Codeforces interface.
 type codeforcesClient struct {
-	client http.Client
+	client  http.Client
+	baseURL string
+
+	// sem serializes all the API calls, so that they are made one at a
+	// time and in the order allowed by the limiter.
+	sem         chan struct{}
+	limiter     *RateLimiter
+	rate        float64
+	burst       int
+	clock       Clock
+	retryPolicy RetryPolicy
+
+	// signer authenticates the calls, if an API key is configured.
+	signer *signer
+}
+
+// ClientOption customizes the Codeforces client.
+type ClientOption func(*codeforcesClient)
+
+// WithRateLimit sets the average number of calls per second, and the number
+// of calls that can be made in a burst. A non-positive rate disables rate
+// limiting.
+func WithRateLimit(rate float64, burst int) ClientOption {
+	return func(cf *codeforcesClient) {
+		cf.rate = rate
+		cf.burst = burst
+	}
+}
+
+// WithRetryPolicy sets the policy by which failed calls are retried.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(cf *codeforcesClient) {
+		cf.retryPolicy = policy
+	}
+}
+
+// WithBaseURL points the client at another server, e.g. a mirror such as
+// https://codeforces.ml/api, or a fake server in tests.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(cf *codeforcesClient) {
+		cf.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithAPIKey makes the client sign every call with the API key and secret,
+// which grants access to the methods that need authentication.
+func WithAPIKey(key, secret string) ClientOption {
+	return func(cf *codeforcesClient) {
+		cf.signer = &signer{
+			key:    key,
+			secret: apiSecret(secret),
+		}
+	}
+}
+
+// WithClock replaces the clock used for rate limiting and retries.
+func WithClock(clock Clock) ClientOption {
+	return func(cf *codeforcesClient) {
+		cf.clock = clock
+	}
 }
 
 // RecentActions fetches a list of recent blogs/comments from Codeforces.
-func (cf *codeforcesClient) RecentActions(maxCount int) (
+func (cf *codeforcesClient) RecentActions(ctx context.Context, maxCount int) (
 	[]models.RecentAction, error) {
 	zap.S().Info("Executing RecentActions API...")
 
+	query := url.Values{}
+	query.Add("maxCount", fmt.Sprint(maxCount))
+
+	var actions []models.RecentAction
+	if err := cf.call(ctx, recentActionsEndpoint, query, &actions); err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
+
+// BlogEntryView fetches a blog along with its full content.
+func (cf *codeforcesClient) BlogEntryView(ctx context.Context,
+	blogEntryId int) (*models.BlogEntry, error) {
+	zap.S().Infof("Executing BlogEntryView API for blog %d...", blogEntryId)
+
+	query := url.Values{}
+	query.Add("blogEntryId", fmt.Sprint(blogEntryId))
+
+	blog := new(models.BlogEntry)
+	if err := cf.call(ctx, blogEntryViewEndpoint, query, blog); err != nil {
+		return nil, err
+	}
+	return blog, nil
+}
+
+// BlogEntryComments fetches the complete comment thread of a blog.
+func (cf *codeforcesClient) BlogEntryComments(ctx context.Context,
+	blogEntryId int) ([]models.Comment, error) {
+	zap.S().Infof("Executing BlogEntryComments API for blog %d...",
+		blogEntryId)
+
+	query := url.Values{}
+	query.Add("blogEntryId", fmt.Sprint(blogEntryId))
+
+	var comments []models.Comment
+	err := cf.call(ctx, blogEntryCommentsEndpoint, query, &comments)
+	if err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// UserInfo fetches the profiles of the users, in as many calls as needed.
+func (cf *codeforcesClient) UserInfo(ctx context.Context, handles ...string) (
+	[]models.CodeforcesUser, error) {
+	zap.S().Infof("Executing UserInfo API for %d handles...", len(handles))
+
+	var users []models.CodeforcesUser
+	for start := 0; start < len(handles); start += kMaxHandlesPerCall {
+		end := start + kMaxHandlesPerCall
+		if end > len(handles) {
+			end = len(handles)
+		}
+
+		query := url.Values{}
+		query.Add("handles", strings.Join(handles[start:end], ";"))
+
+		var batch []models.CodeforcesUser
+		if err := cf.call(ctx, userInfoEndpoint, query, &batch); err != nil {
+			return nil, err
+		}
+		users = append(users, batch...)
+	}
+	return users, nil
+}
+
+// UserBlogEntries fetches the list of blogs written by a user.
+func (cf *codeforcesClient) UserBlogEntries(ctx context.Context,
+	handle string) ([]models.BlogEntry, error) {
+	zap.S().Infof("Executing UserBlogEntries API for %s...", handle)
+
+	query := url.Values{}
+	query.Add("handle", handle)
+
+	var blogs []models.BlogEntry
+	if err := cf.call(ctx, userBlogEntriesEndpoint, query, &blogs); err != nil {
+		return nil, err
+	}
+	return blogs, nil
+}
+
+// UserRating fetches the rating history of a user.
+func (cf *codeforcesClient) UserRating(ctx context.Context, handle string) (
+	[]models.RatingChange, error) {
+	zap.S().Infof("Executing UserRating API for %s...", handle)
+
+	query := url.Values{}
+	query.Add("handle", handle)
+
+	var changes []models.RatingChange
+	if err := cf.call(ctx, userRatingEndpoint, query, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// ContestList fetches the list of contests or gym contests.
+func (cf *codeforcesClient) ContestList(ctx context.Context, gym bool) (
+	[]models.Contest, error) {
+	zap.S().Infof("Executing ContestList API with gym = %v...", gym)
+
+	query := url.Values{}
+	query.Add("gym", fmt.Sprint(gym))
+
+	var contests []models.Contest
+	if err := cf.call(ctx, contestListEndpoint, query, &contests); err != nil {
+		return nil, err
+	}
+	return contests, nil
+}
+
+// call makes an HTTP call to a Codeforces API method and unmarshals its
+// result into the given pointer. Calls which fail with a retryable error are
+// retried according to the retry policy.
+func (cf *codeforcesClient) call(ctx context.Context, endpoint string,
+	query url.Values, result interface{}) error {
+	attempts := cf.retryPolicy.attempts()
+	for attempt := 0; ; attempt++ {
+		err := cf.attempt(ctx, endpoint, query, result)
+		if err == nil || !IsRetryable(err) || attempt+1 >= attempts {
+			return err
+		}
+
+		// The other calls can go ahead during the backoff.
+		delay := cf.retryPolicy.backoff(attempt, randomFloat)
+		zap.S().Warnf("Attempt %d of %d for %s failed with error [%v], "+
+			"retrying in %v", attempt+1, attempts, endpoint, err, delay)
+		select {
+		case <-cf.clock.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// attempt waits for the calls in progress and for the rate limiter, unless the
+// context is done first, and then makes a single call.
+func (cf *codeforcesClient) attempt(ctx context.Context, endpoint string,
+	query url.Values, result interface{}) error {
+	select {
+	case cf.sem <- struct{}{}:
+		defer func() { <-cf.sem }()
+	case <-ctx.Done():
+		return errors.Errorf("gave up waiting to call %s with error [%v]",
+			endpoint, ctx.Err())
+	}
+
+	if cf.limiter != nil {
+		if err := cf.limiter.Wait(ctx); err != nil {
+			return errors.Errorf("rate limiter wait for %s failed "+
+				"with error [%v]", endpoint, err)
+		}
+	}
+	return cf.callOnce(ctx, endpoint, query, result)
+}
+
+// callOnce makes a single HTTP call to a Codeforces API method, checks the
+// status of the response envelope, and unmarshals its result into the given
+// pointer. The errors are classified into the types defined in this package.
+func (cf *codeforcesClient) callOnce(ctx context.Context, endpoint string,
+	query url.Values, result interface{}) error {
+	// Every attempt is signed afresh, since the signature includes the time.
+	if cf.signer != nil {
+		signed, err := cf.signer.sign(strings.TrimPrefix(endpoint, "/"), query)
+		if err != nil {
+			return errors.Errorf("could not sign %s call with error [%v]",
+				endpoint, err)
+		}
+		query = signed
+	}
+
 	// Create the HTTP request and add query parameters.
-	url := baseUrl + recentActionsEndpoint
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	reqURL := cf.baseURL + endpoint
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
-		zap.S().Debugf("URL: %s", url)
-		return nil, errors.Errorf("could not create request for "+
-			"/recentActions api with error [%v]", err)
+		zap.S().Debugf("URL: %s", reqURL)
+		return errors.Errorf("could not create request for "+
+			"%s api with error [%v]", endpoint, err)
 	}
-	query := req.URL.Query()
-	query.Add("maxCount", fmt.Sprint(maxCount))
 	req.URL.RawQuery = query.Encode()
 
 	// Make the HTTP call.
 	resp, err := cf.client.Do(req)
 	if err != nil {
 		zap.S().Debugf("request: %+v", req)
-		return nil, errors.Errorf("http call to /recentActions failed "+
-			"with error [%v]", err)
+		return &NetworkError{Endpoint: endpoint, Err: err}
 	}
 	defer resp.Body.Close()
 
@@ -61,38 +334,72 @@ func (cf *codeforcesClient) RecentActions(maxCount int) (
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		zap.S().Debugf("response: %+v", resp)
-		return nil, errors.Errorf("could not read response of /recentActions "+
-			"with error [%v]", err)
+		return &NetworkError{Endpoint: endpoint, Err: err}
 	}
 
-	// Unmarshal the response.
+	// Classify the failures which are evident from the HTTP status.
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return &RateLimitError{Endpoint: endpoint,
+			Comment: http.StatusText(resp.StatusCode)}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		zap.S().Debugf("response body: %s", string(body))
+		return &ServerError{Endpoint: endpoint, StatusCode: resp.StatusCode}
+	}
+
+	// Unmarshal the response envelope. Codeforces answers FAILED calls with
+	// a 4xx status and the same envelope.
 	wrapper := struct {
 		Status  string
 		Comment string
-		Result  []models.RecentAction
+		Result  json.RawMessage
 	}{}
 	if err := json.Unmarshal(body, &wrapper); err != nil {
 		zap.S().Debugf("body: %s", string(body))
-		return nil, errors.Errorf("could not unmarshal /recentActions response "+
-			"with error [%v]", err)
+		return &MalformedResponseError{Endpoint: endpoint,
+			StatusCode: resp.StatusCode, Err: err}
 	}
 
-	// Check for internal server errors from Codeforces.
+	// Check for errors reported by Codeforces.
 	if wrapper.Status != kStatusOK {
 		zap.S().Debugf("response body: %s", string(body))
-		return nil, errors.Errorf("codeforces returned an internal error "+
-			"with comment [%s]", wrapper.Comment)
+		return failedStatusError(endpoint, wrapper.Comment)
+	}
+
+	// Unmarshal the actual result.
+	if err := json.Unmarshal(wrapper.Result, result); err != nil {
+		zap.S().Debugf("result: %s", string(wrapper.Result))
+		return &MalformedResponseError{Endpoint: endpoint,
+			StatusCode: resp.StatusCode, Err: err}
 	}
-	return wrapper.Result, nil
+	return nil
 }
 
 // NewCodeforcesClient returns a concrete implementation of the
 // CodeforcesAPI
-func NewCodeforcesClient(timeOut time.Duration) CodeforcesAPI {
+func NewCodeforcesClient(timeOut time.Duration,
+	opts ...ClientOption) CodeforcesAPI {
 	cf := new(codeforcesClient)
 	cf.client = http.Client{
 		Timeout: timeOut,
 	}
+	cf.sem = make(chan struct{}, 1)
+	cf.baseURL = DefaultBaseURL
+	cf.rate = DefaultRate
+	cf.burst = DefaultBurst
+	cf.clock = realClock{}
+	cf.retryPolicy = DefaultRetryPolicy()
+	for _, opt := range opts {
+		opt(cf)
+	}
+
+	if cf.rate > 0 {
+		cf.limiter = NewRateLimiter(cf.rate, cf.burst, cf.clock)
+	}
+	if cf.signer != nil {
+		cf.signer.now = cf.clock.Now
+		cf.signer.prefix = randomPrefix
+	}
 
 	return cf
 }
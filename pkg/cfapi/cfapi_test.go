@@ -0,0 +1,327 @@
+package cfapi_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/cfapi/cftest"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("CodeforcesClient", func() {
+	ctx := context.Background()
+
+	var server *cftest.Server
+	var client cfapi.CodeforcesAPI
+
+	BeforeEach(func() {
+		server = cftest.NewServer()
+		DeferCleanup(server.Close)
+
+		client = cfapi.NewCodeforcesClient(100*time.Millisecond,
+			cfapi.WithBaseURL(server.BaseURL()),
+			cfapi.WithRateLimit(0, 0),
+			cfapi.WithRetryPolicy(cfapi.RetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     10 * time.Millisecond,
+				Multiplier:     2,
+			}))
+	})
+
+	Describe("methods", func() {
+		It("should fetch the recent actions", func() {
+			server.SetRecentActions(
+				models.RecentAction{TimeSeconds: 2},
+				models.RecentAction{TimeSeconds: 1})
+
+			actions, err := client.RecentActions(ctx, 1)
+			Expect(err).Should(BeNil())
+			Expect(actions).Should(Equal([]models.RecentAction{
+				{TimeSeconds: 2},
+			}))
+			Expect(server.Requests("recentActions")).Should(Equal(
+				[]string{"maxCount=1"}))
+		})
+
+		It("should fetch a blog with its content", func() {
+			expected := models.BlogEntry{
+				Id:                      1,
+				Title:                   "fake-title",
+				Content:                 "<p>fake-content</p>",
+				AuthorHandle:            "fake-author",
+				Tags:                    []string{"fake-tag"},
+				CreationTimeSeconds:     100,
+				ModificationTimeSeconds: 200,
+			}
+			server.AddBlog(expected)
+
+			blog, err := client.BlogEntryView(ctx, 1)
+			Expect(err).Should(BeNil())
+			Expect(*blog).Should(Equal(expected))
+			Expect(server.Requests("blogEntry.view")).Should(Equal(
+				[]string{"blogEntryId=1"}))
+		})
+
+		It("should fetch the comment thread of a blog", func() {
+			server.AddBlog(models.BlogEntry{Id: 1})
+			expected := []models.Comment{
+				{Id: 2, CreationTimeSeconds: 100, CommentatorHandle: "fake-user",
+					Text: "fake-comment", Rating: 3},
+				{Id: 3, CreationTimeSeconds: 200, CommentatorHandle: "fake-user",
+					Text: "fake-reply", ParentCommentId: 2},
+			}
+			server.AddComments(1, expected...)
+
+			comments, err := client.BlogEntryComments(ctx, 1)
+			Expect(err).Should(BeNil())
+			Expect(comments).Should(Equal(expected))
+			Expect(server.Requests("blogEntry.comments")).Should(Equal(
+				[]string{"blogEntryId=1"}))
+
+			_, err = client.BlogEntryComments(ctx, 4)
+			var failedErr *cfapi.FailedStatusError
+			Expect(errors.As(err, &failedErr)).Should(BeTrue())
+			Expect(failedErr.Comment).Should(Equal(
+				"blogEntryId: Blog entry with id 4 not found"))
+		})
+
+		It("should fetch the profiles in batches", func() {
+			var handles []string
+			for ind := 0; ind < 301; ind++ {
+				handle := fmt.Sprintf("user-%d", ind)
+				handles = append(handles, handle)
+				server.AddUsers(models.CodeforcesUser{Handle: handle})
+			}
+
+			users, err := client.UserInfo(ctx, handles...)
+			Expect(err).Should(BeNil())
+			Expect(users).Should(HaveLen(301))
+
+			requests := server.Requests("user.info")
+			Expect(requests).Should(HaveLen(2))
+			query, err := url.ParseQuery(requests[1])
+			Expect(err).Should(BeNil())
+			Expect(query.Get("handles")).Should(Equal("user-300"))
+		})
+
+		It("should report the handle that does not exist", func() {
+			server.AddUsers(models.CodeforcesUser{Handle: "tourist"})
+
+			_, err := client.UserInfo(ctx, "tourist", "renamed-user")
+			handle, ok := cfapi.MissingHandle(err)
+			Expect(ok).Should(BeTrue())
+			Expect(handle).Should(Equal("renamed-user"))
+
+			_, ok = cfapi.MissingHandle(errors.New("fake-error"))
+			Expect(ok).Should(BeFalse())
+		})
+
+		It("should fetch the blogs and the rating of a user", func() {
+			server.AddUsers(models.CodeforcesUser{Handle: "tourist"})
+			server.SetUserBlogEntries("tourist", models.BlogEntry{Id: 1})
+			server.SetUserRating("tourist", models.RatingChange{NewRating: 3000})
+
+			blogs, err := client.UserBlogEntries(ctx, "tourist")
+			Expect(err).Should(BeNil())
+			Expect(blogs).Should(HaveLen(1))
+
+			changes, err := client.UserRating(ctx, "tourist")
+			Expect(err).Should(BeNil())
+			Expect(changes).Should(Equal([]models.RatingChange{
+				{NewRating: 3000},
+			}))
+		})
+
+		It("should fetch the contests", func() {
+			server.SetContests(models.Contest{Id: 1700, Phase: "BEFORE"})
+
+			contests, err := client.ContestList(ctx, false)
+			Expect(err).Should(BeNil())
+			Expect(contests).Should(HaveLen(1))
+			Expect(server.Requests("contest.list")).Should(Equal(
+				[]string{"gym=false"}))
+		})
+	})
+
+	Describe("errors", func() {
+		It("should retry server errors until the call succeeds", func() {
+			server.Script("recentActions",
+				cftest.Status(http.StatusServiceUnavailable),
+				cftest.Status(http.StatusBadGateway))
+			server.SetRecentActions(models.RecentAction{TimeSeconds: 1})
+
+			actions, err := client.RecentActions(ctx, 1)
+			Expect(err).Should(BeNil())
+			Expect(actions).Should(HaveLen(1))
+			Expect(server.Requests("recentActions")).Should(HaveLen(3))
+		})
+
+		It("should give up on server errors after the last attempt", func() {
+			for ind := 0; ind < 3; ind++ {
+				server.Script("recentActions",
+					cftest.Status(http.StatusInternalServerError))
+			}
+
+			_, err := client.RecentActions(ctx, 1)
+			var serverErr *cfapi.ServerError
+			Expect(errors.As(err, &serverErr)).Should(BeTrue())
+			Expect(serverErr.StatusCode).Should(Equal(
+				http.StatusInternalServerError))
+			Expect(server.Requests("recentActions")).Should(HaveLen(3))
+		})
+
+		It("should classify and retry rate limiting", func() {
+			server.Script("recentActions",
+				cftest.Status(http.StatusTooManyRequests),
+				cftest.CallLimitExceeded(),
+				cftest.CallLimitExceeded())
+
+			_, err := client.RecentActions(ctx, 1)
+			var rateLimitErr *cfapi.RateLimitError
+			Expect(errors.As(err, &rateLimitErr)).Should(BeTrue())
+			Expect(rateLimitErr.Comment).Should(Equal("Call limit exceeded"))
+			Expect(cfapi.IsRetryable(err)).Should(BeTrue())
+			Expect(server.Requests("recentActions")).Should(HaveLen(3))
+		})
+
+		It("should not retry a FAILED status", func() {
+			_, err := client.BlogEntryView(ctx, 1)
+			var failedErr *cfapi.FailedStatusError
+			Expect(errors.As(err, &failedErr)).Should(BeTrue())
+			Expect(failedErr.Comment).Should(Equal(
+				"blogEntryId: Blog entry with id 1 not found"))
+			Expect(cfapi.IsRetryable(err)).Should(BeFalse())
+			Expect(server.Requests("blogEntry.view")).Should(HaveLen(1))
+		})
+
+		It("should not retry a malformed response", func() {
+			server.Script("recentActions", cftest.Malformed())
+
+			_, err := client.RecentActions(ctx, 1)
+			var malformedErr *cfapi.MalformedResponseError
+			Expect(errors.As(err, &malformedErr)).Should(BeTrue())
+			Expect(cfapi.IsRetryable(err)).Should(BeFalse())
+			Expect(server.Requests("recentActions")).Should(HaveLen(1))
+		})
+
+		It("should retry calls which time out", func() {
+			server.Script("recentActions", cftest.Delayed(time.Second))
+			server.SetRecentActions(models.RecentAction{TimeSeconds: 1})
+
+			actions, err := client.RecentActions(ctx, 1)
+			Expect(err).Should(BeNil())
+			Expect(actions).Should(HaveLen(1))
+			Expect(server.Requests("recentActions")).Should(HaveLen(2))
+		})
+
+		It("should not call the API once the context is done", func() {
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+
+			_, err := client.RecentActions(cancelled, 1)
+			Expect(err).ShouldNot(BeNil())
+			Expect(server.Requests("recentActions")).Should(BeEmpty())
+		})
+
+		It("should stop retrying when the context deadline expires", func() {
+			client := cfapi.NewCodeforcesClient(time.Minute,
+				cfapi.WithBaseURL(server.BaseURL()),
+				cfapi.WithRateLimit(0, 0))
+			for ind := 0; ind < 3; ind++ {
+				server.Script("recentActions", cftest.Delayed(time.Second))
+			}
+
+			deadline, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			_, err := client.RecentActions(deadline, 1)
+			Expect(err).ShouldNot(BeNil())
+			Expect(time.Since(start)).Should(BeNumerically("<", time.Second))
+			Expect(server.Requests("recentActions")).Should(HaveLen(1))
+		})
+
+		It("should let the other calls through during a backoff", func() {
+			client := cfapi.NewCodeforcesClient(time.Minute,
+				cfapi.WithBaseURL(server.BaseURL()),
+				cfapi.WithRateLimit(0, 0),
+				cfapi.WithRetryPolicy(cfapi.RetryPolicy{
+					MaxAttempts:    2,
+					InitialBackoff: time.Minute,
+					MaxBackoff:     time.Minute,
+					Multiplier:     2,
+				}))
+			server.Script("recentActions",
+				cftest.Status(http.StatusServiceUnavailable))
+
+			retrying, cancel := context.WithCancel(ctx)
+			done := make(chan error)
+			go func() {
+				_, err := client.RecentActions(retrying, 1)
+				done <- err
+			}()
+			Eventually(func() []string {
+				return server.Requests("recentActions")
+			}).Should(HaveLen(1))
+
+			deadline, cancelDeadline := context.WithTimeout(ctx, time.Second)
+			defer cancelDeadline()
+			_, err := client.ContestList(deadline, false)
+			Expect(err).Should(BeNil())
+
+			cancel()
+			Eventually(done).Should(Receive(HaveOccurred()))
+		})
+
+		It("should classify connection failures as network errors", func() {
+			server.Close()
+
+			_, err := client.RecentActions(ctx, 1)
+			var networkErr *cfapi.NetworkError
+			Expect(errors.As(err, &networkErr)).Should(BeTrue())
+			Expect(cfapi.IsRetryable(err)).Should(BeTrue())
+		})
+	})
+
+	It("should accept a base URL with a trailing slash", func() {
+		client := cfapi.NewCodeforcesClient(time.Second,
+			cfapi.WithBaseURL(server.BaseURL()+"/"),
+			cfapi.WithRateLimit(0, 0))
+		Expect(client.ContestList(ctx, false)).Error().ShouldNot(HaveOccurred())
+		Expect(strings.Join(server.Requests("contest.list"), ",")).Should(
+			Equal("gym=false"))
+	})
+})
+
+var _ = Describe("RetryPolicy", func() {
+	policy := cfapi.RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+	never := func() float64 { return 0 }
+	always := func() float64 { return 1 }
+
+	It("should back off exponentially up to the cap", func() {
+		Expect(cfapi.Backoff(policy, 0, never)).Should(Equal(time.Second))
+		Expect(cfapi.Backoff(policy, 1, never)).Should(Equal(2 * time.Second))
+		Expect(cfapi.Backoff(policy, 2, never)).Should(Equal(4 * time.Second))
+		Expect(cfapi.Backoff(policy, 3, never)).Should(Equal(5 * time.Second))
+	})
+
+	It("should shave off at most the jitter fraction", func() {
+		Expect(cfapi.Backoff(policy, 1, always)).Should(Equal(time.Second))
+		Expect(cfapi.Backoff(policy, 3, always)).Should(
+			Equal(2500 * time.Millisecond))
+	})
+})
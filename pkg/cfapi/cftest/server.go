@@ -0,0 +1,416 @@
+// Package cftest provides a fake Codeforces API server, so that the client
+// and everything built on it can be tested end to end without the network.
+package cftest
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+const (
+	kApiPrefix = "/api"
+
+	kCallLimitExceeded = "Call limit exceeded"
+
+	kSignaturePrefixLength = 6
+)
+
+// Response is a scripted answer to a single API call.
+type Response struct {
+	// Delay is waited before anything is written.
+	Delay time.Duration
+
+	// StatusCode and Body, when set, are written verbatim. Otherwise the
+	// call is answered from the data of the server.
+	StatusCode int
+	Body       string
+}
+
+// Failed returns a response with the FAILED status and the given comment.
+func Failed(comment string) Response {
+	body, _ := json.Marshal(map[string]string{
+		"status":  "FAILED",
+		"comment": comment,
+	})
+	return Response{StatusCode: http.StatusBadRequest, Body: string(body)}
+}
+
+// CallLimitExceeded returns the response of Codeforces to too many calls.
+func CallLimitExceeded() Response {
+	return Failed(kCallLimitExceeded)
+}
+
+// Status returns a response with the given HTTP status and an HTML body, the
+// way a proxy in front of Codeforces would answer.
+func Status(code int) Response {
+	return Response{StatusCode: code,
+		Body: "<html>" + http.StatusText(code) + "</html>"}
+}
+
+// Malformed returns a successful response whose body is not valid JSON.
+func Malformed() Response {
+	return Response{StatusCode: http.StatusOK, Body: `{"status":"OK",`}
+}
+
+// Delayed returns a response served from the data of the server after the
+// given delay.
+func Delayed(delay time.Duration) Response {
+	return Response{Delay: delay}
+}
+
+// Server is a fake Codeforces API. The zero value is not usable, create it
+// with NewServer.
+type Server struct {
+	*httptest.Server
+
+	mutex         sync.Mutex
+	recentActions []models.RecentAction
+	blogs         map[int]models.BlogEntry
+	comments      map[int][]models.Comment
+	users         map[string]models.CodeforcesUser
+	userBlogs     map[string][]models.BlogEntry
+	ratings       map[string][]models.RatingChange
+	contests      []models.Contest
+	scripts       map[string][]Response
+	requests      map[string][]string
+
+	// apiKey and apiSecret, when set, are required to sign every call.
+	apiKey    string
+	apiSecret string
+}
+
+// BaseURL returns the URL to pass to the client in place of
+// https://codeforces.com/api.
+func (srv *Server) BaseURL() string {
+	return srv.URL + kApiPrefix
+}
+
+// SetRecentActions sets the actions served by /recentActions, latest first.
+func (srv *Server) SetRecentActions(actions ...models.RecentAction) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.recentActions = actions
+}
+
+// AddBlog adds a blog served by /blogEntry.view.
+func (srv *Server) AddBlog(blog models.BlogEntry) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.blogs[blog.Id] = blog
+}
+
+// AddComments adds comments to the thread of a blog, served by
+// /blogEntry.comments.
+func (srv *Server) AddComments(blogID int, comments ...models.Comment) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.comments[blogID] = append(srv.comments[blogID], comments...)
+}
+
+// AddUsers adds the profiles served by /user.info.
+func (srv *Server) AddUsers(users ...models.CodeforcesUser) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	for _, user := range users {
+		srv.users[user.Handle] = user
+	}
+}
+
+// SetUserBlogEntries sets the blogs of a user, served by /user.blogEntries.
+func (srv *Server) SetUserBlogEntries(handle string,
+	blogs ...models.BlogEntry) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.userBlogs[handle] = blogs
+}
+
+// SetUserRating sets the rating history of a user, served by /user.rating.
+func (srv *Server) SetUserRating(handle string,
+	changes ...models.RatingChange) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.ratings[handle] = changes
+}
+
+// SetContests sets the contests served by /contest.list.
+func (srv *Server) SetContests(contests ...models.Contest) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.contests = contests
+}
+
+// Script queues responses for a method, e.g. "recentActions". Each call of
+// the method consumes the next response, and the method is answered from the
+// data of the server once the queue is empty.
+func (srv *Server) Script(method string, responses ...Response) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.scripts[method] = append(srv.scripts[method], responses...)
+}
+
+// RequireAPIKey makes the server reject the calls which are not signed with
+// the given key and secret.
+func (srv *Server) RequireAPIKey(key, secret string) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.apiKey = key
+	srv.apiSecret = secret
+}
+
+// verifySignature checks the apiKey and apiSig parameters of a call, the way
+// Codeforces does.
+func (srv *Server) verifySignature(method string, query url.Values) error {
+	if query.Get("apiKey") != srv.apiKey {
+		return fmt.Errorf("apiKey: Incorrect API key")
+	}
+	apiSig := query.Get("apiSig")
+	if len(apiSig) < kSignaturePrefixLength {
+		return fmt.Errorf("apiSig: Incorrect signature")
+	}
+
+	type param struct{ name, value string }
+	var params []param
+	for name, values := range query {
+		if name == "apiSig" {
+			continue
+		}
+		for _, value := range values {
+			params = append(params, param{name, value})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i].name != params[j].name {
+			return params[i].name < params[j].name
+		}
+		return params[i].value < params[j].value
+	})
+
+	var joined []string
+	for _, p := range params {
+		joined = append(joined, p.name+"="+p.value)
+	}
+	prefix := apiSig[:kSignaturePrefixLength]
+	digest := sha512.Sum512([]byte(prefix + "/" + method + "?" +
+		strings.Join(joined, "&") + "#" + srv.apiSecret))
+	if apiSig[kSignaturePrefixLength:] != hex.EncodeToString(digest[:]) {
+		return fmt.Errorf("apiSig: Incorrect signature")
+	}
+	return nil
+}
+
+// Requests returns the raw query of every call made to a method, in order.
+func (srv *Server) Requests(method string) []string {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	return append([]string(nil), srv.requests[method]...)
+}
+
+// handlers maps every method to the function answering it from the data of
+// the server. They are called with the mutex held.
+func (srv *Server) handlers() map[string]func(r *http.Request) (
+	interface{}, error) {
+	return map[string]func(r *http.Request) (interface{}, error){
+		"recentActions":      srv.recentActionsHandler,
+		"blogEntry.view":     srv.blogEntryViewHandler,
+		"blogEntry.comments": srv.blogEntryCommentsHandler,
+		"user.info":          srv.userInfoHandler,
+		"user.blogEntries":   srv.userBlogEntriesHandler,
+		"user.rating":        srv.userRatingHandler,
+		"contest.list":       srv.contestListHandler,
+	}
+}
+
+func (srv *Server) recentActionsHandler(r *http.Request) (interface{}, error) {
+	maxCount, err := strconv.Atoi(r.URL.Query().Get("maxCount"))
+	if err != nil || maxCount < 1 || maxCount > 100 {
+		return nil, fmt.Errorf("maxCount: maxCount should be between 1 " +
+			"and 100")
+	}
+	if maxCount > len(srv.recentActions) {
+		maxCount = len(srv.recentActions)
+	}
+	return srv.recentActions[:maxCount], nil
+}
+
+func (srv *Server) blogEntryID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.URL.Query().Get("blogEntryId"))
+	if err != nil {
+		return 0, fmt.Errorf("blogEntryId: Field should contain " +
+			"an integer value")
+	}
+	return id, nil
+}
+
+func (srv *Server) blogEntryViewHandler(r *http.Request) (interface{}, error) {
+	id, err := srv.blogEntryID(r)
+	if err != nil {
+		return nil, err
+	}
+	blog, ok := srv.blogs[id]
+	if !ok {
+		return nil, fmt.Errorf("blogEntryId: Blog entry with id %d "+
+			"not found", id)
+	}
+	return blog, nil
+}
+
+func (srv *Server) blogEntryCommentsHandler(r *http.Request) (
+	interface{}, error) {
+	id, err := srv.blogEntryID(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := srv.blogs[id]; !ok && srv.comments[id] == nil {
+		return nil, fmt.Errorf("blogEntryId: Blog entry with id %d "+
+			"not found", id)
+	}
+
+	comments := append([]models.Comment{}, srv.comments[id]...)
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].Id < comments[j].Id
+	})
+	return comments, nil
+}
+
+func (srv *Server) user(handle string) (models.CodeforcesUser, error) {
+	user, ok := srv.users[handle]
+	if !ok {
+		return user, fmt.Errorf("handles: User with handle %s not found",
+			handle)
+	}
+	return user, nil
+}
+
+func (srv *Server) userInfoHandler(r *http.Request) (interface{}, error) {
+	var users []models.CodeforcesUser
+	for _, handle := range strings.Split(r.URL.Query().Get("handles"), ";") {
+		user, err := srv.user(handle)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (srv *Server) userBlogEntriesHandler(r *http.Request) (
+	interface{}, error) {
+	handle := r.URL.Query().Get("handle")
+	if _, err := srv.user(handle); err != nil {
+		return nil, err
+	}
+	return append([]models.BlogEntry{}, srv.userBlogs[handle]...), nil
+}
+
+func (srv *Server) userRatingHandler(r *http.Request) (interface{}, error) {
+	handle := r.URL.Query().Get("handle")
+	if _, err := srv.user(handle); err != nil {
+		return nil, err
+	}
+	return append([]models.RatingChange{}, srv.ratings[handle]...), nil
+}
+
+func (srv *Server) contestListHandler(r *http.Request) (interface{}, error) {
+	// Gym contests are not supported by the fake.
+	if r.URL.Query().Get("gym") == "true" {
+		return []models.Contest{}, nil
+	}
+	return append([]models.Contest{}, srv.contests...), nil
+}
+
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, kApiPrefix+"/")
+
+	srv.mutex.Lock()
+	srv.requests[method] = append(srv.requests[method], r.URL.RawQuery)
+	var response Response
+	if script := srv.scripts[method]; len(script) > 0 {
+		response = script[0]
+		srv.scripts[method] = script[1:]
+	}
+	srv.mutex.Unlock()
+
+	if response.Delay > 0 {
+		select {
+		case <-time.After(response.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if response.StatusCode != 0 {
+		w.WriteHeader(response.StatusCode)
+		w.Write([]byte(response.Body))
+		return
+	}
+
+	srv.mutex.Lock()
+	var result interface{}
+	var err error
+	if srv.apiKey != "" {
+		err = srv.verifySignature(method, r.URL.Query())
+	}
+	if err == nil {
+		handler, ok := srv.handlers()[method]
+		err = fmt.Errorf("method %s not found", method)
+		if ok {
+			result, err = handler(r)
+		}
+	}
+	srv.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	if err != nil {
+		body, _ := json.Marshal(map[string]string{
+			"status":  "FAILED",
+			"comment": err.Error(),
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(body)
+		return
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"status": "OK",
+		"result": result,
+	})
+	w.Write(body)
+}
+
+// NewServer starts a fake Codeforces API with no data. The caller should
+// Close it when done.
+func NewServer() *Server {
+	srv := &Server{
+		blogs:     make(map[int]models.BlogEntry),
+		comments:  make(map[int][]models.Comment),
+		users:     make(map[string]models.CodeforcesUser),
+		userBlogs: make(map[string][]models.BlogEntry),
+		ratings:   make(map[string][]models.RatingChange),
+		scripts:   make(map[string][]Response),
+		requests:  make(map[string][]string),
+	}
+	srv.Server = httptest.NewServer(srv)
+	return srv
+}
@@ -1,11 +1,20 @@
 package cfapi
 
 import (
+	"context"
 	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/variety-jones/cfrss/pkg/models"
 )
 
+const (
+	kDummyAvatar    = "https://userpic.codeforces.org/no-avatar.jpg"
+	kDummyContestId = 1
+)
+
 type dummyCodeforcesClient struct {
 	mutex                sync.Mutex
 	lastUnprocessedIndex int
@@ -14,8 +23,8 @@ type dummyCodeforcesClient struct {
 	goldenDataset []models.RecentAction
 }
 
-func (client *dummyCodeforcesClient) RecentActions(maxCount int) (
-	[]models.RecentAction, error) {
+func (client *dummyCodeforcesClient) RecentActions(ctx context.Context,
+	maxCount int) ([]models.RecentAction, error) {
 	client.mutex.Lock()
 	defer client.mutex.Unlock()
 
@@ -39,6 +48,115 @@ func (client *dummyCodeforcesClient) RecentActions(maxCount int) (
 	return res, nil
 }
 
+func (client *dummyCodeforcesClient) BlogEntryView(ctx context.Context,
+	blogEntryId int) (*models.BlogEntry, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	// Only the blogs that were already streamed are visible, in their latest
+	// version.
+	var res *models.BlogEntry
+	for ind := 0; ind < client.lastUnprocessedIndex; ind++ {
+		blog := client.goldenDataset[ind].BlogEntry
+		if blog != nil && blog.Id == blogEntryId && (res == nil ||
+			res.ModificationTimeSeconds < blog.ModificationTimeSeconds) {
+			res = blog
+		}
+	}
+	if res == nil {
+		return nil, errors.Errorf("blogEntryId: Blog entry with id %d "+
+			"not found", blogEntryId)
+	}
+
+	blog := *res
+	return &blog, nil
+}
+
+func (client *dummyCodeforcesClient) BlogEntryComments(ctx context.Context,
+	blogEntryId int) ([]models.Comment, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	// Only the comments that were already streamed are visible.
+	var res []models.Comment
+	for ind := 0; ind < client.lastUnprocessedIndex; ind++ {
+		action := client.goldenDataset[ind]
+		if action.BlogEntry != nil && action.BlogEntry.Id == blogEntryId &&
+			action.Comment != nil {
+			res = append(res, *action.Comment)
+		}
+	}
+
+	return res, nil
+}
+
+// UserInfo returns an unrated profile for every handle.
+func (client *dummyCodeforcesClient) UserInfo(ctx context.Context,
+	handles ...string) ([]models.CodeforcesUser, error) {
+	var res []models.CodeforcesUser
+	for _, handle := range handles {
+		res = append(res, models.CodeforcesUser{
+			Handle: handle,
+			Avatar: kDummyAvatar,
+		})
+	}
+	return res, nil
+}
+
+func (client *dummyCodeforcesClient) UserBlogEntries(ctx context.Context,
+	handle string) ([]models.BlogEntry, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	// Only the blogs that were already streamed are visible, in their latest
+	// version and without content.
+	var res []models.BlogEntry
+	seen := make(map[int]int)
+	for ind := 0; ind < client.lastUnprocessedIndex; ind++ {
+		blog := client.goldenDataset[ind].BlogEntry
+		if blog == nil || blog.AuthorHandle != handle {
+			continue
+		}
+
+		entry := *blog
+		entry.Content = ""
+		if pos, ok := seen[blog.Id]; !ok {
+			seen[blog.Id] = len(res)
+			res = append(res, entry)
+		} else if res[pos].ModificationTimeSeconds <
+			entry.ModificationTimeSeconds {
+			res[pos] = entry
+		}
+	}
+	return res, nil
+}
+
+// UserRating returns an empty rating history for every handle.
+func (client *dummyCodeforcesClient) UserRating(ctx context.Context,
+	handle string) ([]models.RatingChange, error) {
+	return nil, nil
+}
+
+// ContestList returns a single contest, starting at the next hour. There are
+// no gym contests.
+func (client *dummyCodeforcesClient) ContestList(ctx context.Context,
+	gym bool) ([]models.Contest, error) {
+	if gym {
+		return nil, nil
+	}
+
+	start := time.Now().Truncate(time.Hour).Add(time.Hour)
+	return []models.Contest{{
+		Id:                  kDummyContestId,
+		Name:                "Dummy Round",
+		Type:                "CF",
+		Phase:               "BEFORE",
+		DurationSeconds:     int64((2 * time.Hour).Seconds()),
+		StartTimeSeconds:    start.Unix(),
+		RelativeTimeSeconds: -int64(time.Until(start).Seconds()),
+	}}, nil
+}
+
 func NewDummyCodeforcesClient() CodeforcesAPI {
 	client := new(dummyCodeforcesClient)
 	return client
@@ -0,0 +1,118 @@
+package cfapi
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// kCallLimitExceeded is the comment of a FAILED response when the
+	// client makes calls too often.
+	kCallLimitExceeded = "Call limit exceeded"
+)
+
+// NetworkError means that the call did not get a response from Codeforces.
+type NetworkError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("http call to %s failed with error [%v]", e.Endpoint,
+		e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// ServerError means that Codeforces responded with an HTTP 5xx status.
+type ServerError struct {
+	Endpoint   string
+	StatusCode int
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("%s responded with status %d", e.Endpoint,
+		e.StatusCode)
+}
+
+// RateLimitError means that Codeforces rejected the call because too many
+// calls were made, either with HTTP 429 or with a "Call limit exceeded"
+// comment.
+type RateLimitError struct {
+	Endpoint string
+	Comment  string
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s was rate limited with comment [%s]", e.Endpoint,
+		e.Comment)
+}
+
+// MalformedResponseError means that the response could not be decoded.
+type MalformedResponseError struct {
+	Endpoint   string
+	StatusCode int
+	Err        error
+}
+
+func (e *MalformedResponseError) Error() string {
+	return fmt.Sprintf("could not decode %s response with status %d "+
+		"with error [%v]", e.Endpoint, e.StatusCode, e.Err)
+}
+
+func (e *MalformedResponseError) Unwrap() error {
+	return e.Err
+}
+
+// FailedStatusError means that Codeforces processed the call, and answered
+// with a FAILED status, e.g. for a handle that does not exist.
+type FailedStatusError struct {
+	Endpoint string
+	Comment  string
+}
+
+func (e *FailedStatusError) Error() string {
+	return fmt.Sprintf("codeforces returned an error for %s with "+
+		"comment [%s]", e.Endpoint, e.Comment)
+}
+
+// missingHandleRegexp matches the comment of a FAILED user.info response when
+// one of the handles does not exist.
+var missingHandleRegexp = regexp.MustCompile(
+	`^handles: User with handle (\S+) not found$`)
+
+// MissingHandle returns the handle that made a user.info call fail because no
+// user has it, e.g. after the user was renamed or deleted.
+func MissingHandle(err error) (string, bool) {
+	var failedErr *FailedStatusError
+	if !errors.As(err, &failedErr) {
+		return "", false
+	}
+	match := missingHandleRegexp.FindStringSubmatch(failedErr.Comment)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// failedStatusError classifies a FAILED response by its comment.
+func failedStatusError(endpoint, comment string) error {
+	if strings.Contains(comment, kCallLimitExceeded) {
+		return &RateLimitError{Endpoint: endpoint, Comment: comment}
+	}
+	return &FailedStatusError{Endpoint: endpoint, Comment: comment}
+}
+
+// IsRetryable reports whether the call that failed with err may succeed if
+// it is made again later.
+func IsRetryable(err error) bool {
+	var networkErr *NetworkError
+	var serverErr *ServerError
+	var rateLimitErr *RateLimitError
+	return errors.As(err, &networkErr) || errors.As(err, &serverErr) ||
+		errors.As(err, &rateLimitErr)
+}
@@ -0,0 +1,23 @@
+package cfapi
+
+import (
+	"net/url"
+	"time"
+)
+
+// Backoff exposes the delay computation of the retry policy.
+func Backoff(policy RetryPolicy, retry int, random func() float64) time.Duration {
+	return policy.backoff(retry, random)
+}
+
+// Sign signs the parameters of a call with a fixed time and random prefix.
+func Sign(key, secret, method string, query url.Values, now time.Time,
+	prefix string) (url.Values, error) {
+	s := &signer{
+		key:    key,
+		secret: apiSecret(secret),
+		now:    func() time.Time { return now },
+		prefix: func() (string, error) { return prefix, nil },
+	}
+	return s.sign(method, query)
+}
@@ -0,0 +1,136 @@
+package cfapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/variety-jones/cfrss/pkg/metrics"
+)
+
+const (
+	kRateLimiterWaitsMetric       = "cfapi.rateLimiter.waits"
+	kRateLimiterWaitSecondsMetric = "cfapi.rateLimiter.waitSeconds"
+	kRateLimiterLastWaitMetric    = "cfapi.rateLimiter.lastWaitSeconds"
+)
+
+// Clock abstracts the passage of time, so that rate limiting can be tested.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// RateLimiterStats summarizes the time spent waiting for the rate limiter.
+type RateLimiterStats struct {
+	// Waits is the number of calls that had to wait for a token.
+	Waits int64
+
+	// TotalWait is the cumulative time spent waiting.
+	TotalWait time.Duration
+
+	// MaxWait is the longest single wait.
+	MaxWait time.Duration
+}
+
+// RateLimiter is a token bucket. Tokens are added at a constant rate, up to
+// the burst size, and every call consumes one token.
+type RateLimiter struct {
+	mutex  sync.Mutex
+	clock  Clock
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	stats  RateLimiterStats
+}
+
+// refill adds the tokens accumulated since the last refill.
+func (rl *RateLimiter) refill(now time.Time) {
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > rl.burst {
+		rl.tokens = rl.burst
+	}
+	rl.last = now
+}
+
+// Wait blocks until a token is available or the context is done. Tokens are
+// reserved in order of arrival, so concurrent callers are served fairly.
+func (rl *RateLimiter) Wait(ctx context.Context) error {
+	rl.mutex.Lock()
+	rl.refill(rl.clock.Now())
+	rl.tokens--
+	var delay time.Duration
+	if rl.tokens < 0 {
+		delay = time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+	}
+	rl.mutex.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	select {
+	case <-rl.clock.After(delay):
+		rl.record(delay)
+		return nil
+	case <-ctx.Done():
+		// Give the reserved token back.
+		rl.mutex.Lock()
+		rl.tokens++
+		rl.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (rl *RateLimiter) record(delay time.Duration) {
+	rl.mutex.Lock()
+	rl.stats.Waits++
+	rl.stats.TotalWait += delay
+	if delay > rl.stats.MaxWait {
+		rl.stats.MaxWait = delay
+	}
+	rl.mutex.Unlock()
+
+	metrics.Add(kRateLimiterWaitsMetric, 1)
+	metrics.AddFloat(kRateLimiterWaitSecondsMetric, delay.Seconds())
+	metrics.SetFloat(kRateLimiterLastWaitMetric, delay.Seconds())
+}
+
+// Stats returns the wait time statistics of the limiter.
+func (rl *RateLimiter) Stats() RateLimiterStats {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	return rl.stats
+}
+
+// NewRateLimiter creates a limiter which allows rate calls per second on
+// average, and bursts of up to burst calls. The rate must be positive. The
+// bucket starts full.
+func NewRateLimiter(rate float64, burst int, clock Clock) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	rl := new(RateLimiter)
+	rl.clock = clock
+	rl.rate = rate
+	rl.burst = float64(burst)
+	rl.tokens = rl.burst
+	rl.last = clock.Now()
+
+	return rl
+}
@@ -0,0 +1,145 @@
+package cfapi_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi"
+)
+
+// fakeClock only moves forward when it is advanced.
+type fakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	return clock.now
+}
+
+func (clock *fakeClock) After(d time.Duration) <-chan time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	ch := make(chan time.Time, 1)
+	clock.waiters = append(clock.waiters, fakeWaiter{clock.now.Add(d), ch})
+	return ch
+}
+
+// Advance moves the clock forward, and fires the timers that expired.
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	clock.now = clock.now.Add(d)
+	var pending []fakeWaiter
+	for _, waiter := range clock.waiters {
+		if waiter.deadline.After(clock.now) {
+			pending = append(pending, waiter)
+			continue
+		}
+		waiter.ch <- clock.now
+	}
+	clock.waiters = pending
+}
+
+// Waiters returns the number of timers that did not fire yet.
+func (clock *fakeClock) Waiters() int {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	return len(clock.waiters)
+}
+
+var _ = Describe("RateLimiter", func() {
+	var clock *fakeClock
+	var limiter *cfapi.RateLimiter
+
+	BeforeEach(func() {
+		clock = &fakeClock{now: time.Unix(1660000000, 0)}
+		limiter = cfapi.NewRateLimiter(0.5, 2, clock)
+	})
+
+	// wait calls Wait in the background and returns the channel on which
+	// its result is delivered.
+	wait := func(ctx context.Context) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- limiter.Wait(ctx)
+		}()
+		return done
+	}
+
+	It("should allow bursts without waiting", func() {
+		Expect(limiter.Wait(context.Background())).Should(Succeed())
+		Expect(limiter.Wait(context.Background())).Should(Succeed())
+		Expect(clock.Waiters()).Should(Equal(0))
+		Expect(limiter.Stats().Waits).Should(BeZero())
+	})
+
+	It("should wait for a token once the bucket is empty", func() {
+		Expect(limiter.Wait(context.Background())).Should(Succeed())
+		Expect(limiter.Wait(context.Background())).Should(Succeed())
+
+		done := wait(context.Background())
+		Eventually(clock.Waiters).Should(Equal(1))
+
+		clock.Advance(time.Second)
+		Consistently(done).ShouldNot(Receive())
+
+		clock.Advance(time.Second)
+		Eventually(done).Should(Receive(BeNil()))
+
+		stats := limiter.Stats()
+		Expect(stats.Waits).Should(Equal(int64(1)))
+		Expect(stats.TotalWait).Should(Equal(2 * time.Second))
+		Expect(stats.MaxWait).Should(Equal(2 * time.Second))
+	})
+
+	It("should queue the waiting callers", func() {
+		Expect(limiter.Wait(context.Background())).Should(Succeed())
+		Expect(limiter.Wait(context.Background())).Should(Succeed())
+
+		first := wait(context.Background())
+		Eventually(clock.Waiters).Should(Equal(1))
+		second := wait(context.Background())
+		Eventually(clock.Waiters).Should(Equal(2))
+
+		clock.Advance(2 * time.Second)
+		Eventually(first).Should(Receive(BeNil()))
+		Consistently(second).ShouldNot(Receive())
+
+		clock.Advance(2 * time.Second)
+		Eventually(second).Should(Receive(BeNil()))
+		Expect(limiter.Stats().TotalWait).Should(Equal(6 * time.Second))
+	})
+
+	It("should stop waiting when the context is done", func() {
+		Expect(limiter.Wait(context.Background())).Should(Succeed())
+		Expect(limiter.Wait(context.Background())).Should(Succeed())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := wait(ctx)
+		Eventually(clock.Waiters).Should(Equal(1))
+		cancel()
+		Eventually(done).Should(Receive(MatchError(context.Canceled)))
+
+		// The token of the cancelled call is given back.
+		clock.Advance(2 * time.Second)
+		Expect(limiter.Wait(context.Background())).Should(Succeed())
+		Expect(limiter.Stats().Waits).Should(BeZero())
+	})
+})
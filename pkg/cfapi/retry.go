@@ -0,0 +1,69 @@
+package cfapi
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	kDefaultMaxAttempts    = 3
+	kDefaultInitialBackoff = 2 * time.Second
+	kDefaultMaxBackoff     = time.Minute
+	kDefaultMultiplier     = 2
+	kDefaultJitter         = 0.5
+)
+
+// RetryPolicy decides how the calls which failed with a retryable error are
+// made again.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts of a call, including the
+	// first one. Values below one are treated as one.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the second attempt.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between two attempts.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor by which the delay grows after every attempt.
+	Multiplier float64
+
+	// Jitter is the fraction of the delay, between 0 and 1, which is
+	// randomly shaved off, so that clients do not retry in lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy returns the policy used unless another one is set.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    kDefaultMaxAttempts,
+		InitialBackoff: kDefaultInitialBackoff,
+		MaxBackoff:     kDefaultMaxBackoff,
+		Multiplier:     kDefaultMultiplier,
+		Jitter:         kDefaultJitter,
+	}
+}
+
+// backoff returns the delay before the given retry, where zero is the first
+// retry. random must return a number in [0, 1).
+func (policy RetryPolicy) backoff(retry int, random func() float64) time.Duration {
+	delay := float64(policy.InitialBackoff) *
+		math.Pow(policy.Multiplier, float64(retry))
+	if max := float64(policy.MaxBackoff); policy.MaxBackoff > 0 && delay > max {
+		delay = max
+	}
+	delay -= delay * policy.Jitter * random()
+	return time.Duration(delay)
+}
+
+func (policy RetryPolicy) attempts() int {
+	if policy.MaxAttempts < 1 {
+		return 1
+	}
+	return policy.MaxAttempts
+}
+
+// randomFloat is the source of jitter.
+var randomFloat = rand.Float64
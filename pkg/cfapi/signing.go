@@ -0,0 +1,129 @@
+package cfapi
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// APISecretEnv is the environment variable holding the API secret.
+	APISecretEnv = "CFRSS_CF_API_SECRET"
+
+	kSignaturePrefixLength   = 6
+	kSignaturePrefixAlphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+)
+
+// apiSecret is a string which never shows up in logs, however it is
+// formatted.
+type apiSecret string
+
+func (apiSecret) String() string {
+	return "[redacted]"
+}
+
+func (apiSecret) GoString() string {
+	return "[redacted]"
+}
+
+// signer adds the apiKey, time and apiSig parameters to the calls, as
+// described in https://codeforces.com/apiHelp.
+type signer struct {
+	key    string
+	secret apiSecret
+	now    func() time.Time
+	prefix func() (string, error)
+}
+
+// randomPrefix returns the random string which starts every signature.
+func randomPrefix() (string, error) {
+	var prefix strings.Builder
+	limit := big.NewInt(int64(len(kSignaturePrefixAlphabet)))
+	for ind := 0; ind < kSignaturePrefixLength; ind++ {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", errors.Errorf("could not generate signature prefix "+
+				"with error [%v]", err)
+		}
+		prefix.WriteByte(kSignaturePrefixAlphabet[n.Int64()])
+	}
+	return prefix.String(), nil
+}
+
+// signature computes apiSig for a call to the method with the given
+// parameters, which must already include apiKey and time.
+func signature(prefix, method string, query url.Values,
+	secret apiSecret) string {
+	// The parameters are sorted by name, and then by value.
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, name+"="+value)
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		ni, vi := splitParam(params[i])
+		nj, vj := splitParam(params[j])
+		if ni != nj {
+			return ni < nj
+		}
+		return vi < vj
+	})
+
+	digest := sha512.Sum512([]byte(fmt.Sprintf("%s/%s?%s#%s", prefix, method,
+		strings.Join(params, "&"), string(secret))))
+	return prefix + hex.EncodeToString(digest[:])
+}
+
+func splitParam(param string) (string, string) {
+	name, value, _ := strings.Cut(param, "=")
+	return name, value
+}
+
+// sign returns a copy of the parameters of a call to the method, with the
+// authentication parameters added.
+func (s *signer) sign(method string, query url.Values) (url.Values, error) {
+	prefix, err := s.prefix()
+	if err != nil {
+		return nil, err
+	}
+
+	signed := url.Values{}
+	for name, values := range query {
+		signed[name] = append([]string(nil), values...)
+	}
+	signed.Set("apiKey", s.key)
+	signed.Set("time", fmt.Sprint(s.now().Unix()))
+	signed.Set("apiSig", signature(prefix, method, signed, s.secret))
+	return signed, nil
+}
+
+// LoadAPISecret returns the API secret from the CFRSS_CF_API_SECRET
+// environment variable, or else from the given file. Surrounding whitespace
+// is trimmed. It returns an empty secret if neither is set.
+func LoadAPISecret(path string) (string, error) {
+	if secret := strings.TrimSpace(os.Getenv(APISecretEnv)); secret != "" {
+		return secret, nil
+	}
+	if path == "" {
+		return "", nil
+	}
+
+	// Don't include the contents of the file in the error.
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Errorf("could not read api secret file %s "+
+			"with error [%v]", path, err)
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
@@ -0,0 +1,113 @@
+package cfapi_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/cfapi/cftest"
+)
+
+var _ = Describe("Signing", func() {
+	ctx := context.Background()
+
+	It("should match the example of the API documentation", func() {
+		query := url.Values{"contestId": {"566"}}
+		signed, err := cfapi.Sign("xxx", "yyy", "contest.hacks", query,
+			time.Unix(1430431560, 0), "123456")
+		Expect(err).Should(BeNil())
+
+		Expect(signed.Get("apiKey")).Should(Equal("xxx"))
+		Expect(signed.Get("time")).Should(Equal("1430431560"))
+		Expect(signed.Get("apiSig")).Should(Equal("123456" +
+			"d173d8d0f5689e1543fb68d0fab02cd38de7c7d42199c52f451053cdf77860da" +
+			"d10ab937d92b3d018b83c84b49996a37391ec3fb6943163814df5cd392570b34"))
+
+		// The parameters of the caller are left untouched.
+		Expect(query).Should(Equal(url.Values{"contestId": {"566"}}))
+	})
+
+	It("should sort repeated parameters by value", func() {
+		query := url.Values{"handles": {"tourist", "a;b"}}
+		signed, err := cfapi.Sign("key", "s3cr3t", "user.info", query,
+			time.Unix(1660000000, 0), "abcdef")
+		Expect(err).Should(BeNil())
+
+		Expect(signed.Get("apiSig")).Should(Equal("abcdef" +
+			"a41d07220b9172ff45ff9a2cea243bce3b384159668871bd682ae8e1e6fa3ed1" +
+			"c7cdae59dd9a3a897463cb77ac9d8c63608f87028b258c3146a1ceadc1d1c3d4"))
+	})
+
+	Describe("client", func() {
+		var server *cftest.Server
+
+		BeforeEach(func() {
+			server = cftest.NewServer()
+			DeferCleanup(server.Close)
+			server.RequireAPIKey("fake-key", "fake-secret")
+		})
+
+		newClient := func(secret string) cfapi.CodeforcesAPI {
+			return cfapi.NewCodeforcesClient(time.Second,
+				cfapi.WithBaseURL(server.BaseURL()),
+				cfapi.WithRateLimit(0, 0),
+				cfapi.WithAPIKey("fake-key", secret))
+		}
+
+		It("should sign every call", func() {
+			client := newClient("fake-secret")
+			Expect(client.ContestList(ctx, false)).Error().
+				ShouldNot(HaveOccurred())
+			Expect(client.RecentActions(ctx, 1)).Error().
+				ShouldNot(HaveOccurred())
+
+			query, err := url.ParseQuery(server.Requests("recentActions")[0])
+			Expect(err).Should(BeNil())
+			Expect(query.Get("apiSig")).Should(HaveLen(6 + 128))
+			Expect(server.Requests("recentActions")[0]).ShouldNot(
+				ContainSubstring("fake-secret"))
+		})
+
+		It("should be rejected with the wrong secret", func() {
+			_, err := newClient("wrong-secret").RecentActions(ctx, 1)
+			var failedErr *cfapi.FailedStatusError
+			Expect(errors.As(err, &failedErr)).Should(BeTrue())
+			Expect(failedErr.Comment).Should(Equal(
+				"apiSig: Incorrect signature"))
+		})
+	})
+
+	Describe("LoadAPISecret", func() {
+		var path string
+
+		BeforeEach(func() {
+			path = filepath.Join(GinkgoT().TempDir(), "secret")
+			Expect(os.WriteFile(path, []byte("file-secret\n"), 0600)).
+				Should(Succeed())
+			os.Unsetenv(cfapi.APISecretEnv)
+			DeferCleanup(os.Unsetenv, cfapi.APISecretEnv)
+		})
+
+		It("should read the secret from the file", func() {
+			Expect(cfapi.LoadAPISecret(path)).Should(Equal("file-secret"))
+			Expect(cfapi.LoadAPISecret("")).Should(BeEmpty())
+		})
+
+		It("should prefer the environment variable", func() {
+			os.Setenv(cfapi.APISecretEnv, "env-secret")
+			Expect(cfapi.LoadAPISecret(path)).Should(Equal("env-secret"))
+		})
+
+		It("should fail on a missing file", func() {
+			_, err := cfapi.LoadAPISecret(path + ".missing")
+			Expect(err).ShouldNot(BeNil())
+		})
+	})
+})
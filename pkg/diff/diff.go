@@ -0,0 +1,209 @@
+// Package diff computes the differences between two versions of a text, line
+// by line or word by word, e.g. to show how a blog was edited.
+package diff
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// kMaxEdits bounds the work done on very different texts. Beyond it, the
+	// old text is deleted and the new one inserted as a whole.
+	kMaxEdits = 1000
+)
+
+// Kind tells how a piece of text changed between the two versions.
+type Kind string
+
+const (
+	Equal  Kind = "equal"
+	Insert Kind = "insert"
+	Delete Kind = "delete"
+)
+
+// Edit is a piece of text which is kept, inserted or deleted. Concatenating
+// the Equal and Delete edits gives the old text, and concatenating the Equal
+// and Insert edits gives the new one.
+type Edit struct {
+	Kind Kind   `json:"kind"`
+	Text string `json:"text"`
+}
+
+// Lines returns the edits turning the old text into the new one, line by line.
+func Lines(old, new string) []Edit {
+	return diff(splitLines(old), splitLines(new))
+}
+
+// Words returns the edits turning the old text into the new one, word by word.
+// The whitespace between the words is compared as well.
+func Words(old, new string) []Edit {
+	return diff(splitWords(old), splitWords(new))
+}
+
+// splitLines splits the text after every newline, so that the lines keep their
+// terminator.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// splitWords splits the text into runs of whitespace and of other characters.
+func splitWords(text string) []string {
+	var res []string
+	start := 0
+	inSpace := false
+	for ind, r := range text {
+		if ind > start && unicode.IsSpace(r) != inSpace {
+			res = append(res, text[start:ind])
+			start = ind
+		}
+		inSpace = unicode.IsSpace(r)
+	}
+	if start < len(text) {
+		res = append(res, text[start:])
+	}
+	return res
+}
+
+// diff returns the shortest edits turning the old tokens into the new ones,
+// with the algorithm of Myers.
+func diff(old, new []string) []Edit {
+	// The common prefix and suffix are kept as is, which spares most of the
+	// work for small edits of long texts.
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix &&
+		old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+
+	var edits []Edit
+	add := func(kind Kind, tokens ...string) {
+		for _, token := range tokens {
+			edits = append(edits, Edit{Kind: kind, Text: token})
+		}
+	}
+	add(Equal, old[:prefix]...)
+	middle := shortestEdits(old[prefix:len(old)-suffix],
+		new[prefix:len(new)-suffix])
+	if middle == nil {
+		add(Delete, old[prefix:len(old)-suffix]...)
+		add(Insert, new[prefix:len(new)-suffix]...)
+	}
+	edits = append(edits, middle...)
+	add(Equal, old[len(old)-suffix:]...)
+	return merge(edits)
+}
+
+// shortestEdits returns the edits of a shortest edit script, one per token,
+// or nil if it takes more than kMaxEdits edits.
+func shortestEdits(old, new []string) []Edit {
+	n, m := len(old), len(new)
+	if n == 0 && m == 0 {
+		return []Edit{}
+	}
+
+	// v[offset+k] is the furthest x reached on the diagonal k = x - y, and
+	// trace[d] holds the diagonals -(d-1) to d-1 as they were before round d.
+	offset := kMaxEdits + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+	for d := 0; d <= kMaxEdits; d++ {
+		if d > 0 {
+			trace = append(trace, append([]int(nil),
+				v[offset-d+1:offset+d]...))
+		} else {
+			trace = append(trace, nil)
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && old[x] == new[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(old, new, trace, d)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the trace back from the end of both texts, and returns the
+// edits in order.
+func backtrack(old, new []string, trace [][]int, edits int) []Edit {
+	var res []Edit
+	x, y := len(old), len(new)
+	for d := edits; d > 0; d-- {
+		previous := func(k int) int {
+			return trace[d][k+d-1]
+		}
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && previous(k-1) < previous(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := previous(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			res = append(res, Edit{Kind: Equal, Text: old[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			res = append(res, Edit{Kind: Insert, Text: new[y-1]})
+		} else {
+			res = append(res, Edit{Kind: Delete, Text: old[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 {
+		res = append(res, Edit{Kind: Equal, Text: old[x-1]})
+		x--
+	}
+
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+// merge joins the consecutive edits of the same kind. The texts of a run are
+// joined at once, since appending them one by one copies the run every time.
+func merge(edits []Edit) []Edit {
+	res := []Edit{}
+	for start := 0; start < len(edits); {
+		end := start + 1
+		for end < len(edits) && edits[end].Kind == edits[start].Kind {
+			end++
+		}
+
+		var text strings.Builder
+		for _, edit := range edits[start:end] {
+			text.WriteString(edit.Text)
+		}
+		res = append(res, Edit{Kind: edits[start].Kind, Text: text.String()})
+		start = end
+	}
+	return res
+}
@@ -0,0 +1,105 @@
+package diff_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/diff"
+)
+
+// apply rebuilds the old and the new text from the edits.
+func apply(edits []diff.Edit) (string, string) {
+	var old, new strings.Builder
+	for _, edit := range edits {
+		if edit.Kind != diff.Insert {
+			old.WriteString(edit.Text)
+		}
+		if edit.Kind != diff.Delete {
+			new.WriteString(edit.Text)
+		}
+	}
+	return old.String(), new.String()
+}
+
+var _ = Describe("Diff", func() {
+	It("should diff line by line", func() {
+		edits := diff.Lines("a\nb\nc\nd\n", "a\nc\nx\nd\n")
+		Expect(edits).Should(Equal([]diff.Edit{
+			{Kind: diff.Equal, Text: "a\n"},
+			{Kind: diff.Delete, Text: "b\n"},
+			{Kind: diff.Equal, Text: "c\n"},
+			{Kind: diff.Insert, Text: "x\n"},
+			{Kind: diff.Equal, Text: "d\n"},
+		}))
+	})
+
+	It("should diff word by word", func() {
+		edits := diff.Words("the quick brown fox", "the slow brown  fox")
+		Expect(edits).Should(Equal([]diff.Edit{
+			{Kind: diff.Equal, Text: "the "},
+			{Kind: diff.Delete, Text: "quick"},
+			{Kind: diff.Insert, Text: "slow"},
+			{Kind: diff.Equal, Text: " brown"},
+			{Kind: diff.Delete, Text: " "},
+			{Kind: diff.Insert, Text: "  "},
+			{Kind: diff.Equal, Text: "fox"},
+		}))
+	})
+
+	It("should handle empty texts", func() {
+		Expect(diff.Lines("", "")).Should(BeEmpty())
+		Expect(diff.Lines("", "a\n")).Should(Equal([]diff.Edit{
+			{Kind: diff.Insert, Text: "a\n"},
+		}))
+		Expect(diff.Words("a b", "")).Should(Equal([]diff.Edit{
+			{Kind: diff.Delete, Text: "a b"},
+		}))
+	})
+
+	It("should rebuild both texts from the edits", func() {
+		old := "Bonjour\nle monde\ncontinue ici\navec\ndes lignes\n"
+		new := "le monde\ncontinue là\navec\nencore\ndes lignes"
+		for _, edits := range [][]diff.Edit{
+			diff.Lines(old, new),
+			diff.Words(old, new),
+		} {
+			rebuiltOld, rebuiltNew := apply(edits)
+			Expect(rebuiltOld).Should(Equal(old))
+			Expect(rebuiltNew).Should(Equal(new))
+		}
+	})
+
+	It("should replace very different texts as a whole", func() {
+		var old, new []string
+		for ind := 0; ind < 3000; ind++ {
+			old = append(old, "old")
+			new = append(new, "new")
+		}
+
+		edits := diff.Words(strings.Join(old, " "), strings.Join(new, " "))
+		Expect(edits).Should(HaveLen(2))
+		Expect(edits[0].Kind).Should(Equal(diff.Delete))
+		Expect(edits[1].Kind).Should(Equal(diff.Insert))
+	})
+
+	It("should diff long texts in linear time", func() {
+		// The texts are close to the largest content diffed by the server.
+		old := strings.Repeat("some words\n", 23000)
+		new := old[:len(old)/2] + "other\n" + old[len(old)/2:]
+
+		started := time.Now()
+		for _, edits := range [][]diff.Edit{
+			diff.Lines(old, new),
+			diff.Words(old, new),
+		} {
+			Expect(edits).Should(HaveLen(3))
+			rebuiltOld, rebuiltNew := apply(edits)
+			Expect(rebuiltOld).Should(Equal(old))
+			Expect(rebuiltNew).Should(Equal(new))
+		}
+		Expect(time.Since(started)).Should(BeNumerically("<", time.Second))
+	})
+})
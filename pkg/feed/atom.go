@@ -0,0 +1,96 @@
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/utils"
+)
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Id        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	Updated   string      `xml:"updated"`
+	Generator string      `xml:"generator"`
+	Links     []atomLink  `xml:"link"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	Uri  string `xml:"uri,omitempty"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Link    atomLink    `xml:"link"`
+	Content atomContent `xml:"content"`
+}
+
+// RenderAtom renders the recent actions as an Atom 1.0 document.
+func RenderAtom(meta Metadata, actions []models.RecentAction) ([]byte, error) {
+	items := newItems(actions)
+
+	doc := atomFeed{
+		Id:        meta.SelfLink,
+		Title:     meta.Title,
+		Subtitle:  meta.Description,
+		Updated:   lastUpdated(items).Format(time.RFC3339),
+		Generator: kGenerator,
+		Links: []atomLink{
+			{Href: meta.SelfLink, Rel: "self", Type: "application/atom+xml"},
+			{Href: meta.Link, Rel: "alternate", Type: "text/html"},
+		},
+	}
+
+	if meta.NextLink != "" {
+		doc.Links = append(doc.Links, atomLink{
+			Href: meta.NextLink,
+			Rel:  "next",
+			Type: "application/atom+xml",
+		})
+	}
+
+	for _, it := range items {
+		doc.Entries = append(doc.Entries, atomEntry{
+			Id:      it.guid,
+			Title:   it.title,
+			Updated: it.updated.Format(time.RFC3339),
+			Author: atomPerson{
+				Name: it.author,
+				Uri:  utils.ProfileURL(it.author),
+			},
+			Link: atomLink{Href: it.link, Rel: "alternate", Type: "text/html"},
+			Content: atomContent{
+				Type:  "html",
+				Value: it.content,
+			},
+		})
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, errors.Errorf("could not marshal atom feed with error [%v]",
+			err)
+	}
+	return append([]byte(xml.Header), body...), nil
+}
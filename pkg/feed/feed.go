@@ -0,0 +1,121 @@
+// Package feed renders recent actions as syndication feeds, so that ordinary
+// feed readers can follow the activity stored by the application. It also
+// renders contests as an iCalendar document for calendar apps.
+package feed
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/utils"
+)
+
+const (
+	RSSContentType      = "application/rss+xml; charset=utf-8"
+	AtomContentType     = "application/atom+xml; charset=utf-8"
+	JSONFeedContentType = "application/feed+json; charset=utf-8"
+
+	kGenerator = "cfrss"
+)
+
+// htmlTagRegex matches any HTML tag. Codeforces embeds markup in blog titles,
+// which has to be stripped before it can be used as a plain text title.
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// Metadata describes the feed as a whole.
+type Metadata struct {
+	// Title is the human readable name of the feed.
+	Title string
+
+	// Description is a short summary of the feed's contents.
+	Description string
+
+	// Link is the URL of the HTML page that the feed corresponds to.
+	Link string
+
+	// SelfLink is the absolute URL at which the feed itself is served.
+	// It doubles as the unique identifier of the Atom feed.
+	SelfLink string
+
+	// NextLink is the absolute URL of the next, older page of the feed.
+	// It is empty on the last page.
+	NextLink string
+}
+
+// item is the format agnostic representation of a single feed entry.
+type item struct {
+	guid    string
+	title   string
+	link    string
+	author  string
+	content string
+	updated time.Time
+}
+
+// newItem converts a recent action into a feed entry.
+// It returns false if the action does not carry enough data to be rendered.
+func newItem(action models.RecentAction) (item, bool) {
+	if action.BlogEntry == nil {
+		return item{}, false
+	}
+
+	blog := action.BlogEntry
+	blogTitle := plainText(blog.Title)
+	it := item{
+		updated: time.Unix(action.TimeSeconds, 0).UTC(),
+	}
+
+	if action.Comment != nil {
+		// The comment permalink never changes, hence it is a stable GUID.
+		it.link = utils.CommentURL(blog.Id, action.Comment.Id)
+		it.guid = it.link
+		it.author = action.Comment.CommentatorHandle
+		it.title = fmt.Sprintf("%s commented on %q", it.author, blogTitle)
+		it.content = action.Comment.Text
+		return it, true
+	}
+
+	// A blog may be modified several times, so the GUID has to include the
+	// modification time to tell the revisions apart.
+	it.link = utils.BlogEntryURL(blog.Id)
+	it.guid = fmt.Sprintf("%s?revision=%d", it.link,
+		blog.ModificationTimeSeconds)
+	it.author = blog.AuthorHandle
+	it.title = blogTitle
+	it.content = blog.Content
+	return it, true
+}
+
+// newItems converts the recent actions into feed entries, skipping the ones
+// that cannot be rendered.
+func newItems(actions []models.RecentAction) []item {
+	var items []item
+	for _, action := range actions {
+		if it, ok := newItem(action); ok {
+			items = append(items, it)
+		}
+	}
+	return items
+}
+
+// lastUpdated returns the most recent update time among the items.
+// It returns the Unix epoch if there are no items, to keep the output
+// deterministic.
+func lastUpdated(items []item) time.Time {
+	res := time.Unix(0, 0).UTC()
+	for _, it := range items {
+		if it.updated.After(res) {
+			res = it.updated
+		}
+	}
+	return res
+}
+
+// plainText strips the HTML markup from s and unescapes the entities.
+func plainText(s string) string {
+	return strings.TrimSpace(html.UnescapeString(htmlTagRegex.ReplaceAllString(s, "")))
+}
@@ -0,0 +1,124 @@
+package feed_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+var _ = Describe("Feed", func() {
+	meta := feed.Metadata{
+		Title:       "fake-title",
+		Description: "fake-description",
+		Link:        "https://codeforces.com/recent-actions",
+		SelfLink:    "http://localhost/feed/recent.atom",
+	}
+	actions := []models.RecentAction{
+		{
+			TimeSeconds: 1660000000,
+			BlogEntry: &models.BlogEntry{
+				Id:    107000,
+				Title: "<p>Codeforces Round #1 &amp; more</p>",
+			},
+			Comment: &models.Comment{
+				Id:                42,
+				CommentatorHandle: "tourist",
+				Text:              "<div><a href=\"https://codeforces.com\">hi</a></div>",
+			},
+		},
+		// Actions without a blog are skipped.
+		{TimeSeconds: 1660000001},
+	}
+
+	It("should render a valid RSS document with stable GUIDs", func() {
+		body, err := feed.RenderRSS(meta, actions)
+		Expect(err).Should(BeNil())
+
+		doc := struct {
+			Channel struct {
+				Items []struct {
+					Title string `xml:"title"`
+					GUID  string `xml:"guid"`
+					Desc  string `xml:"description"`
+				} `xml:"item"`
+			} `xml:"channel"`
+		}{}
+		Expect(xml.Unmarshal(body, &doc)).Should(Succeed())
+		Expect(doc.Channel.Items).Should(HaveLen(1))
+
+		item := doc.Channel.Items[0]
+		Expect(item.GUID).Should(Equal(
+			"https://codeforces.com/blog/entry/107000#comment-42"))
+		Expect(item.Title).Should(Equal(
+			"tourist commented on \"Codeforces Round #1 & more\""))
+		Expect(item.Desc).Should(Equal(actions[0].Comment.Text))
+	})
+
+	It("should render a valid Atom document", func() {
+		body, err := feed.RenderAtom(meta, actions)
+		Expect(err).Should(BeNil())
+
+		doc := struct {
+			XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+			Id      string   `xml:"id"`
+			Updated string   `xml:"updated"`
+			Entries []struct {
+				Id     string `xml:"id"`
+				Author struct {
+					Name string `xml:"name"`
+				} `xml:"author"`
+			} `xml:"entry"`
+		}{}
+		Expect(xml.Unmarshal(body, &doc)).Should(Succeed())
+		Expect(doc.Id).Should(Equal(meta.SelfLink))
+		Expect(doc.Updated).Should(Equal("2022-08-08T23:06:40Z"))
+		Expect(doc.Entries).Should(HaveLen(1))
+		Expect(doc.Entries[0].Id).Should(Equal(
+			"https://codeforces.com/blog/entry/107000#comment-42"))
+		Expect(doc.Entries[0].Author.Name).Should(Equal("tourist"))
+	})
+
+	It("should render a folded iCalendar document", func() {
+		contests := []models.Contest{
+			{
+				Id: 1700,
+				Name: "Codeforces Round #1, Div. 2; " +
+					strings.Repeat("x", 80),
+				Phase:            "BEFORE",
+				DurationSeconds:  8100,
+				StartTimeSeconds: 1660000000,
+			},
+			// Contests without a start time are skipped.
+			{Id: 1701, Name: "unscheduled"},
+		}
+		body, err := feed.RenderICalendar(meta, contests,
+			time.Unix(1650000000, 0))
+		Expect(err).Should(BeNil())
+
+		doc := string(body)
+		Expect(doc).Should(HavePrefix("BEGIN:VCALENDAR\r\n"))
+		Expect(doc).Should(HaveSuffix("END:VCALENDAR\r\n"))
+		Expect(strings.Count(doc, "BEGIN:VEVENT")).Should(Equal(1))
+		for _, line := range strings.Split(doc, "\r\n") {
+			Expect(len(line)).Should(BeNumerically("<=", 75))
+		}
+
+		// Unfold the lines before looking at the values.
+		doc = strings.ReplaceAll(doc, "\r\n ", "")
+		Expect(doc).Should(ContainSubstring("DTSTART:20220808T230640Z\r\n"))
+		Expect(doc).Should(ContainSubstring("DTEND:20220809T012140Z\r\n"))
+		Expect(doc).Should(ContainSubstring(
+			"SUMMARY:Codeforces Round #1\\, Div. 2\\; x"))
+		Expect(doc).Should(ContainSubstring("DESCRIPTION:Phase: BEFORE\\n" +
+			"Duration: 02:15\\nRegister: " +
+			"https://codeforces.com/contestRegistration/1700\r\n"))
+		Expect(doc).Should(ContainSubstring(
+			"URL:https://codeforces.com/contest/1700\r\n"))
+	})
+})
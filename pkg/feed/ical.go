@@ -0,0 +1,109 @@
+package feed
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/utils"
+)
+
+const (
+	ICalendarContentType = "text/calendar; charset=utf-8"
+
+	kICalendarTimeLayout = "20060102T150405Z"
+
+	// kICalendarLineLength is the maximum length of a line, in octets,
+	// before it must be folded.
+	kICalendarLineLength = 75
+)
+
+// iCalendarEscaper escapes the characters that are special in TEXT values.
+var iCalendarEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+// iCalendarWriter writes content lines, terminated by CRLF and folded as
+// required by RFC 5545.
+type iCalendarWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *iCalendarWriter) line(name, value string) {
+	content := name + ":" + value
+	for len(content) > kICalendarLineLength {
+		// Never split a multi-byte character across lines.
+		cut := kICalendarLineLength
+		for !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		w.buf.WriteString(content[:cut] + "\r\n")
+
+		// Continuation lines begin with a space, which counts towards
+		// their length.
+		content = " " + content[cut:]
+	}
+	w.buf.WriteString(content + "\r\n")
+}
+
+func (w *iCalendarWriter) text(name, value string) {
+	w.line(name, iCalendarEscaper.Replace(value))
+}
+
+func iCalendarTime(timeSeconds int64) string {
+	return time.Unix(timeSeconds, 0).UTC().Format(kICalendarTimeLayout)
+}
+
+// formatContestDuration formats the duration as hours and minutes, the way
+// Codeforces displays it.
+func formatContestDuration(durationSeconds int64) string {
+	return fmt.Sprintf("%02d:%02d", durationSeconds/3600,
+		durationSeconds%3600/60)
+}
+
+// RenderICalendar renders the contests as an iCalendar document, with one
+// event per contest. Contests without a start time are skipped. The time
+// stamp of every event is set to now.
+func RenderICalendar(meta Metadata, contests []models.Contest,
+	now time.Time) ([]byte, error) {
+	w := new(iCalendarWriter)
+
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.text("PRODID", "-//"+kGenerator+"//contests//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	w.text("X-WR-CALNAME", meta.Title)
+	w.text("X-WR-CALDESC", meta.Description)
+
+	stamp := iCalendarTime(now.Unix())
+	for _, contest := range contests {
+		if contest.StartTimeSeconds == 0 {
+			continue
+		}
+
+		description := fmt.Sprintf("Phase: %s\nDuration: %s\nRegister: %s",
+			contest.Phase, formatContestDuration(contest.DurationSeconds),
+			utils.ContestRegistrationURL(contest.Id))
+
+		w.line("BEGIN", "VEVENT")
+		w.text("UID", fmt.Sprintf("contest-%d@%s", contest.Id, kGenerator))
+		w.line("DTSTAMP", stamp)
+		w.line("DTSTART", iCalendarTime(contest.StartTimeSeconds))
+		w.line("DTEND", iCalendarTime(contest.EndTimeSeconds()))
+		w.text("SUMMARY", contest.Name)
+		w.text("DESCRIPTION", description)
+		w.line("URL", utils.ContestURL(contest.Id))
+		w.line("END", "VEVENT")
+	}
+
+	w.line("END", "VCALENDAR")
+	return w.buf.Bytes(), nil
+}
@@ -0,0 +1,76 @@
+package feed
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/utils"
+)
+
+const (
+	kJSONFeedVersion = "https://jsonfeed.org/version/1.1"
+)
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageUrl string         `json:"home_page_url,omitempty"`
+	FeedUrl     string         `json:"feed_url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	NextUrl     string         `json:"next_url,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	Url  string `json:"url,omitempty"`
+}
+
+type jsonFeedItem struct {
+	Id            string           `json:"id"`
+	Url           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHtml   string           `json:"content_html"`
+	DatePublished string           `json:"date_published"`
+	Authors       []jsonFeedAuthor `json:"authors"`
+}
+
+// RenderJSONFeed renders the recent actions as a JSON Feed 1.1 document.
+func RenderJSONFeed(meta Metadata, actions []models.RecentAction) ([]byte, error) {
+	items := newItems(actions)
+
+	doc := jsonFeed{
+		Version:     kJSONFeedVersion,
+		Title:       meta.Title,
+		HomePageUrl: meta.Link,
+		FeedUrl:     meta.SelfLink,
+		Description: meta.Description,
+		NextUrl:     meta.NextLink,
+		// The specification requires the items array even if it is empty.
+		Items: []jsonFeedItem{},
+	}
+
+	for _, it := range items {
+		doc.Items = append(doc.Items, jsonFeedItem{
+			Id:            it.guid,
+			Url:           it.link,
+			Title:         it.title,
+			ContentHtml:   it.content,
+			DatePublished: it.updated.Format(time.RFC3339),
+			Authors: []jsonFeedAuthor{{
+				Name: it.author,
+				Url:  utils.ProfileURL(it.author),
+			}},
+		})
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Errorf("could not marshal json feed with error [%v]",
+			err)
+	}
+	return body, nil
+}
@@ -0,0 +1,101 @@
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+type rssDocument struct {
+	XMLName  xml.Name   `xml:"rss"`
+	Version  string     `xml:"version,attr"`
+	AtomNS   string     `xml:"xmlns:atom,attr"`
+	DublinNS string     `xml:"xmlns:dc,attr"`
+	Channel  rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Links         []rssLink `xml:"atom:link"`
+	Generator     string    `xml:"generator"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	Creator     string  `xml:"dc:creator"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+// RenderRSS renders the recent actions as an RSS 2.0 document.
+func RenderRSS(meta Metadata, actions []models.RecentAction) ([]byte, error) {
+	items := newItems(actions)
+
+	doc := rssDocument{
+		Version:  "2.0",
+		AtomNS:   "http://www.w3.org/2005/Atom",
+		DublinNS: "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       meta.Title,
+			Link:        meta.Link,
+			Description: meta.Description,
+			Links: []rssLink{{
+				Href: meta.SelfLink,
+				Rel:  "self",
+				Type: "application/rss+xml",
+			}},
+			Generator:     kGenerator,
+			LastBuildDate: lastUpdated(items).Format(time.RFC1123Z),
+		},
+	}
+
+	if meta.NextLink != "" {
+		doc.Channel.Links = append(doc.Channel.Links, rssLink{
+			Href: meta.NextLink,
+			Rel:  "next",
+			Type: "application/rss+xml",
+		})
+	}
+
+	for _, it := range items {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title: it.title,
+			Link:  it.link,
+			GUID: rssGUID{
+				// Only comment GUIDs are resolvable links.
+				IsPermaLink: it.guid == it.link,
+				Value:       it.guid,
+			},
+			Creator:     it.author,
+			PubDate:     it.updated.Format(time.RFC1123Z),
+			Description: it.content,
+		})
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, errors.Errorf("could not marshal rss feed with error [%v]",
+			err)
+	}
+	return append([]byte(xml.Header), body...), nil
+}
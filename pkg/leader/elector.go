@@ -0,0 +1,194 @@
+// Package leader elects the replica that performs a task, e.g. running the
+// schedulers, through leases persisted in the store.
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+)
+
+const (
+	// SchedulerLease is the name of the lease held by the replica that runs
+	// the schedulers.
+	SchedulerLease = "scheduler"
+
+	kDefaultTTL = 30 * time.Second
+)
+
+// ErrNotLeader is returned by Fence when the replica does not hold the lease.
+var ErrNotLeader = errors.New("the lease is not held by this replica")
+
+// Elector campaigns for a lease on behalf of a replica. It is safe for
+// concurrent use.
+type Elector struct {
+	cfStore store.CodeforcesStore
+	name    string
+	holder  string
+	ttl     time.Duration
+	now     func() time.Time
+
+	mutex sync.Mutex
+
+	// lease is the lease held by the replica, or nil.
+	lease *models.Lease
+}
+
+// Option customizes an Elector.
+type Option func(*Elector)
+
+// WithTTL sets the duration for which the lease is granted. The elector
+// renews it three times per ttl.
+func WithTTL(ttl time.Duration) Option {
+	return func(elector *Elector) {
+		elector.ttl = ttl
+	}
+}
+
+// WithClock replaces the wall clock, mostly for tests. The clocks of all the
+// replicas are assumed to be roughly in sync.
+func WithClock(now func() time.Time) Option {
+	return func(elector *Elector) {
+		elector.now = now
+	}
+}
+
+// Holder returns the identity of the replica.
+func (elector *Elector) Holder() string {
+	return elector.holder
+}
+
+// Campaign acquires the lease, or renews it if the replica already holds it.
+// It reports whether the replica holds the lease afterwards.
+func (elector *Elector) Campaign(ctx context.Context) (bool, error) {
+	lease, err := elector.cfStore.AcquireLease(ctx, elector.name,
+		elector.holder, elector.now(), elector.ttl)
+	if err != nil {
+		// The lease held so far, if any, stays valid until it expires.
+		return elector.IsLeader(), errors.Errorf("could not acquire lease "+
+			"%s with error [%v]", elector.name, err)
+	}
+
+	elector.mutex.Lock()
+	defer elector.mutex.Unlock()
+
+	held := lease.Holder == elector.holder
+	switch {
+	case held && (elector.lease == nil || elector.lease.Token != lease.Token):
+		zap.S().Infof("Acquired lease %s with token %d", elector.name,
+			lease.Token)
+	case !held && elector.lease != nil:
+		zap.S().Warnf("Lost lease %s to %s", elector.name, lease.Holder)
+	}
+
+	elector.lease = nil
+	if held {
+		elector.lease = lease
+	}
+	return held, nil
+}
+
+// Run campaigns for the lease until the context is done. It does not release
+// the lease, so that the caller can finish its work first, see Release.
+func (elector *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(elector.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		if _, err := elector.Campaign(ctx); err != nil {
+			zap.S().Errorf("Campaign for lease %s failed with error [%v]",
+				elector.name, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// IsLeader reports whether the replica holds an unexpired lease, as far as it
+// knows. Fence checks it against the store.
+func (elector *Elector) IsLeader() bool {
+	elector.mutex.Lock()
+	defer elector.mutex.Unlock()
+
+	return elector.lease != nil &&
+		elector.lease.HeldBy(elector.holder, elector.now())
+}
+
+// Fence checks that the replica still holds the lease that it acquired, with
+// the same token. Writers call it before writing, so that a replica which
+// lost the lease without noticing, e.g. after a long pause, backs off once
+// another replica took over. The returned error wraps ErrNotLeader if the
+// lease is not held anymore.
+func (elector *Elector) Fence(ctx context.Context) error {
+	elector.mutex.Lock()
+	held := elector.lease
+	elector.mutex.Unlock()
+
+	if held == nil {
+		return errors.Wrapf(ErrNotLeader, "lease %s", elector.name)
+	}
+
+	current, err := elector.cfStore.QueryLease(ctx, elector.name)
+	if err != nil {
+		return errors.Errorf("could not check lease %s with error [%v]",
+			elector.name, err)
+	}
+	if current == nil || current.Token != held.Token ||
+		!current.HeldBy(elector.holder, elector.now()) {
+		elector.mutex.Lock()
+		if elector.lease == held {
+			elector.lease = nil
+		}
+		elector.mutex.Unlock()
+		return errors.Wrapf(ErrNotLeader, "lease %s with token %d",
+			elector.name, held.Token)
+	}
+	return nil
+}
+
+// Release gives up the lease, so that another replica can take over without
+// waiting for it to expire.
+func (elector *Elector) Release(ctx context.Context) error {
+	elector.mutex.Lock()
+	held := elector.lease
+	elector.lease = nil
+	elector.mutex.Unlock()
+
+	if held == nil {
+		return nil
+	}
+	if err := elector.cfStore.ReleaseLease(ctx, elector.name, elector.holder,
+		held.Token, elector.now()); err != nil {
+		return errors.Errorf("could not release lease %s with error [%v]",
+			elector.name, err)
+	}
+	zap.S().Infof("Released lease %s", elector.name)
+	return nil
+}
+
+// NewElector creates an elector campaigning for the named lease on behalf of
+// the holder, which must be unique across the replicas.
+func NewElector(cfStore store.CodeforcesStore, name, holder string,
+	opts ...Option) *Elector {
+	elector := &Elector{
+		cfStore: cfStore,
+		name:    name,
+		holder:  holder,
+		ttl:     kDefaultTTL,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(elector)
+	}
+	return elector
+}
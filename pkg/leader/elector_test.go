@@ -0,0 +1,88 @@
+package leader_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/leader"
+	"github.com/variety-jones/cfrss/pkg/store"
+)
+
+var _ = Describe("Elector", func() {
+	ctx := context.Background()
+	ttl := 30 * time.Second
+
+	var cfStore store.CodeforcesStore
+	var now time.Time
+	var first, second *leader.Elector
+
+	BeforeEach(func() {
+		cfStore = store.NewInMemoryCodeforcesStore()
+		now = time.Unix(1000, 0).UTC()
+		clock := func() time.Time { return now }
+
+		first = leader.NewElector(cfStore, leader.SchedulerLease, "first",
+			leader.WithTTL(ttl), leader.WithClock(clock))
+		second = leader.NewElector(cfStore, leader.SchedulerLease, "second",
+			leader.WithTTL(ttl), leader.WithClock(clock))
+	})
+
+	It("should elect a single leader", func() {
+		Expect(first.Campaign(ctx)).Should(BeTrue())
+		Expect(second.Campaign(ctx)).Should(BeFalse())
+
+		Expect(first.IsLeader()).Should(BeTrue())
+		Expect(second.IsLeader()).Should(BeFalse())
+		Expect(first.Fence(ctx)).Should(Succeed())
+		Expect(errors.Is(second.Fence(ctx), leader.ErrNotLeader)).
+			Should(BeTrue())
+	})
+
+	It("should keep the lease while it is renewed", func() {
+		Expect(first.Campaign(ctx)).Should(BeTrue())
+		for ind := 0; ind < 5; ind++ {
+			now = now.Add(ttl / 2)
+			Expect(first.Campaign(ctx)).Should(BeTrue())
+			Expect(second.Campaign(ctx)).Should(BeFalse())
+		}
+
+		lease, err := cfStore.QueryLease(ctx, leader.SchedulerLease)
+		Expect(err).Should(BeNil())
+		Expect(lease.Token).Should(Equal(int64(1)))
+	})
+
+	It("should fence the previous leader after a handover", func() {
+		Expect(first.Campaign(ctx)).Should(BeTrue())
+
+		// The first replica stalls, and misses the renewal.
+		now = now.Add(ttl)
+		Expect(first.IsLeader()).Should(BeFalse())
+		Expect(second.Campaign(ctx)).Should(BeTrue())
+		Expect(second.Fence(ctx)).Should(Succeed())
+
+		err := first.Fence(ctx)
+		Expect(errors.Is(err, leader.ErrNotLeader)).Should(BeTrue())
+
+		// Taking the lease back yields a new token, which fences the
+		// second replica in turn.
+		now = now.Add(ttl)
+		Expect(first.Campaign(ctx)).Should(BeTrue())
+		lease, err := cfStore.QueryLease(ctx, leader.SchedulerLease)
+		Expect(err).Should(BeNil())
+		Expect(lease.Token).Should(Equal(int64(3)))
+		Expect(errors.Is(second.Fence(ctx), leader.ErrNotLeader)).
+			Should(BeTrue())
+	})
+
+	It("should let another replica take over after a release", func() {
+		Expect(first.Campaign(ctx)).Should(BeTrue())
+		Expect(first.Release(ctx)).Should(Succeed())
+		Expect(first.IsLeader()).Should(BeFalse())
+
+		Expect(second.Campaign(ctx)).Should(BeTrue())
+	})
+})
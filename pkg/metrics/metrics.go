@@ -0,0 +1,33 @@
+// Package metrics collects the counters and gauges reported by the
+// application, so that they can be served by the web server.
+package metrics
+
+import (
+	"expvar"
+)
+
+// registry holds every metric. It is deliberately not published to the
+// global expvar handler, which would also expose the command line flags.
+var registry expvar.Map
+
+// Add increments the counter with the given name.
+func Add(name string, delta int64) {
+	registry.Add(name, delta)
+}
+
+// AddFloat increments the floating point counter with the given name.
+func AddFloat(name string, delta float64) {
+	registry.AddFloat(name, delta)
+}
+
+// SetFloat sets the gauge with the given name.
+func SetFloat(name string, value float64) {
+	gauge := new(expvar.Float)
+	gauge.Set(value)
+	registry.Set(name, gauge)
+}
+
+// JSON returns all the metrics as a JSON object.
+func JSON() string {
+	return registry.String()
+}
@@ -1,6 +1,13 @@
 // Package models contains all the shared models for the application.
 package models
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
 // BlogEntry represents a sample blog on Codeforces.
 type BlogEntry struct {
 	Id                      int      `bson:"id" json:"id"`
@@ -34,12 +41,292 @@ type RecentAction struct {
 	Comment     *Comment   `bson:"comment,omitempty" json:"comment,omitempty"`
 }
 
+// NaturalKey uniquely identifies the action across repeated API calls.
+// Comments are identified by their blog and comment ids, while blog updates
+// are identified by the blog id and its modification time.
+func (action RecentAction) NaturalKey() string {
+	switch {
+	case action.BlogEntry != nil && action.Comment != nil:
+		return fmt.Sprintf("blog:%d:comment:%d", action.BlogEntry.Id,
+			action.Comment.Id)
+	case action.BlogEntry != nil:
+		return fmt.Sprintf("blog:%d:modified:%d", action.BlogEntry.Id,
+			action.BlogEntry.ModificationTimeSeconds)
+	default:
+		return fmt.Sprintf("time:%d", action.TimeSeconds)
+	}
+}
+
+// CodeforcesUser represents the profile of a user on Codeforces.
+type CodeforcesUser struct {
+	Handle                  string `bson:"handle" json:"handle"`
+	Email                   string `bson:"email,omitempty" json:"email,omitempty"`
+	VkId                    string `bson:"vkId,omitempty" json:"vkId,omitempty"`
+	OpenId                  string `bson:"openId,omitempty" json:"openId,omitempty"`
+	FirstName               string `bson:"firstName,omitempty" json:"firstName,omitempty"`
+	LastName                string `bson:"lastName,omitempty" json:"lastName,omitempty"`
+	Country                 string `bson:"country,omitempty" json:"country,omitempty"`
+	City                    string `bson:"city,omitempty" json:"city,omitempty"`
+	Organization            string `bson:"organization,omitempty" json:"organization,omitempty"`
+	Contribution            int    `bson:"contribution" json:"contribution"`
+	Rank                    string `bson:"rank" json:"rank"`
+	Rating                  int    `bson:"rating" json:"rating"`
+	MaxRank                 string `bson:"maxRank" json:"maxRank"`
+	MaxRating               int    `bson:"maxRating" json:"maxRating"`
+	LastOnlineTimeSeconds   int64  `bson:"lastOnlineTimeSeconds" json:"lastOnlineTimeSeconds"`
+	RegistrationTimeSeconds int64  `bson:"registrationTimeSeconds" json:"registrationTimeSeconds"`
+	FriendOfCount           int    `bson:"friendOfCount" json:"friendOfCount"`
+	Avatar                  string `bson:"avatar" json:"avatar"`
+	TitlePhoto              string `bson:"titlePhoto" json:"titlePhoto"`
+
+	// FetchedAt is the time at which the profile was retrieved from
+	// Codeforces. It is only tracked by the profile cache.
+	FetchedAt time.Time `bson:"fetchedAt" json:"-"`
+
+	// Missing is set in the profile cache for the handles which Codeforces
+	// does not know, e.g. because the user was renamed or deleted, so that
+	// they are not queried again before the profile expires.
+	Missing bool `bson:"missing,omitempty" json:"-"`
+}
+
+// Color returns the color in which Codeforces displays the handle of the
+// user, based on their rank.
+func (user CodeforcesUser) Color() string {
+	switch user.Rank {
+	case "newbie":
+		return "gray"
+	case "pupil":
+		return "green"
+	case "specialist":
+		return "cyan"
+	case "expert":
+		return "blue"
+	case "candidate master":
+		return "violet"
+	case "master", "international master":
+		return "orange"
+	case "grandmaster", "international grandmaster",
+		"legendary grandmaster":
+		return "red"
+	default:
+		return "black"
+	}
+}
+
+// RatingChange represents a change in the rating of a user after a contest.
+type RatingChange struct {
+	ContestId               int    `bson:"contestId" json:"contestId"`
+	ContestName             string `bson:"contestName" json:"contestName"`
+	Handle                  string `bson:"handle" json:"handle"`
+	Rank                    int    `bson:"rank" json:"rank"`
+	RatingUpdateTimeSeconds int64  `bson:"ratingUpdateTimeSeconds" json:"ratingUpdateTimeSeconds"`
+	OldRating               int    `bson:"oldRating" json:"oldRating"`
+	NewRating               int    `bson:"newRating" json:"newRating"`
+}
+
+// Contest represents a contest on Codeforces.
+type Contest struct {
+	Id                  int    `bson:"id" json:"id"`
+	Name                string `bson:"name" json:"name"`
+	Type                string `bson:"type" json:"type"`
+	Phase               string `bson:"phase" json:"phase"`
+	Frozen              bool   `bson:"frozen" json:"frozen"`
+	DurationSeconds     int64  `bson:"durationSeconds" json:"durationSeconds"`
+	StartTimeSeconds    int64  `bson:"startTimeSeconds,omitempty" json:"startTimeSeconds,omitempty"`
+	RelativeTimeSeconds int64  `bson:"relativeTimeSeconds,omitempty" json:"relativeTimeSeconds,omitempty"`
+	PreparedBy          string `bson:"preparedBy,omitempty" json:"preparedBy,omitempty"`
+	WebsiteUrl          string `bson:"websiteUrl,omitempty" json:"websiteUrl,omitempty"`
+	Description         string `bson:"description,omitempty" json:"description,omitempty"`
+	Difficulty          int    `bson:"difficulty,omitempty" json:"difficulty,omitempty"`
+	Kind                string `bson:"kind,omitempty" json:"kind,omitempty"`
+	IcpcRegion          string `bson:"icpcRegion,omitempty" json:"icpcRegion,omitempty"`
+	Country             string `bson:"country,omitempty" json:"country,omitempty"`
+	City                string `bson:"city,omitempty" json:"city,omitempty"`
+	Season              string `bson:"season,omitempty" json:"season,omitempty"`
+}
+
+// EndTimeSeconds returns the time at which the contest ends, or zero if its
+// start time is unknown.
+func (contest Contest) EndTimeSeconds() int64 {
+	if contest.StartTimeSeconds == 0 {
+		return 0
+	}
+	return contest.StartTimeSeconds + contest.DurationSeconds
+}
+
 // User contains all the details of a user.
 type User struct {
-	Uuid             string `bson:"uuid" json:"uuid"`
-	Username         string `bson:"username" json:"username"`
-	HashedPassword   string `bson:"hashedPassword" json:"hashedPassword"`
-	Email            string `bson:"email,omitempty" json:"email,omitempty"`
-	CodeforcesHandle string `bson:"codeforcesHandle,omitempty" json:"codeforcesHandle,omitempty"`
-	SubscribedBlogs  []int  `bson:"subscribedBlogs,omitempty" json:"subscribedBlogs,omitempty"`
+	Uuid             string      `bson:"uuid" json:"uuid"`
+	Username         string      `bson:"username" json:"username"`
+	HashedPassword   string      `bson:"hashedPassword" json:"-"`
+	Email            string      `bson:"email,omitempty" json:"email,omitempty"`
+	CodeforcesHandle string      `bson:"codeforcesHandle,omitempty" json:"codeforcesHandle,omitempty"`
+	SubscribedBlogs  []int       `bson:"subscribedBlogs,omitempty" json:"subscribedBlogs,omitempty"`
+	FeedTokens       []FeedToken `bson:"feedTokens,omitempty" json:"feedTokens,omitempty"`
+}
+
+// FeedToken is a revocable secret that grants read access to the feeds of a
+// user. Only the hash of the secret is persisted.
+type FeedToken struct {
+	Id                  string `bson:"id" json:"id"`
+	HashedToken         string `bson:"hashedToken" json:"-"`
+	CreationTimeSeconds int64  `bson:"creationTimeSeconds" json:"creationTimeSeconds"`
+}
+
+// Session is a login session of a user. The session token itself is handed
+// to the client, and only its hash is persisted.
+type Session struct {
+	HashedToken string    `bson:"hashedToken" json:"-"`
+	Uuid        string    `bson:"uuid" json:"uuid"`
+	CreatedAt   time.Time `bson:"createdAt" json:"createdAt"`
+	ExpiresAt   time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// Lease grants its holder an exclusive role, e.g. running the scheduler, until
+// it expires. The holder keeps it by renewing it before then.
+type Lease struct {
+	Name   string `bson:"name" json:"name"`
+	Holder string `bson:"holder" json:"holder"`
+
+	// Token is incremented whenever the lease changes hands. Writers check
+	// it to fence off the previous holders.
+	Token      int64     `bson:"token" json:"token"`
+	AcquiredAt time.Time `bson:"acquiredAt" json:"acquiredAt"`
+	RenewedAt  time.Time `bson:"renewedAt" json:"renewedAt"`
+	ExpiresAt  time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// HeldBy reports whether the holder holds the lease at the given time.
+func (lease Lease) HeldBy(holder string, now time.Time) bool {
+	return lease.Holder == holder && now.Before(lease.ExpiresAt)
+}
+
+// Cursor is a position in a list sorted in decreasing order of time, with the
+// blog and comment ids breaking the ties. Pages resume strictly after it.
+type Cursor struct {
+	TimeSeconds int64 `json:"t"`
+	BlogId      int   `json:"b"`
+	CommentId   int   `json:"c,omitempty"`
+}
+
+// Less reports whether the cursor comes before the other one in increasing
+// order of time, blog id and comment id.
+func (cursor Cursor) Less(other Cursor) bool {
+	if cursor.TimeSeconds != other.TimeSeconds {
+		return cursor.TimeSeconds < other.TimeSeconds
+	}
+	if cursor.BlogId != other.BlogId {
+		return cursor.BlogId < other.BlogId
+	}
+	return cursor.CommentId < other.CommentId
+}
+
+// CursorOfAction returns the position of an action in the recent actions.
+func CursorOfAction(action RecentAction) Cursor {
+	cursor := Cursor{TimeSeconds: action.TimeSeconds}
+	if action.BlogEntry != nil {
+		cursor.BlogId = action.BlogEntry.Id
+	}
+	if action.Comment != nil {
+		cursor.CommentId = action.Comment.Id
+	}
+	return cursor
+}
+
+// CursorOfBlog returns the position of a blog in the list of blogs, which is
+// sorted by creation time.
+func CursorOfBlog(blog BlogEntry) Cursor {
+	return Cursor{TimeSeconds: blog.CreationTimeSeconds, BlogId: blog.Id}
+}
+
+// CursorOfComment returns the position of a comment among the comments of a
+// blog, which are sorted by creation time.
+func CursorOfComment(blogID int, comment Comment) Cursor {
+	return Cursor{
+		TimeSeconds: comment.CreationTimeSeconds,
+		BlogId:      blogID,
+		CommentId:   comment.Id,
+	}
+}
+
+// SyncGap records that some recent actions may have been missed, because more
+// actions happened between two polls than a single batch can hold.
+type SyncGap struct {
+	// StartTimestamp is the latest activity time persisted before the poll.
+	StartTimestamp int64 `bson:"startTimestamp" json:"startTimestamp"`
+
+	// EndTimestamp is the oldest activity time returned by the poll.
+	EndTimestamp int64 `bson:"endTimestamp" json:"endTimestamp"`
+
+	DetectedAt time.Time         `bson:"detectedAt" json:"detectedAt"`
+	Backfills  []BackfillOutcome `bson:"backfills" json:"backfills"`
+}
+
+// BackfillOutcome is the result of fetching the complete comment thread of a
+// blog to fill a SyncGap.
+type BackfillOutcome struct {
+	BlogId   int    `bson:"blogId" json:"blogId"`
+	Fetched  int    `bson:"fetched" json:"fetched"`
+	Inserted int    `bson:"inserted" json:"inserted"`
+	Error    string `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// SchedulerRun records the outcome of a single sync of the recent actions.
+type SchedulerRun struct {
+	// Replica is the replica which ran the sync, if there are several.
+	Replica string `bson:"replica,omitempty" json:"replica,omitempty"`
+
+	StartedAt time.Time `bson:"startedAt" json:"startedAt"`
+	EndedAt   time.Time `bson:"endedAt" json:"endedAt"`
+
+	// Fetched is the number of actions returned by Codeforces, of which New
+	// were persisted and Duplicates were already stored.
+	Fetched    int `bson:"fetched" json:"fetched"`
+	New        int `bson:"new" json:"new"`
+	Duplicates int `bson:"duplicates" json:"duplicates"`
+
+	Error string `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// Checkpoint is the durable progress of a scheduler, so that it resumes
+// where it stopped after a restart.
+type Checkpoint struct {
+	Name string `bson:"name" json:"name"`
+
+	// Timestamp is the latest activity time that the scheduler persisted.
+	Timestamp int64     `bson:"timestamp" json:"timestamp"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// BlogRevision is a distinct version of a blog, as seen in the recent actions
+// or fetched from blogEntry.view.
+type BlogRevision struct {
+	// Id identifies the version among the revisions of the blog. It is
+	// derived from the title, content, tags and modification time, so that
+	// seeing the same version again gives the same id.
+	Id     string `bson:"id" json:"id"`
+	BlogId int    `bson:"blogId" json:"blogId"`
+
+	Title                   string   `bson:"title" json:"title"`
+	Content                 string   `bson:"content" json:"content"`
+	Tags                    []string `bson:"tags" json:"tags"`
+	ModificationTimeSeconds int64    `bson:"modificationTimeSeconds" json:"modificationTimeSeconds"`
+
+	// SeenAt is the time at which the version was first seen.
+	SeenAt time.Time `bson:"seenAt" json:"seenAt"`
+}
+
+// RevisionOfBlog returns the revision of the current version of a blog.
+func RevisionOfBlog(blog BlogEntry, seenAt time.Time) BlogRevision {
+	digest := sha256.Sum256([]byte(fmt.Sprintf("%q\n%q\n%q\n%d", blog.Title,
+		blog.Content, blog.Tags, blog.ModificationTimeSeconds)))
+	return BlogRevision{
+		Id:                      hex.EncodeToString(digest[:8]),
+		BlogId:                  blog.Id,
+		Title:                   blog.Title,
+		Content:                 blog.Content,
+		Tags:                    blog.Tags,
+		ModificationTimeSeconds: blog.ModificationTimeSeconds,
+		SeenAt:                  seenAt,
+	}
 }
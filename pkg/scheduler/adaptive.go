@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"time"
+)
+
+const (
+	// kBusyRatio is the share of new actions in a batch from which the
+	// cooldown shortens.
+	kBusyRatio = 0.5
+
+	// kCooldownFactor is the factor by which the cooldown shortens or
+	// lengthens after every sync.
+	kCooldownFactor = 2
+)
+
+// adaptiveCooldown adapts the cooldown of a scheduler to the activity on
+// Codeforces, within bounds.
+type adaptiveCooldown struct {
+	min time.Duration
+	max time.Duration
+
+	// rate is the rate limit of the Codeforces client, in calls per second.
+	// A non-positive rate means no limit.
+	rate float64
+}
+
+// WithAdaptiveCooldown makes the scheduler shorten its cooldown when a batch
+// is mostly new actions, e.g. during contests, and lengthen it when nothing
+// changed, e.g. at night. The cooldown stays within [min, max], and never
+// gets shorter than the time needed to make the calls of the last sync at the
+// rate limit of the Codeforces client. The cooldown given to the scheduler is
+// the initial one.
+func WithAdaptiveCooldown(min, max time.Duration, rate float64) Option {
+	return func(cfg *config) {
+		cfg.adaptive = &adaptiveCooldown{min: min, max: max, rate: rate}
+	}
+}
+
+// next returns the cooldown following a sync which fetched a batch of actions,
+// of which inserted were new, in the given number of API calls. A gap before
+// the batch means that the scheduler polled too slowly, whatever the share of
+// new actions, e.g. if another replica persisted them first.
+func (adaptive *adaptiveCooldown) next(cooldown time.Duration,
+	fetched, inserted, calls int, gap bool) time.Duration {
+	switch {
+	case gap:
+		cooldown /= kCooldownFactor
+	case inserted == 0:
+		cooldown *= kCooldownFactor
+	case float64(inserted) >= kBusyRatio*float64(fetched):
+		cooldown /= kCooldownFactor
+	}
+
+	if cooldown > adaptive.max {
+		cooldown = adaptive.max
+	}
+	if cooldown < adaptive.min {
+		cooldown = adaptive.min
+	}
+
+	// Polling faster would only queue the calls up behind the rate limiter.
+	if adaptive.rate > 0 {
+		floor := time.Duration(float64(calls) / adaptive.rate *
+			float64(time.Second))
+		if cooldown < floor {
+			cooldown = floor
+		}
+	}
+	return cooldown
+}
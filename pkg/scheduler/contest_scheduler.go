@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/store"
+)
+
+// ContestScheduler is the scheduler that persists the list of contests to
+// Codeforces store periodically.
+type ContestScheduler struct {
+	config
+	mutex    sync.Mutex
+	cfClient cfapi.CodeforcesAPI
+	cfStore  store.CodeforcesStore
+	cooldown time.Duration
+}
+
+func (sch *ContestScheduler) Sync(ctx context.Context) error {
+	sch.mutex.Lock()
+	defer sch.mutex.Unlock()
+
+	// Gym contests are not part of the calendar.
+	contests, err := sch.cfClient.ContestList(ctx, false)
+	if err != nil {
+		return errors.Errorf("codeforces query failed with error [%v]", err)
+	}
+
+	err = sch.write(ctx, func(ctx context.Context) error {
+		err := sch.cfStore.AddContests(ctx, contests)
+		if err != nil {
+			return errors.Errorf("contest insertion failed with error [%v]",
+				err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	zap.S().Infof("Persisted %d contests", len(contests))
+
+	return nil
+}
+
+func (sch *ContestScheduler) Start(ctx context.Context) {
+	for ctx.Err() == nil {
+		if sch.isLeader() {
+			syncCtx, cancel := sch.syncContext(ctx)
+			err := sch.Sync(syncCtx)
+			cancel()
+			if err != nil {
+				zap.S().Errorf("Failed to sync contests with codeforces "+
+					"with error [%+v]", err)
+			}
+		} else {
+			zap.S().Info("Another replica is the leader, skipping the " +
+				"contest sync")
+		}
+		zap.S().Infof("Sleeping for %v", sch.cooldown)
+		sleep(ctx, sch.cooldown)
+	}
+	zap.S().Info("Stopped the contest scheduler")
+}
+
+// NewContestScheduler creates a new instance of the contest scheduler.
+func NewContestScheduler(cfClient cfapi.CodeforcesAPI,
+	cfStore store.CodeforcesStore,
+	coolDown time.Duration, opts ...Option) CodeforcesSchedulerInterface {
+	sch := new(ContestScheduler)
+	sch.config = newConfig(opts)
+	sch.cfClient = cfClient
+	sch.cfStore = cfStore
+	sch.cooldown = coolDown
+
+	return sch
+}
@@ -0,0 +1,258 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/leader"
+)
+
+const (
+	// MaxBatchSize is the largest maxCount accepted by recentActions.
+	MaxBatchSize = 100
+)
+
+// ErrStopped is returned by Trigger once the loop of the scheduler stopped.
+var ErrStopped = errors.New("the scheduler is stopped")
+
+// ControllableSchedulerInterface is a scheduler whose loop can be driven while
+// it runs, e.g. from the admin routes. The controls only apply to the replica
+// they are called on, and to the recent actions: the contest scheduler keeps
+// running.
+type ControllableSchedulerInterface interface {
+	CodeforcesSchedulerInterface
+
+	// Trigger syncs right away and restarts the cooldown. The sync does not
+	// derive from ctx, so that it is not cancelled with the request which
+	// triggered it, but from the context of Start, which waits for it before
+	// returning. It returns leader.ErrNotLeader if another replica runs the
+	// schedulers, and ErrStopped once the context of Start is done.
+	Trigger(ctx context.Context) error
+
+	// Pause stops the loop from syncing the recent actions until Resume is
+	// called. A sync in progress is not interrupted, and the contests are
+	// still synced.
+	Pause()
+
+	// Resume lets the loop sync again, right away if the cooldown elapsed
+	// while it was paused.
+	Resume()
+
+	// SetBatchSize changes the number of actions fetched by the next syncs.
+	SetBatchSize(batchSize int) error
+
+	// SetCooldown changes the duration between two syncs. With an adaptive
+	// cooldown, the next syncs adapt it from the new value.
+	SetCooldown(cooldown time.Duration) error
+
+	// State returns a snapshot of the state of the scheduler.
+	State() State
+}
+
+// State is a snapshot of the state of a controllable scheduler.
+type State struct {
+	Paused bool `json:"paused"`
+
+	// Syncing is true while a sync is in progress.
+	Syncing bool `json:"syncing"`
+
+	// Leader is false if another replica runs the schedulers, in which case
+	// the loop skips the syncs.
+	Leader bool `json:"leader"`
+
+	BatchSize             int     `json:"batchSize"`
+	CooldownSeconds       float64 `json:"cooldownSeconds"`
+	LastInsertedTimestamp int64   `json:"lastInsertedTimestamp"`
+
+	// LastAttempt is the time at which the last sync ended or was skipped,
+	// and NextAttempt the time at which the loop wakes up for the next one.
+	// Both are nil before the first sync.
+	LastAttempt *time.Time `json:"lastAttempt"`
+	NextAttempt *time.Time `json:"nextAttempt"`
+}
+
+func (sch *CodeforcesScheduler) Trigger(ctx context.Context) error {
+	if !sch.isLeader() {
+		return leader.ErrNotLeader
+	}
+
+	lifecycle, err := sch.beginTrigger()
+	if err != nil {
+		return err
+	}
+	defer sch.triggered.Done()
+
+	zap.S().Info("Triggering a sync")
+	syncCtx, cancel := sch.syncContext(lifecycle)
+	defer cancel()
+	err = sch.Sync(syncCtx)
+	sch.markAttempt()
+	return err
+}
+
+// beginTrigger registers a sync on demand, which Start waits for, and returns
+// the context it derives from.
+func (sch *CodeforcesScheduler) beginTrigger() (context.Context, error) {
+	sch.stateMutex.Lock()
+	defer sch.stateMutex.Unlock()
+
+	if sch.stopped || sch.lifecycle.Err() != nil {
+		return nil, ErrStopped
+	}
+	sch.triggered.Add(1)
+	return sch.lifecycle, nil
+}
+
+// startLifecycle makes the syncs on demand derive from the context of Start.
+func (sch *CodeforcesScheduler) startLifecycle(ctx context.Context) {
+	sch.stateMutex.Lock()
+	defer sch.stateMutex.Unlock()
+
+	sch.lifecycle = ctx
+	sch.stopped = false
+}
+
+// stopLifecycle refuses the next syncs on demand, and waits for the ones in
+// progress. A Trigger which got past beginTrigger registered its sync before
+// stopped is set, so the wait cannot miss it.
+func (sch *CodeforcesScheduler) stopLifecycle() {
+	sch.stateMutex.Lock()
+	sch.stopped = true
+	sch.stateMutex.Unlock()
+
+	sch.triggered.Wait()
+}
+
+func (sch *CodeforcesScheduler) Pause() {
+	sch.stateMutex.Lock()
+	defer sch.stateMutex.Unlock()
+
+	zap.S().Info("Pausing the scheduler")
+	sch.paused = true
+	sch.notify()
+}
+
+func (sch *CodeforcesScheduler) Resume() {
+	sch.stateMutex.Lock()
+	defer sch.stateMutex.Unlock()
+
+	zap.S().Info("Resuming the scheduler")
+	sch.paused = false
+	sch.notify()
+}
+
+func (sch *CodeforcesScheduler) SetBatchSize(batchSize int) error {
+	if batchSize <= 0 || batchSize > MaxBatchSize {
+		return errors.Errorf("batch size must be between 1 and %d, got %d",
+			MaxBatchSize, batchSize)
+	}
+
+	sch.stateMutex.Lock()
+	defer sch.stateMutex.Unlock()
+
+	zap.S().Infof("Changing the batch size from %d to %d", sch.batchSize,
+		batchSize)
+	sch.batchSize = batchSize
+	return nil
+}
+
+func (sch *CodeforcesScheduler) SetCooldown(cooldown time.Duration) error {
+	if cooldown <= 0 {
+		return errors.Errorf("cooldown must be positive, got %v", cooldown)
+	}
+
+	sch.stateMutex.Lock()
+	defer sch.stateMutex.Unlock()
+
+	sch.setCooldown(cooldown)
+	sch.notify()
+	return nil
+}
+
+func (sch *CodeforcesScheduler) State() State {
+	// The elector has its own lock, so it is queried outside of ours.
+	isLeader := sch.isLeader()
+
+	sch.stateMutex.Lock()
+	defer sch.stateMutex.Unlock()
+
+	state := State{
+		Paused:                sch.paused,
+		Syncing:               sch.syncing,
+		Leader:                isLeader,
+		BatchSize:             sch.batchSize,
+		CooldownSeconds:       sch.cooldown.Seconds(),
+		LastInsertedTimestamp: sch.lastInsertedTimestamp,
+	}
+	if !sch.lastAttempt.IsZero() {
+		lastAttempt := sch.lastAttempt
+		nextAttempt := lastAttempt.Add(sch.cooldown)
+		state.LastAttempt = &lastAttempt
+		state.NextAttempt = &nextAttempt
+	}
+	return state
+}
+
+// setSyncing records whether a sync is in progress.
+func (sch *CodeforcesScheduler) setSyncing(syncing bool) {
+	sch.stateMutex.Lock()
+	defer sch.stateMutex.Unlock()
+
+	sch.syncing = syncing
+}
+
+// markAttempt restarts the cooldown.
+func (sch *CodeforcesScheduler) markAttempt() {
+	sch.stateMutex.Lock()
+	defer sch.stateMutex.Unlock()
+
+	sch.lastAttempt = time.Now().UTC()
+}
+
+// untilNextSync returns the time left before the loop should sync, and
+// whether it is paused.
+func (sch *CodeforcesScheduler) untilNextSync() (time.Duration, bool) {
+	sch.stateMutex.Lock()
+	defer sch.stateMutex.Unlock()
+
+	if sch.paused {
+		return 0, true
+	}
+	if sch.lastAttempt.IsZero() {
+		return 0, false
+	}
+	return time.Until(sch.lastAttempt.Add(sch.cooldown)), false
+}
+
+// notify wakes the loop up, so that it takes a change of the state into
+// account. It never blocks.
+func (sch *CodeforcesScheduler) notify() {
+	select {
+	case sch.wake <- struct{}{}:
+	default:
+	}
+}
+
+// idle waits for the given duration, or until the loop is woken up or the
+// context is done. A paused scheduler waits without a deadline.
+func (sch *CodeforcesScheduler) idle(ctx context.Context, wait time.Duration,
+	paused bool) {
+	var timeout <-chan time.Time
+	if paused {
+		zap.S().Info("The scheduler is paused")
+	} else {
+		zap.S().Infof("Sleeping for %v", wait)
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-timeout:
+	case <-sch.wake:
+	case <-ctx.Done():
+	}
+}
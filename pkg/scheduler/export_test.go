@@ -0,0 +1,9 @@
+package scheduler
+
+import "time"
+
+// Cooldown returns the current cooldown of a scheduler created by
+// NewScheduler.
+func Cooldown(sch CodeforcesSchedulerInterface) time.Duration {
+	return sch.(*CodeforcesScheduler).currentCooldown()
+}
@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/leader"
+)
+
+const (
+	kDefaultSyncTimeout = 5 * time.Minute
+
+	// kWriteTimeout is the deadline of a single write to the store, which
+	// outlives the context of the sync, see writeContext.
+	kWriteTimeout = 10 * time.Second
+)
+
+// config holds the settings shared by all the schedulers.
+type config struct {
+	// syncTimeout is the deadline of a single Sync, including retries.
+	syncTimeout time.Duration
+
+	// elector, if set, only lets the replica holding the lease sync.
+	elector *leader.Elector
+
+	// adaptive, if set, adapts the cooldown after every sync.
+	adaptive *adaptiveCooldown
+}
+
+// Option customizes a scheduler.
+type Option func(*config)
+
+// WithSyncTimeout sets the deadline of a single Sync. A non-positive timeout
+// disables the deadline.
+func WithSyncTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.syncTimeout = timeout
+	}
+}
+
+// WithElector makes the scheduler sync only while the replica holds the
+// lease of the elector, which must be campaigning, see leader.Elector.Run.
+func WithElector(elector *leader.Elector) Option {
+	return func(cfg *config) {
+		cfg.elector = elector
+	}
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		syncTimeout: kDefaultSyncTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// syncContext derives the context of a single Sync.
+func (cfg config) syncContext(parent context.Context) (context.Context,
+	context.CancelFunc) {
+	if cfg.syncTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, cfg.syncTimeout)
+}
+
+// write fences and runs a write to the store. Another replica may have taken
+// over during the calls to Codeforces which preceded the write, so every write
+// is fenced on its own.
+//
+// The write has a context of its own, so that a sync cancelled after a fetch,
+// e.g. on shutdown, still persists what it fetched. The context keeps the
+// values of the context of the sync, but only has a short deadline of its own.
+func (cfg config) write(ctx context.Context,
+	run func(ctx context.Context) error) error {
+	writeCtx, cancel := context.WithTimeout(detachedContext{parent: ctx},
+		kWriteTimeout)
+	defer cancel()
+
+	if err := cfg.fence(writeCtx); err != nil {
+		return errors.Errorf("fencing failed with error [%v]", err)
+	}
+	return run(writeCtx)
+}
+
+// detachedContext carries the values of its parent, but is never done. It
+// stands in for context.WithoutCancel, which needs a newer Go.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (ctx detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (ctx detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (ctx detachedContext) Err() error {
+	return nil
+}
+
+func (ctx detachedContext) Value(key interface{}) interface{} {
+	return ctx.parent.Value(key)
+}
+
+// isLeader reports whether the replica may sync.
+func (cfg config) isLeader() bool {
+	return cfg.elector == nil || cfg.elector.IsLeader()
+}
+
+// fence checks that the replica still holds the lease before it writes to
+// the store.
+func (cfg config) fence(ctx context.Context) error {
+	if cfg.elector == nil {
+		return nil
+	}
+	return cfg.elector.Fence(ctx)
+}
+
+// sleep waits for the duration, or until the context is done.
+func sleep(ctx context.Context, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -1,6 +1,8 @@
 package scheduler
 
 import (
+	"context"
+	"strings"
 	"sync"
 	"time"
 
@@ -8,90 +10,580 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/metrics"
 	"github.com/variety-jones/cfrss/pkg/models"
 	"github.com/variety-jones/cfrss/pkg/store"
 )
 
+const (
+	// kProfileTTL is the duration after which a cached profile is fetched
+	// again from Codeforces.
+	kProfileTTL = 24 * time.Hour
+
+	kCooldownMetric = "scheduler.cooldownSeconds"
+)
+
+// RecentActionsCheckpoint is the name of the checkpoint of the recent actions
+// scheduler.
+const RecentActionsCheckpoint = "recentActions"
+
 type CodeforcesSchedulerInterface interface {
 	// Sync makes a single API call to Codeforces and stores the result in store.
-	Sync() error
+	Sync(ctx context.Context) error
 
-	// Start runs Sync in an infinite loop with a cooldown period.
-	Start()
+	// Start runs Sync in a loop with a cooldown period, until the context is
+	// done. The calls to Codeforces of a Sync in progress are cancelled, but
+	// the writes of what was already fetched get a short deadline of their
+	// own. Start returns once the Sync ends, along with the syncs on demand of
+	// a controllable scheduler.
+	Start(ctx context.Context)
 }
 
 // CodeforcesScheduler is the scheduler that persists recent actions data to
 // Codeforces store periodically.
 type CodeforcesScheduler struct {
-	mutex                 sync.Mutex
-	cfClient              cfapi.CodeforcesAPI
-	cfStore               store.CodeforcesStore
+	config
+	cfClient cfapi.CodeforcesAPI
+	cfStore  store.CodeforcesStore
+
+	// mutex serializes the syncs.
+	mutex sync.Mutex
+
+	// stateMutex guards the fields below, so that the state can be read and
+	// changed while a sync is in progress.
+	stateMutex            sync.Mutex
 	cooldown              time.Duration
-	lastInsertedTimestamp int64
 	batchSize             int
+	lastInsertedTimestamp int64
+	paused                bool
+	syncing               bool
+	lastAttempt           time.Time
+
+	// lifecycle is the context of Start, from which the syncs on demand
+	// derive, and stopped is set once its loop ended.
+	lifecycle context.Context
+	stopped   bool
+
+	// triggered tracks the syncs on demand, which Start waits for.
+	triggered sync.WaitGroup
+
+	// wake interrupts the cooldown of the loop when the state changes.
+	wake chan struct{}
+}
+
+// latestTimestamp returns the latest activity time among the actions, or the
+// given timestamp if it is later.
+func latestTimestamp(actions []models.RecentAction, since int64) int64 {
+	res := since
+	for _, action := range actions {
+		if action.TimeSeconds > res {
+			res = action.TimeSeconds
+		}
+	}
+	return res
+}
+
+// hasGap reports whether some actions may have happened between the last
+// persisted one and the oldest one in the batch. recentActions only returns
+// the last batchSize actions, so the older ones are lost if the batch is
+// entirely newer than what was persisted.
+func hasGap(actions []models.RecentAction, since int64) bool {
+	if since == 0 || len(actions) == 0 {
+		return false
+	}
+	for _, action := range actions {
+		if action.TimeSeconds <= since {
+			return false
+		}
+	}
+	return true
+}
+
+// oldestTimestamp returns the earliest activity time among the actions.
+func oldestTimestamp(actions []models.RecentAction) int64 {
+	var res int64
+	for ind, action := range actions {
+		if ind == 0 || action.TimeSeconds < res {
+			res = action.TimeSeconds
+		}
+	}
+	return res
 }
 
-// filter scans the list of recent actions and removes the one that are stale,
-// i,e, the ones that are already in the store.
-func (sch *CodeforcesScheduler) filter(actions []models.RecentAction) (
-	[]models.RecentAction, int64) {
-	maxTimestampAfterInsertion := sch.lastInsertedTimestamp
-	var newActions []models.RecentAction
+// latestBlogs returns the ids of the blogs seen in the batch in order of
+// appearance, along with the latest version of every blog.
+func latestBlogs(actions []models.RecentAction) ([]int,
+	map[int]*models.BlogEntry) {
+	var blogIds []int
+	blogs := make(map[int]*models.BlogEntry)
 	for _, action := range actions {
-		now := action.TimeSeconds
-		if now > maxTimestampAfterInsertion {
-			maxTimestampAfterInsertion = now
+		if action.BlogEntry == nil {
+			continue
+		}
+		blog, ok := blogs[action.BlogEntry.Id]
+		if !ok {
+			blogIds = append(blogIds, action.BlogEntry.Id)
+		}
+		if !ok || blog.ModificationTimeSeconds <
+			action.BlogEntry.ModificationTimeSeconds {
+			blogs[action.BlogEntry.Id] = action.BlogEntry
+		}
+	}
+	return blogIds, blogs
+}
+
+// backfill fetches the complete comment thread of every blog seen in the
+// batch, and persists the comments made after the given timestamp.
+func (sch *CodeforcesScheduler) backfill(ctx context.Context,
+	actions []models.RecentAction, since int64) []models.BackfillOutcome {
+	blogIds, blogs := latestBlogs(actions)
+
+	var outcomes []models.BackfillOutcome
+	for _, id := range blogIds {
+		outcome := models.BackfillOutcome{BlogId: id}
+
+		comments, err := sch.cfClient.BlogEntryComments(ctx, id)
+		if err != nil {
+			outcome.Error = err.Error()
+			outcomes = append(outcomes, outcome)
+			continue
 		}
-		if now > sch.lastInsertedTimestamp {
-			newActions = append(newActions, action)
+		outcome.Fetched = len(comments)
+
+		var missed []models.RecentAction
+		for ind := range comments {
+			if comments[ind].CreationTimeSeconds < since {
+				continue
+			}
+			missed = append(missed, models.RecentAction{
+				TimeSeconds: comments[ind].CreationTimeSeconds,
+				BlogEntry:   blogs[id],
+				Comment:     &comments[ind],
+			})
+		}
+
+		var inserted int
+		err = sch.write(ctx, func(ctx context.Context) (err error) {
+			inserted, err = sch.cfStore.AddRecentActions(ctx, missed)
+			return err
+		})
+		if err != nil {
+			outcome.Error = err.Error()
 		}
+		outcome.Inserted = inserted
+		outcomes = append(outcomes, outcome)
 	}
-	return newActions, maxTimestampAfterInsertion
+	return outcomes
 }
 
-func (sch *CodeforcesScheduler) Sync() error {
+// recordRevisions records the version of every blog seen in the batch. The
+// recent actions only carry the short version of a blog, without its content,
+// in which case the blog is fetched from blogEntry.view if it was modified
+// since its latest revision. It returns the number of blogs fetched.
+func (sch *CodeforcesScheduler) recordRevisions(ctx context.Context,
+	actions []models.RecentAction) int {
+	blogIds, blogs := latestBlogs(actions)
+
+	fetched := 0
+	now := time.Now().UTC()
+	for _, id := range blogIds {
+		blog := blogs[id]
+		if blog.Content == "" {
+			revisions, err := sch.cfStore.QueryBlogRevisions(ctx, id)
+			if err != nil {
+				zap.S().Errorf("Could not query the revisions of blog %d "+
+					"with error [%v]", id, err)
+				continue
+			}
+			if last := len(revisions) - 1; last >= 0 &&
+				revisions[last].ModificationTimeSeconds >=
+					blog.ModificationTimeSeconds {
+				continue
+			}
+
+			fetched++
+			if blog, err = sch.cfClient.BlogEntryView(ctx, id); err != nil {
+				zap.S().Errorf("Could not fetch blog %d with error [%v]", id,
+					err)
+				continue
+			}
+		}
+
+		revision := models.RevisionOfBlog(*blog, now)
+		var inserted bool
+		err := sch.write(ctx, func(ctx context.Context) (err error) {
+			inserted, err = sch.cfStore.AddBlogRevision(ctx, &revision)
+			return err
+		})
+		if err != nil {
+			zap.S().Errorf("Could not record the revision of blog %d "+
+				"with error [%v]", id, err)
+			continue
+		}
+		if inserted {
+			zap.S().Infof("Recorded revision %s of blog %d", revision.Id, id)
+		}
+	}
+	return fetched
+}
+
+// refreshProfiles caches the profiles of the authors and commentators in the
+// batch, unless they were fetched recently. It returns the number of calls made
+// to Codeforces.
+func (sch *CodeforcesScheduler) refreshProfiles(ctx context.Context,
+	actions []models.RecentAction) (int, error) {
+	var handles []string
+	seen := make(map[string]bool)
+	addHandle := func(handle string) {
+		if handle != "" && !seen[handle] {
+			seen[handle] = true
+			handles = append(handles, handle)
+		}
+	}
+	for _, action := range actions {
+		if action.BlogEntry != nil {
+			addHandle(action.BlogEntry.AuthorHandle)
+		}
+		if action.Comment != nil {
+			addHandle(action.Comment.CommentatorHandle)
+		}
+	}
+
+	cached, err := sch.cfStore.QueryProfiles(ctx, handles...)
+	if err != nil {
+		return 0, errors.Errorf("could not query cached profiles "+
+			"with error [%v]", err)
+	}
+	now := time.Now().UTC()
+	fresh := make(map[string]bool)
+	for _, profile := range cached {
+		if now.Sub(profile.FetchedAt) < kProfileTTL {
+			fresh[profile.Handle] = true
+		}
+	}
+
+	var stale []string
+	for _, handle := range handles {
+		if !fresh[handle] {
+			stale = append(stale, handle)
+		}
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	// Codeforces fails the whole call if a single handle does not exist, in
+	// which case the handle is cached as missing and the others are queried
+	// again.
+	var profiles, missing []models.CodeforcesUser
+	calls := 0
+	for len(stale) > 0 {
+		calls++
+		profiles, err = sch.cfClient.UserInfo(ctx, stale...)
+		handle, ok := cfapi.MissingHandle(err)
+		if !ok {
+			break
+		}
+		remaining := withoutHandle(stale, handle)
+		if len(remaining) == len(stale) {
+			break
+		}
+		zap.S().Warnf("Codeforces does not know handle %s, skipping it",
+			handle)
+		missing = append(missing, models.CodeforcesUser{
+			Handle:  handle,
+			Missing: true,
+		})
+		stale, err = remaining, nil
+	}
+	if err != nil {
+		return calls, errors.Errorf("codeforces profile query failed "+
+			"with error [%v]", err)
+	}
+
+	profiles = append(profiles, missing...)
+	for ind := range profiles {
+		profiles[ind].FetchedAt = now
+	}
+	err = sch.write(ctx, func(ctx context.Context) error {
+		return sch.cfStore.AddProfiles(ctx, profiles)
+	})
+	if err != nil {
+		return calls, errors.Errorf("could not cache profiles "+
+			"with error [%v]", err)
+	}
+
+	zap.S().Infof("Refreshed %d profiles, of which %d are missing",
+		len(profiles), len(missing))
+	return calls, nil
+}
+
+// withoutHandle returns the handles other than the given one. Codeforces
+// handles are case insensitive.
+func withoutHandle(handles []string, handle string) []string {
+	var res []string
+	for _, other := range handles {
+		if !strings.EqualFold(other, handle) {
+			res = append(res, other)
+		}
+	}
+	return res
+}
+
+func (sch *CodeforcesScheduler) Sync(ctx context.Context) error {
 	sch.mutex.Lock()
 	defer sch.mutex.Unlock()
 
-	actions, err := sch.cfClient.RecentActions(sch.batchSize)
+	sch.setSyncing(true)
+	defer sch.setSyncing(false)
+
+	run := &models.SchedulerRun{StartedAt: time.Now().UTC()}
+	if sch.elector != nil {
+		run.Replica = sch.elector.Holder()
+	}
+	err := sch.sync(ctx, run)
+	run.EndedAt = time.Now().UTC()
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	// The history is only used for diagnosis, so a failure to record the run
+	// does not fail the sync. A replica which lost the lease does not record
+	// it either.
+	recordErr := sch.write(ctx, func(ctx context.Context) error {
+		return sch.cfStore.AddSchedulerRun(ctx, run)
+	})
+	if recordErr != nil {
+		zap.S().Errorf("Failed to record the run with error [%v]", recordErr)
+	}
+	return err
+}
+
+// sync fetches and persists the recent actions, and fills in the counts of
+// the run. The mutex must be held.
+func (sch *CodeforcesScheduler) sync(ctx context.Context,
+	run *models.SchedulerRun) error {
+	actions, err := sch.cfClient.RecentActions(ctx, sch.currentBatchSize())
 	if err != nil {
 		return errors.Errorf("codeforces query failed with error [%v]", err)
 	}
+	calls := 1
+	run.Fetched = len(actions)
+
+	sch.refreshCheckpoint(ctx)
+
+	// Detect the gap before persisting, since the comparison is against the
+	// state prior to this batch.
+	gapDetected := hasGap(actions, sch.lastInsertedTimestamp)
 
-	newActions, maxTimestampAfterInsertion := sch.filter(actions)
-	if err := sch.cfStore.AddRecentActions(newActions); err != nil {
-		return errors.Errorf("mongo insertion failed with error [%v]", err)
+	// The store skips the actions that it already has, so the whole batch
+	// is handed over. Filtering by timestamp would lose the actions that
+	// share a second with the last persisted one.
+	var inserted int
+	err = sch.write(ctx, func(ctx context.Context) (err error) {
+		inserted, err = sch.cfStore.AddRecentActions(ctx, actions)
+		if err != nil {
+			return errors.Errorf("mongo insertion failed with error [%v]",
+				err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	run.New = inserted
+	run.Duplicates = len(actions) - inserted
+
+	if gapDetected {
+		gap := &models.SyncGap{
+			StartTimestamp: sch.lastInsertedTimestamp,
+			EndTimestamp:   oldestTimestamp(actions),
+			DetectedAt:     time.Now().UTC(),
+		}
+		zap.S().Warnf("Detected a gap between timestamps %d and %d, "+
+			"backfilling", gap.StartTimestamp, gap.EndTimestamp)
+
+		gap.Backfills = sch.backfill(ctx, actions, sch.lastInsertedTimestamp)
+		calls += len(gap.Backfills)
+		for _, outcome := range gap.Backfills {
+			if outcome.Error != "" {
+				zap.S().Errorf("Backfill of blog %d failed with error [%s]",
+					outcome.BlogId, outcome.Error)
+				continue
+			}
+			zap.S().Infof("Backfilled blog %d with %d new of %d fetched "+
+				"comments", outcome.BlogId, outcome.Inserted, outcome.Fetched)
+		}
+
+		err := sch.write(ctx, func(ctx context.Context) error {
+			return sch.cfStore.AddSyncGap(ctx, gap)
+		})
+		if err != nil {
+			zap.S().Errorf("Failed to record the gap with error [%v]", err)
+		}
+	}
+
+	// Profiles are only used to decorate the actions, so a failure to
+	// refresh them does not fail the sync.
+	profileCalls, err := sch.refreshProfiles(ctx, actions)
+	if err != nil {
+		zap.S().Errorf("Failed to refresh profiles with error [%v]", err)
+	}
+	calls += profileCalls
+
+	// The revisions are only a history, so a failure to record them does not
+	// fail the sync either.
+	calls += sch.recordRevisions(ctx, actions)
 
 	// Do an atomic swap only when insertion is successful.
-	sch.lastInsertedTimestamp = maxTimestampAfterInsertion
-	zap.S().Infof("Persisted activities till timestamp: %d",
+	lastInsertedTimestamp := latestTimestamp(actions,
 		sch.lastInsertedTimestamp)
+	if lastInsertedTimestamp != sch.lastInsertedTimestamp {
+		sch.stateMutex.Lock()
+		sch.lastInsertedTimestamp = lastInsertedTimestamp
+		sch.stateMutex.Unlock()
+		sch.saveCheckpoint(ctx)
+	}
+	zap.S().Infof("Persisted %d new activities till timestamp: %d",
+		inserted, sch.lastInsertedTimestamp)
+
+	if sch.adaptive != nil {
+		sch.stateMutex.Lock()
+		sch.setCooldown(sch.adaptive.next(sch.cooldown, len(actions), inserted,
+			calls, gapDetected))
+		sch.stateMutex.Unlock()
+	}
 
 	return nil
 }
 
-func (sch *CodeforcesScheduler) Start() {
-	for {
-		if err := sch.Sync(); err != nil {
-			zap.S().Errorf("Failed to sync with codeforces with error [%+v]",
-				err)
+// refreshCheckpoint catches up with the checkpoint saved by the replicas
+// which held the lease since this one last synced, so that what they
+// persisted is not mistaken for a gap. The mutex must be held.
+func (sch *CodeforcesScheduler) refreshCheckpoint(ctx context.Context) {
+	if sch.elector == nil {
+		return
+	}
+	checkpoint, err := sch.cfStore.QueryCheckpoint(ctx,
+		RecentActionsCheckpoint)
+	if err != nil {
+		zap.S().Errorf("Failed to refresh the checkpoint with error [%v]",
+			err)
+		return
+	}
+	if checkpoint == nil || checkpoint.Timestamp <= sch.lastInsertedTimestamp {
+		return
+	}
+
+	zap.S().Infof("Catching up with the checkpoint at timestamp: %d",
+		checkpoint.Timestamp)
+	sch.stateMutex.Lock()
+	sch.lastInsertedTimestamp = checkpoint.Timestamp
+	sch.stateMutex.Unlock()
+}
+
+// saveCheckpoint persists the last inserted timestamp. The checkpoint only
+// spares the startup aggregation, so a failure to save it is logged.
+func (sch *CodeforcesScheduler) saveCheckpoint(ctx context.Context) {
+	checkpoint := &models.Checkpoint{
+		Name:      RecentActionsCheckpoint,
+		Timestamp: sch.lastInsertedTimestamp,
+		UpdatedAt: time.Now().UTC(),
+	}
+	err := sch.write(ctx, func(ctx context.Context) error {
+		return sch.cfStore.SaveCheckpoint(ctx, checkpoint)
+	})
+	if err != nil {
+		zap.S().Errorf("Failed to save the checkpoint with error [%v]", err)
+	}
+}
+
+// setCooldown changes the cooldown, and reports it in the metrics. The
+// stateMutex must be held.
+func (sch *CodeforcesScheduler) setCooldown(cooldown time.Duration) {
+	if cooldown != sch.cooldown {
+		zap.S().Infof("Changing the cooldown from %v to %v", sch.cooldown,
+			cooldown)
+	}
+	sch.cooldown = cooldown
+	metrics.SetFloat(kCooldownMetric, cooldown.Seconds())
+}
+
+// currentCooldown returns the cooldown to wait for before the next sync.
+func (sch *CodeforcesScheduler) currentCooldown() time.Duration {
+	sch.stateMutex.Lock()
+	defer sch.stateMutex.Unlock()
+
+	return sch.cooldown
+}
+
+// currentBatchSize returns the number of actions to fetch in the next sync.
+func (sch *CodeforcesScheduler) currentBatchSize() int {
+	sch.stateMutex.Lock()
+	defer sch.stateMutex.Unlock()
+
+	return sch.batchSize
+}
+
+func (sch *CodeforcesScheduler) Start(ctx context.Context) {
+	sch.startLifecycle(ctx)
+	for ctx.Err() == nil {
+		if wait, paused := sch.untilNextSync(); paused || wait > 0 {
+			sch.idle(ctx, wait, paused)
+			continue
 		}
-		zap.S().Infof("Sleeping for %v", sch.cooldown)
-		time.Sleep(sch.cooldown)
+
+		if sch.isLeader() {
+			// Stopping the scheduler cancels the calls to Codeforces, but
+			// the writes of the sync have a context of their own.
+			syncCtx, cancel := sch.syncContext(ctx)
+			err := sch.Sync(syncCtx)
+			cancel()
+			if err != nil {
+				zap.S().Errorf("Failed to sync with codeforces "+
+					"with error [%+v]", err)
+			}
+		} else {
+			zap.S().Info("Another replica is the leader, skipping the sync")
+		}
+		sch.markAttempt()
 	}
+	sch.stopLifecycle()
+	zap.S().Info("Stopped the scheduler")
 }
 
 // NewScheduler creates a new instance of the scheduler.
 func NewScheduler(cfClient cfapi.CodeforcesAPI,
 	cfStore store.CodeforcesStore, batchSize int,
-	coolDown time.Duration) CodeforcesSchedulerInterface {
+	coolDown time.Duration, opts ...Option) ControllableSchedulerInterface {
 	sch := new(CodeforcesScheduler)
+	sch.config = newConfig(opts)
 	sch.cfClient = cfClient
 	sch.cfStore = cfStore
-	sch.cooldown = coolDown
+	sch.setCooldown(coolDown)
 	sch.batchSize = batchSize
-	sch.lastInsertedTimestamp = cfStore.LastRecordedTimestampForRecentActions()
+	sch.wake = make(chan struct{}, 1)
+	sch.lifecycle = context.Background()
+
+	ctx, cancel := sch.syncContext(context.Background())
+	defer cancel()
+	sch.lastInsertedTimestamp = sch.loadCheckpoint(ctx)
 
 	return sch
 }
+
+// loadCheckpoint returns the last inserted timestamp from the checkpoint, and
+// falls back to scanning the recent actions if there is none.
+func (sch *CodeforcesScheduler) loadCheckpoint(ctx context.Context) int64 {
+	checkpoint, err := sch.cfStore.QueryCheckpoint(ctx,
+		RecentActionsCheckpoint)
+	if err != nil {
+		zap.S().Errorf("Failed to load the checkpoint with error [%v]", err)
+	}
+	if checkpoint != nil {
+		zap.S().Infof("Resuming from the checkpoint at timestamp: %d",
+			checkpoint.Timestamp)
+		return checkpoint.Timestamp
+	}
+	return sch.cfStore.LastRecordedTimestampForRecentActions(ctx)
+}
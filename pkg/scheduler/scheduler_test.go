@@ -0,0 +1,778 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/cfapi/cftest"
+	"github.com/variety-jones/cfrss/pkg/leader"
+	"github.com/variety-jones/cfrss/pkg/metrics"
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/scheduler"
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/storetest"
+)
+
+// fakeCodeforcesClient serves scripted batches of recent actions, and the
+// full version and comments of every blog.
+type fakeCodeforcesClient struct {
+	cfapi.CodeforcesAPI
+
+	batches  [][]models.RecentAction
+	blogs    map[int]models.BlogEntry
+	comments map[int][]models.Comment
+	failures map[int]bool
+
+	// maxCounts records the maxCount of every RecentActions call.
+	maxCounts []int
+
+	// queriedHandles records the handles passed to every UserInfo call.
+	queriedHandles [][]string
+
+	// queryingHandles, if set, is called by every UserInfo call.
+	queryingHandles func()
+
+	// missingHandles fail the UserInfo calls which ask for them.
+	missingHandles map[string]bool
+
+	contests []models.Contest
+
+	// gate, if set, holds every RecentActions call until it is closed or the
+	// context is done. started is signalled when a call begins.
+	gate    chan struct{}
+	started chan struct{}
+
+	// fetched, if set, is called before a RecentActions call returns.
+	fetched func()
+}
+
+func (client *fakeCodeforcesClient) RecentActions(ctx context.Context,
+	maxCount int) ([]models.RecentAction, error) {
+	if client.gate != nil {
+		client.started <- struct{}{}
+		select {
+		case <-client.gate:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	client.maxCounts = append(client.maxCounts, maxCount)
+	batch := client.batches[0]
+	client.batches = client.batches[1:]
+	if client.fetched != nil {
+		client.fetched()
+	}
+	return batch, nil
+}
+
+func (client *fakeCodeforcesClient) BlogEntryView(ctx context.Context,
+	blogEntryId int) (*models.BlogEntry, error) {
+	blog, ok := client.blogs[blogEntryId]
+	if !ok {
+		return nil, errors.New("fake-not-found")
+	}
+	return &blog, nil
+}
+
+func (client *fakeCodeforcesClient) BlogEntryComments(ctx context.Context,
+	blogEntryId int) ([]models.Comment, error) {
+	if client.failures[blogEntryId] {
+		return nil, errors.New("fake-failure")
+	}
+	return client.comments[blogEntryId], nil
+}
+
+func (client *fakeCodeforcesClient) UserInfo(ctx context.Context,
+	handles ...string) ([]models.CodeforcesUser, error) {
+	client.queriedHandles = append(client.queriedHandles, handles)
+	if client.queryingHandles != nil {
+		client.queryingHandles()
+	}
+
+	var res []models.CodeforcesUser
+	for _, handle := range handles {
+		if client.missingHandles[handle] {
+			return nil, &cfapi.FailedStatusError{
+				Endpoint: "/user.info",
+				Comment:  "handles: User with handle " + handle + " not found",
+			}
+		}
+		res = append(res, models.CodeforcesUser{Handle: handle, Rank: "expert"})
+	}
+	return res, nil
+}
+
+func (client *fakeCodeforcesClient) ContestList(ctx context.Context, gym bool) (
+	[]models.Contest, error) {
+	if gym {
+		return nil, errors.New("fake-gym-failure")
+	}
+	return client.contests, nil
+}
+
+// cancellableStore fails the writes made with a done context, as MongoDB
+// does.
+type cancellableStore struct {
+	store.CodeforcesStore
+}
+
+func (cfStore cancellableStore) AddRecentActions(ctx context.Context,
+	actions []models.RecentAction) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cfStore.CodeforcesStore.AddRecentActions(ctx, actions)
+}
+
+func (cfStore cancellableStore) SaveCheckpoint(ctx context.Context,
+	checkpoint *models.Checkpoint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return cfStore.CodeforcesStore.SaveCheckpoint(ctx, checkpoint)
+}
+
+func comments(actions ...models.RecentAction) []models.Comment {
+	var res []models.Comment
+	for _, action := range actions {
+		res = append(res, *action.Comment)
+	}
+	return res
+}
+
+var _ = Describe("Scheduler", func() {
+	ctx := context.Background()
+
+	var cfStore store.CodeforcesStore
+	var cfClient *fakeCodeforcesClient
+
+	BeforeEach(func() {
+		cfStore = store.NewInMemoryCodeforcesStore()
+		cfClient = &fakeCodeforcesClient{
+			blogs:    make(map[int]models.BlogEntry),
+			comments: make(map[int][]models.Comment),
+			failures: make(map[int]bool),
+		}
+	})
+
+	It("should not record a gap when the batches overlap", func() {
+		cfClient.batches = [][]models.RecentAction{
+			{storetest.Comment(1, 2, 20), storetest.Comment(1, 1, 10)},
+			{storetest.Comment(1, 3, 30), storetest.Comment(1, 2, 20)},
+		}
+
+		sch := scheduler.NewScheduler(cfClient, cfStore, 2, 0)
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+
+		gaps, err := cfStore.QuerySyncGaps(ctx, 0)
+		Expect(err).Should(BeNil())
+		Expect(gaps).Should(BeEmpty())
+	})
+
+	It("should backfill the blogs seen in a batch after a gap", func() {
+		missed := storetest.Comment(1, 2, 20)
+		cfClient.batches = [][]models.RecentAction{
+			{storetest.Comment(1, 1, 10)},
+			{storetest.Comment(1, 3, 30), storetest.Comment(2, 4, 40)},
+		}
+		cfClient.comments[1] = comments(storetest.Comment(1, 1, 10), missed,
+			storetest.Comment(1, 3, 30))
+		cfClient.failures[2] = true
+
+		sch := scheduler.NewScheduler(cfClient, cfStore, 2, 0)
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+
+		gaps, err := cfStore.QuerySyncGaps(ctx, 0)
+		Expect(err).Should(BeNil())
+		Expect(gaps).Should(HaveLen(1))
+		Expect(gaps[0].StartTimestamp).Should(Equal(int64(10)))
+		Expect(gaps[0].EndTimestamp).Should(Equal(int64(30)))
+		Expect(gaps[0].Backfills).Should(Equal([]models.BackfillOutcome{
+			{BlogId: 1, Fetched: 3, Inserted: 1},
+			{BlogId: 2, Error: "fake-failure"},
+		}))
+
+		actions, err := cfStore.QueryRecentActions(ctx, 0, 0, nil)
+		Expect(err).Should(BeNil())
+		Expect(actions).Should(HaveLen(4))
+		Expect(actions[2].TimeSeconds).Should(Equal(int64(20)))
+	})
+
+	It("should cache the profiles seen in a batch", func() {
+		cfClient.batches = [][]models.RecentAction{
+			{storetest.Comment(1, 1, 10)},
+			{storetest.Comment(1, 2, 20), storetest.Comment(1, 1, 10)},
+		}
+
+		sch := scheduler.NewScheduler(cfClient, cfStore, 2, 0)
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+
+		// The second batch only has handles that were fetched already.
+		Expect(cfClient.queriedHandles).Should(Equal([][]string{
+			{"fake-author", "fake-commentator"},
+		}))
+
+		profiles, err := cfStore.QueryProfiles(ctx, "fake-author")
+		Expect(err).Should(BeNil())
+		Expect(profiles).Should(HaveLen(1))
+		Expect(profiles[0].Rank).Should(Equal("expert"))
+	})
+
+	It("should skip the handles unknown to Codeforces", func() {
+		cfClient.missingHandles = map[string]bool{"fake-author": true}
+		cfClient.batches = [][]models.RecentAction{
+			{storetest.Comment(1, 1, 10)},
+			{storetest.Comment(1, 2, 20)},
+		}
+
+		sch := scheduler.NewScheduler(cfClient, cfStore, 2, 0)
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		Expect(sch.Sync(ctx)).Should(Succeed())
+
+		// The missing handle is cached, and not queried by the second sync.
+		Expect(cfClient.queriedHandles).Should(Equal([][]string{
+			{"fake-author", "fake-commentator"},
+			{"fake-commentator"},
+		}))
+
+		profiles, err := cfStore.QueryProfiles(ctx, "fake-author",
+			"fake-commentator")
+		Expect(err).Should(BeNil())
+		Expect(profiles).Should(HaveLen(2))
+		for _, profile := range profiles {
+			Expect(profile.Missing).Should(Equal(
+				profile.Handle == "fake-author"))
+		}
+	})
+
+	It("should persist the contests", func() {
+		cfClient.contests = []models.Contest{
+			{Id: 1, Name: "fake-contest", StartTimeSeconds: 100,
+				DurationSeconds: 100},
+		}
+
+		sch := scheduler.NewContestScheduler(cfClient, cfStore, 0)
+		Expect(sch.Sync(ctx)).Should(Succeed())
+
+		contests, err := cfStore.QueryUpcomingContests(ctx, 0)
+		Expect(err).Should(BeNil())
+		Expect(contests).Should(Equal(cfClient.contests))
+	})
+
+	It("should backfill a gap from a Codeforces server", func() {
+		server := cftest.NewServer()
+		DeferCleanup(server.Close)
+		cfClient := cfapi.NewCodeforcesClient(time.Second,
+			cfapi.WithBaseURL(server.BaseURL()),
+			cfapi.WithRateLimit(0, 0))
+
+		first := storetest.Comment(1, 1, 10)
+		missed := storetest.Comment(1, 2, 20)
+		latest := storetest.Comment(1, 3, 30)
+		server.AddComments(1, *first.Comment, *missed.Comment, *latest.Comment)
+		server.AddUsers(models.CodeforcesUser{Handle: "fake-author"},
+			models.CodeforcesUser{Handle: "fake-commentator"})
+
+		sch := scheduler.NewScheduler(cfClient, cfStore, 1, 0)
+		server.SetRecentActions(first)
+		Expect(sch.Sync(ctx)).Should(Succeed())
+		server.SetRecentActions(latest, missed, first)
+		Expect(sch.Sync(ctx)).Should(Succeed())
+
+		gaps, err := cfStore.QuerySyncGaps(ctx, 0)
+		Expect(err).Should(BeNil())
+		Expect(gaps).Should(HaveLen(1))
+		Expect(gaps[0].Backfills).Should(Equal([]models.BackfillOutcome{
+			{BlogId: 1, Fetched: 3, Inserted: 1},
+		}))
+
+		actions, err := cfStore.QueryRecentActions(ctx, 0, 0, nil)
+		Expect(err).Should(BeNil())
+		Expect(actions).Should(HaveLen(3))
+	})
+
+	Describe("adaptive cooldown", func() {
+		It("should follow the share of new actions within bounds", func() {
+			first := []models.RecentAction{storetest.Comment(1, 2, 20),
+				storetest.Comment(1, 1, 10)}
+			cfClient.batches = [][]models.RecentAction{
+				first,
+				first,
+				{storetest.Comment(1, 3, 30), storetest.Comment(1, 2, 20),
+					storetest.Comment(1, 1, 10)},
+				first,
+				first,
+				first,
+			}
+			sch := scheduler.NewScheduler(cfClient, cfStore, 3,
+				4*time.Minute, scheduler.WithAdaptiveCooldown(time.Minute,
+					16*time.Minute, 0))
+
+			var cooldowns []time.Duration
+			for range cfClient.batches {
+				Expect(sch.Sync(ctx)).Should(Succeed())
+				cooldowns = append(cooldowns, scheduler.Cooldown(sch))
+			}
+			Expect(cooldowns).Should(Equal([]time.Duration{
+				2 * time.Minute, 4 * time.Minute, 4 * time.Minute,
+				8 * time.Minute, 16 * time.Minute, 16 * time.Minute,
+			}))
+			Expect(metrics.JSON()).Should(ContainSubstring(
+				`"scheduler.cooldownSeconds": 960`))
+		})
+
+		It("should shorten after a gap", func() {
+			latest := []models.RecentAction{storetest.Comment(1, 3, 30)}
+			cfClient.batches = [][]models.RecentAction{
+				{storetest.Comment(1, 1, 10)},
+				latest,
+			}
+			sch := scheduler.NewScheduler(cfClient, cfStore, 1,
+				4*time.Minute, scheduler.WithAdaptiveCooldown(time.Minute,
+					16*time.Minute, 0))
+			Expect(sch.Sync(ctx)).Should(Succeed())
+			Expect(scheduler.Cooldown(sch)).Should(Equal(2 * time.Minute))
+
+			// The batch after the gap holds no new action, since it was
+			// persisted by someone else.
+			Expect(cfStore.AddRecentActions(ctx, latest)).Should(Equal(1))
+			Expect(sch.Sync(ctx)).Should(Succeed())
+			Expect(scheduler.Cooldown(sch)).Should(Equal(time.Minute))
+		})
+
+		It("should not poll faster than the rate limit", func() {
+			cfClient.batches = [][]models.RecentAction{
+				{storetest.Comment(1, 1, 10)},
+			}
+			sch := scheduler.NewScheduler(cfClient, cfStore, 1,
+				10*time.Second, scheduler.WithAdaptiveCooldown(time.Second,
+					time.Hour, 0.1))
+
+			// The sync fetched the actions, the profiles and the blog, and the
+			// rate limit allows one call every 10 seconds.
+			Expect(sch.Sync(ctx)).Should(Succeed())
+			Expect(scheduler.Cooldown(sch)).Should(Equal(30 * time.Second))
+		})
+	})
+
+	Describe("leader election", func() {
+		var now time.Time
+		var follower, stalled *leader.Elector
+
+		BeforeEach(func() {
+			now = time.Unix(1000, 0)
+			clock := func() time.Time { return now }
+			stalled = leader.NewElector(cfStore, leader.SchedulerLease,
+				"stalled", leader.WithTTL(time.Minute), leader.WithClock(clock))
+			follower = leader.NewElector(cfStore, leader.SchedulerLease,
+				"follower", leader.WithTTL(time.Minute), leader.WithClock(clock))
+
+			Expect(stalled.Campaign(ctx)).Should(BeTrue())
+			Expect(follower.Campaign(ctx)).Should(BeFalse())
+		})
+
+		It("should not sync on the followers", func() {
+			running, stop := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer stop()
+
+			// There are no batches, so a sync would panic.
+			scheduler.NewScheduler(cfClient, cfStore, 1, time.Millisecond,
+				scheduler.WithElector(follower)).Start(running)
+		})
+
+		It("should not persist a batch after a handover", func() {
+			cfClient.batches = [][]models.RecentAction{
+				{storetest.Comment(1, 1, 10)},
+			}
+			sch := scheduler.NewScheduler(cfClient, cfStore, 1, 0,
+				scheduler.WithElector(stalled))
+
+			now = now.Add(time.Minute)
+			Expect(follower.Campaign(ctx)).Should(BeTrue())
+
+			Expect(sch.Sync(ctx)).Should(MatchError(
+				ContainSubstring("fencing failed")))
+			Expect(cfStore.LastRecordedTimestampForRecentActions(ctx)).
+				Should(BeZero())
+
+			// The run of a replica which lost the lease is not recorded.
+			Expect(cfStore.QuerySchedulerRuns(ctx, 0)).Should(BeEmpty())
+		})
+
+		It("should stop writing after a handover during a sync", func() {
+			cfClient.batches = [][]models.RecentAction{
+				{storetest.Comment(1, 1, 10)},
+			}
+			cfClient.blogs[1] = models.BlogEntry{Id: 1, Content: "fake"}
+			sch := scheduler.NewScheduler(cfClient, cfStore, 1, 0,
+				scheduler.WithElector(stalled))
+
+			// The follower takes over while the profiles are fetched, after
+			// the batch was persisted.
+			cfClient.queryingHandles = func() {
+				now = now.Add(time.Minute)
+				Expect(follower.Campaign(ctx)).Should(BeTrue())
+			}
+			Expect(sch.Sync(ctx)).Should(Succeed())
+			Expect(cfStore.LastRecordedTimestampForRecentActions(ctx)).
+				Should(Equal(int64(10)))
+
+			Expect(cfStore.QueryProfiles(ctx, "fake-author")).Should(BeEmpty())
+			Expect(cfStore.QueryBlogRevisions(ctx, 1)).Should(BeEmpty())
+			Expect(cfStore.QueryCheckpoint(ctx,
+				scheduler.RecentActionsCheckpoint)).Should(BeNil())
+			Expect(cfStore.QuerySchedulerRuns(ctx, 0)).Should(BeEmpty())
+		})
+
+		It("should resume from the checkpoint of the previous leader",
+			func() {
+				first := []models.RecentAction{storetest.Comment(1, 1, 10)}
+				Expect(cfStore.AddRecentActions(ctx, first)).Should(Equal(1))
+				Expect(cfStore.SaveCheckpoint(ctx, &models.Checkpoint{
+					Name:      scheduler.RecentActionsCheckpoint,
+					Timestamp: 10,
+				})).Should(Succeed())
+				sch := scheduler.NewScheduler(cfClient, cfStore, 3,
+					4*time.Minute, scheduler.WithElector(follower),
+					scheduler.WithAdaptiveCooldown(time.Minute,
+						16*time.Minute, 0))
+
+				// The stalled replica persists more actions before the
+				// follower takes over.
+				Expect(cfStore.AddRecentActions(ctx, []models.RecentAction{
+					storetest.Comment(1, 3, 30), storetest.Comment(1, 2, 20),
+				})).Should(Equal(2))
+				Expect(cfStore.SaveCheckpoint(ctx, &models.Checkpoint{
+					Name:      scheduler.RecentActionsCheckpoint,
+					Timestamp: 30,
+				})).Should(Succeed())
+				now = now.Add(time.Minute)
+				Expect(follower.Campaign(ctx)).Should(BeTrue())
+
+				cfClient.batches = [][]models.RecentAction{
+					{storetest.Comment(1, 4, 40), storetest.Comment(1, 3, 30),
+						storetest.Comment(1, 2, 20)},
+				}
+				Expect(sch.Sync(ctx)).Should(Succeed())
+
+				gaps, err := cfStore.QuerySyncGaps(ctx, 0)
+				Expect(err).Should(BeNil())
+				Expect(gaps).Should(BeEmpty())
+				Expect(scheduler.Cooldown(sch)).Should(Equal(4 * time.Minute))
+				Expect(sch.State().LastInsertedTimestamp).
+					Should(Equal(int64(40)))
+			})
+	})
+
+	Describe("revisions", func() {
+		It("should record the blogs modified since their last revision", func() {
+			cfClient.batches = [][]models.RecentAction{
+				{storetest.Comment(1, 1, 10)},
+				{storetest.Comment(1, 2, 20)},
+				{storetest.Comment(1, 3, 20)},
+			}
+			sch := scheduler.NewScheduler(cfClient, cfStore, 1, 0)
+
+			for _, blog := range []models.BlogEntry{
+				{Id: 1, Content: "fake-v1", ModificationTimeSeconds: 10},
+				{Id: 1, Content: "fake-v2", ModificationTimeSeconds: 20},
+				{Id: 1, Content: "fake-v3", ModificationTimeSeconds: 20},
+			} {
+				cfClient.blogs[1] = blog
+				Expect(sch.Sync(ctx)).Should(Succeed())
+			}
+
+			// The last batch does not modify the blog, so it is not fetched.
+			revisions, err := cfStore.QueryBlogRevisions(ctx, 1)
+			Expect(err).Should(BeNil())
+			Expect(revisions).Should(HaveLen(2))
+			Expect(revisions[0].Content).Should(Equal("fake-v1"))
+			Expect(revisions[1].Content).Should(Equal("fake-v2"))
+		})
+	})
+
+	Describe("history", func() {
+		It("should record the outcome of every run", func() {
+			cfClient.batches = [][]models.RecentAction{
+				{storetest.Comment(1, 2, 20), storetest.Comment(1, 1, 10)},
+				{storetest.Comment(1, 3, 30), storetest.Comment(1, 2, 20)},
+			}
+
+			sch := scheduler.NewScheduler(cfClient, cfStore, 2, 0)
+			Expect(sch.Sync(ctx)).Should(Succeed())
+			Expect(sch.Sync(ctx)).Should(Succeed())
+
+			runs, err := cfStore.QuerySchedulerRuns(ctx, 0)
+			Expect(err).Should(BeNil())
+			Expect(runs).Should(HaveLen(2))
+			Expect(runs[0].Fetched).Should(Equal(2))
+			Expect(runs[0].New).Should(Equal(1))
+			Expect(runs[0].Duplicates).Should(Equal(1))
+			Expect(runs[0].Error).Should(BeEmpty())
+			Expect(runs[0].EndedAt).ShouldNot(BeTemporally("<",
+				runs[0].StartedAt))
+			Expect(runs[1].New).Should(Equal(2))
+		})
+
+		It("should save the checkpoint after a sync", func() {
+			cfClient.batches = [][]models.RecentAction{
+				{storetest.Comment(1, 2, 20), storetest.Comment(1, 1, 10)},
+			}
+
+			sch := scheduler.NewScheduler(cfClient, cfStore, 2, 0)
+			Expect(sch.Sync(ctx)).Should(Succeed())
+
+			checkpoint, err := cfStore.QueryCheckpoint(ctx,
+				scheduler.RecentActionsCheckpoint)
+			Expect(err).Should(BeNil())
+			Expect(checkpoint.Timestamp).Should(BeEquivalentTo(20))
+		})
+
+		It("should resume from the checkpoint", func() {
+			Expect(cfStore.SaveCheckpoint(ctx, &models.Checkpoint{
+				Name:      scheduler.RecentActionsCheckpoint,
+				Timestamp: 10,
+			})).Should(Succeed())
+			cfClient.batches = [][]models.RecentAction{
+				{storetest.Comment(1, 3, 30), storetest.Comment(1, 2, 20)},
+			}
+
+			sch := scheduler.NewScheduler(cfClient, cfStore, 2, 0)
+			Expect(sch.Sync(ctx)).Should(Succeed())
+
+			gaps, err := cfStore.QuerySyncGaps(ctx, 0)
+			Expect(err).Should(BeNil())
+			Expect(gaps).Should(HaveLen(1))
+			Expect(gaps[0].StartTimestamp).Should(BeEquivalentTo(10))
+		})
+	})
+
+	Describe("control", func() {
+		var running context.Context
+		var stop context.CancelFunc
+		var done chan struct{}
+
+		BeforeEach(func() {
+			cfClient.batches = [][]models.RecentAction{
+				{storetest.Comment(1, 1, 10)},
+				{storetest.Comment(1, 2, 20)},
+				{storetest.Comment(1, 3, 30)},
+			}
+			running, stop = context.WithCancel(ctx)
+			done = make(chan struct{})
+		})
+
+		// start runs the loop, whose calls to Codeforces wait for the gate.
+		start := func(sch scheduler.CodeforcesSchedulerInterface) {
+			cfClient.gate = make(chan struct{})
+			cfClient.started = make(chan struct{}, 3)
+			go func() {
+				defer close(done)
+				sch.Start(running)
+			}()
+			DeferCleanup(func() {
+				stop()
+				close(cfClient.gate)
+				Eventually(done).Should(BeClosed())
+			})
+		}
+
+		It("should not sync while paused", func() {
+			sch := scheduler.NewScheduler(cfClient, cfStore, 1, time.Hour)
+			sch.Pause()
+			start(sch)
+
+			Consistently(cfClient.started, 50*time.Millisecond).
+				ShouldNot(Receive())
+			Expect(sch.State().Paused).Should(BeTrue())
+
+			sch.Resume()
+			Eventually(cfClient.started).Should(Receive())
+			Expect(sch.State().Syncing).Should(BeTrue())
+			cfClient.gate <- struct{}{}
+			Eventually(func() int64 {
+				return sch.State().LastInsertedTimestamp
+			}).Should(Equal(int64(10)))
+		})
+
+		It("should apply a new cooldown right away", func() {
+			sch := scheduler.NewScheduler(cfClient, cfStore, 1, time.Hour)
+			start(sch)
+
+			Eventually(cfClient.started).Should(Receive())
+			cfClient.gate <- struct{}{}
+			Eventually(func() *time.Time {
+				return sch.State().NextAttempt
+			}).ShouldNot(BeNil())
+			Consistently(cfClient.started, 50*time.Millisecond).
+				ShouldNot(Receive())
+
+			Expect(sch.SetCooldown(0)).ShouldNot(Succeed())
+			Expect(sch.SetCooldown(time.Millisecond)).Should(Succeed())
+			Eventually(cfClient.started).Should(Receive())
+			Expect(sch.State().CooldownSeconds).Should(Equal(0.001))
+		})
+
+		It("should sync on demand with the new batch size", func() {
+			sch := scheduler.NewScheduler(cfClient, cfStore, 1, time.Hour)
+			Expect(sch.SetBatchSize(0)).ShouldNot(Succeed())
+			Expect(sch.SetBatchSize(101)).ShouldNot(Succeed())
+			Expect(sch.SetBatchSize(50)).Should(Succeed())
+			Expect(sch.State().LastAttempt).Should(BeNil())
+
+			Expect(sch.Trigger(ctx)).Should(Succeed())
+			Expect(cfClient.maxCounts).Should(Equal([]int{50}))
+
+			state := sch.State()
+			Expect(state.BatchSize).Should(Equal(50))
+			Expect(state.LastInsertedTimestamp).Should(Equal(int64(10)))
+			Expect(state.Syncing).Should(BeFalse())
+			Expect(*state.NextAttempt).Should(Equal(
+				state.LastAttempt.Add(time.Hour)))
+		})
+
+		It("should not cancel a sync on demand with its request", func() {
+			sch := scheduler.NewScheduler(cfClient, cfStore, 1, time.Hour)
+			cfClient.gate = make(chan struct{})
+			cfClient.started = make(chan struct{}, 1)
+
+			request, cancel := context.WithCancel(ctx)
+			cancel()
+			triggered := make(chan error, 1)
+			go func() {
+				triggered <- sch.Trigger(request)
+			}()
+
+			Eventually(cfClient.started).Should(Receive())
+			cfClient.gate <- struct{}{}
+			Eventually(triggered).Should(Receive(BeNil()))
+		})
+
+		It("should cancel a sync on demand when the loop stops", func() {
+			sch := scheduler.NewScheduler(cfClient, cfStore, 1, time.Hour)
+			start(sch)
+			Eventually(cfClient.started).Should(Receive())
+			cfClient.gate <- struct{}{}
+			Eventually(func() *time.Time {
+				return sch.State().NextAttempt
+			}).ShouldNot(BeNil())
+
+			triggered := make(chan error, 1)
+			go func() {
+				triggered <- sch.Trigger(ctx)
+			}()
+			Eventually(cfClient.started).Should(Receive())
+			stop()
+			Eventually(triggered).Should(Receive(MatchError(
+				ContainSubstring(context.Canceled.Error()))))
+			Eventually(done).Should(BeClosed())
+			Expect(sch.Trigger(ctx)).Should(MatchError(scheduler.ErrStopped))
+		})
+
+		It("should wait for a sync on demand before stopping", func() {
+			sch := scheduler.NewScheduler(cfClient, cfStore, 1, time.Hour)
+			start(sch)
+			Eventually(cfClient.started).Should(Receive())
+			cfClient.gate <- struct{}{}
+			Eventually(func() *time.Time {
+				return sch.State().NextAttempt
+			}).ShouldNot(BeNil())
+
+			// The loop stops while the sync on demand fetches its batch.
+			release := make(chan struct{})
+			cfClient.fetched = func() {
+				stop()
+				<-release
+			}
+			triggered := make(chan error, 1)
+			go func() {
+				triggered <- sch.Trigger(ctx)
+			}()
+			Eventually(cfClient.started).Should(Receive())
+			cfClient.gate <- struct{}{}
+
+			Consistently(done, 50*time.Millisecond).ShouldNot(BeClosed())
+			close(release)
+			Eventually(done).Should(BeClosed())
+			Eventually(triggered).Should(Receive(BeNil()))
+			Expect(sch.State().LastInsertedTimestamp).Should(Equal(int64(20)))
+		})
+
+		It("should not sync on demand on the followers", func() {
+			now := time.Unix(1000, 0)
+			clock := func() time.Time { return now }
+			leading := leader.NewElector(cfStore, leader.SchedulerLease,
+				"leading", leader.WithClock(clock))
+			follower := leader.NewElector(cfStore, leader.SchedulerLease,
+				"follower", leader.WithClock(clock))
+			Expect(leading.Campaign(ctx)).Should(BeTrue())
+			Expect(follower.Campaign(ctx)).Should(BeFalse())
+
+			sch := scheduler.NewScheduler(cfClient, cfStore, 1, time.Hour,
+				scheduler.WithElector(follower))
+			Expect(sch.Trigger(ctx)).Should(MatchError(leader.ErrNotLeader))
+			Expect(sch.State().Leader).Should(BeFalse())
+		})
+	})
+
+	Describe("Start", func() {
+		It("should not sync once the context is done", func() {
+			stopped, stop := context.WithCancel(ctx)
+			stop()
+
+			// There are no batches, so a sync would panic.
+			scheduler.NewScheduler(cfClient, cfStore, 1, time.Hour).
+				Start(stopped)
+		})
+
+		It("should cancel the fetch in progress", func() {
+			cfClient.batches = [][]models.RecentAction{
+				{storetest.Comment(1, 1, 10)},
+			}
+			cfClient.gate = make(chan struct{})
+			cfClient.started = make(chan struct{}, 1)
+
+			running, stop := context.WithCancel(ctx)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				scheduler.NewScheduler(cfClient, cfStore, 1, time.Hour).
+					Start(running)
+			}()
+
+			Eventually(cfClient.started).Should(Receive())
+			stop()
+			Eventually(done).Should(BeClosed())
+			Expect(cfStore.LastRecordedTimestampForRecentActions(ctx)).
+				Should(BeZero())
+		})
+
+		It("should persist a batch fetched before the context is done",
+			func() {
+				cfStore := cancellableStore{CodeforcesStore: cfStore}
+				cfClient.batches = [][]models.RecentAction{
+					{storetest.Comment(1, 1, 10)},
+				}
+				running, stop := context.WithCancel(ctx)
+				cfClient.fetched = stop
+
+				scheduler.NewScheduler(cfClient, cfStore, 1, time.Hour).
+					Start(running)
+				Expect(cfStore.LastRecordedTimestampForRecentActions(ctx)).
+					Should(Equal(int64(10)))
+
+				checkpoint, err := cfStore.QueryCheckpoint(ctx,
+					scheduler.RecentActionsCheckpoint)
+				Expect(err).Should(BeNil())
+				Expect(checkpoint.Timestamp).Should(Equal(int64(10)))
+			})
+	})
+})
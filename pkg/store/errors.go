@@ -0,0 +1,18 @@
+package store
+
+import "fmt"
+
+// AlreadyExistsError is returned when adding an entity would violate a
+// uniqueness constraint of the store.
+type AlreadyExistsError struct {
+	// Field is the name of the unique field, e.g. "username".
+	Field string
+
+	// Value is the conflicting value of the field.
+	Value string
+}
+
+func (err *AlreadyExistsError) Error() string {
+	return fmt.Sprintf("an entry with %s %q already exists", err.Field,
+		err.Value)
+}
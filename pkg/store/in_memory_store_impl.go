@@ -1,70 +1,478 @@
 package store
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/utils"
 )
 
 type inMemoryCodeforcesStore struct {
 	mutex sync.Mutex
 
-	recentActions  []models.RecentAction
-	uuidToUsersMap map[string]*models.User
+	// recentActions is sorted in increasing order of activity time, blog id
+	// and comment id, i.e. the order of models.Cursor.
+	recentActions []models.RecentAction
+	actionKeys    map[string]bool
+
+	// blogComments indexes the comment actions by blog, each sorted in
+	// increasing order of models.CursorOfComment.
+	blogComments map[int][]models.RecentAction
+
+	latestBlogs        map[int]*models.BlogEntry
+	uuidToUsersMap     map[string]*models.User
+	usernameToUsersMap map[string]*models.User
+	sessions           map[string]*models.Session
+	syncGaps           []models.SyncGap
+	schedulerRuns      []models.SchedulerRun
+	checkpoints        map[string]models.Checkpoint
+	blogRevisions      map[int][]models.BlogRevision
+	profiles           map[string]models.CodeforcesUser
+	contests           map[int]models.Contest
+	leases             map[string]models.Lease
 }
 
-func (store *inMemoryCodeforcesStore) AddRecentActions(
-	actions []models.RecentAction) error {
+func (store *inMemoryCodeforcesStore) AddRecentActions(ctx context.Context,
+	actions []models.RecentAction) (int, error) {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	store.recentActions = append(store.recentActions, actions...)
-	return nil
+	batch := make([]models.RecentAction, 0, len(actions))
+	for _, action := range actions {
+		key := action.NaturalKey()
+		if store.actionKeys[key] {
+			continue
+		}
+		store.actionKeys[key] = true
+		batch = append(batch, copyAction(action))
+	}
+
+	// Codeforces returns the latest actions first, so restore the order
+	// before merging the batch into the index. The sorts are stable to keep
+	// the insertion order of ties.
+	sort.SliceStable(batch, func(i, j int) bool {
+		return models.CursorOfAction(batch[i]).Less(
+			models.CursorOfAction(batch[j]))
+	})
+
+	for _, action := range batch {
+		store.recordBlog(action.BlogEntry)
+		store.indexComment(action)
+	}
+
+	length := len(store.recentActions)
+	store.recentActions = append(store.recentActions, batch...)
+	if length > 0 && len(batch) > 0 && models.CursorOfAction(batch[0]).Less(
+		models.CursorOfAction(store.recentActions[length-1])) {
+		// The batch overlaps with the existing actions, which is rare.
+		sort.SliceStable(store.recentActions, func(i, j int) bool {
+			return models.CursorOfAction(store.recentActions[i]).Less(
+				models.CursorOfAction(store.recentActions[j]))
+		})
+	}
+	return len(batch), nil
 }
 
-func (store *inMemoryCodeforcesStore) QueryRecentActions(
-	startTimestamp, limit int64) (
+func (store *inMemoryCodeforcesStore) QueryRecentActions(ctx context.Context,
+	startTimestamp, limit int64, after *models.Cursor) (
 	[]models.RecentAction, error) {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
+	res := store.queryLatestActions(startTimestamp, limit, after,
+		func(action *models.RecentAction) bool {
+			return action.BlogEntry != nil && action.Comment != nil
+		})
+
+	return res, nil
+}
+
+func (store *inMemoryCodeforcesStore) LastRecordedTimestampForRecentActions(
+	ctx context.Context) int64 {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	length := len(store.recentActions)
+	if length == 0 {
+		return 0
+	}
+
+	return store.recentActions[length-1].TimeSeconds
+}
+
+// queryLatestActions returns copies of the actions that happened at or after
+// startTimestamp, come strictly after the cursor and satisfy the predicate, in
+// decreasing order of activity time. A non-positive limit returns all the
+// matching actions.
+//
+// It must be called with the mutex held.
+func (store *inMemoryCodeforcesStore) queryLatestActions(startTimestamp,
+	limit int64, after *models.Cursor,
+	predicate func(*models.RecentAction) bool) []models.RecentAction {
+	// The actions are sorted, hence both ends of the eligible range can be
+	// found with a binary search.
+	first := sort.Search(len(store.recentActions), func(ind int) bool {
+		return store.recentActions[ind].TimeSeconds >= startTimestamp
+	})
+	last := len(store.recentActions) - 1
+	if after != nil {
+		last = sort.Search(len(store.recentActions), func(ind int) bool {
+			return !models.CursorOfAction(store.recentActions[ind]).Less(*after)
+		}) - 1
+	}
+
 	var res []models.RecentAction
-	for _, action := range store.recentActions {
-		if action.TimeSeconds >= startTimestamp {
-			res = append(res, action)
+	for ind := last; ind >= first; ind-- {
+		if limit > 0 && int64(len(res)) >= limit {
+			break
+		}
+		if predicate(&store.recentActions[ind]) {
+			res = append(res, copyAction(store.recentActions[ind]))
+		}
+	}
+
+	utils.ConvertRelativeLinksToAbsoluteLinks(res)
+	return res
+}
+
+// copyBlog returns a deep copy of the blog.
+func copyBlog(blog *models.BlogEntry) *models.BlogEntry {
+	res := *blog
+	res.Tags = append([]string(nil), blog.Tags...)
+	return &res
+}
+
+// recordBlog remembers the blog if it is the latest known version.
+// Among versions with equal modification time, the last one seen wins.
+//
+// It must be called with the mutex held.
+func (store *inMemoryCodeforcesStore) recordBlog(blog *models.BlogEntry) {
+	if blog == nil {
+		return
+	}
+	if latest, ok := store.latestBlogs[blog.Id]; ok &&
+		latest.ModificationTimeSeconds > blog.ModificationTimeSeconds {
+		return
+	}
+	store.latestBlogs[blog.Id] = blog
+}
+
+// indexComment adds the action to the comments of its blog, if it is a comment.
+// Among comments with equal cursors, the last one indexed comes last.
+//
+// It must be called with the mutex held.
+func (store *inMemoryCodeforcesStore) indexComment(action models.RecentAction) {
+	if action.BlogEntry == nil || action.Comment == nil {
+		return
+	}
+
+	id := action.BlogEntry.Id
+	cursor := models.CursorOfComment(id, *action.Comment)
+	comments := store.blogComments[id]
+	pos := sort.Search(len(comments), func(ind int) bool {
+		return cursor.Less(models.CursorOfComment(id, *comments[ind].Comment))
+	})
+	comments = append(comments, models.RecentAction{})
+	copy(comments[pos+1:], comments[pos:])
+	comments[pos] = copyAction(action)
+	store.blogComments[id] = comments
+}
+
+// copyAction returns a deep copy of the action, so that the callers can never
+// mutate the contents of the store.
+func copyAction(action models.RecentAction) models.RecentAction {
+	if action.BlogEntry != nil {
+		action.BlogEntry = copyBlog(action.BlogEntry)
+	}
+	if action.Comment != nil {
+		comment := *action.Comment
+		action.Comment = &comment
+	}
+	return action
+}
+
+func (store *inMemoryCodeforcesStore) AddSyncGap(ctx context.Context,
+	gap *models.SyncGap) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.syncGaps = append(store.syncGaps, *gap)
+	return nil
+}
+
+func (store *inMemoryCodeforcesStore) QuerySyncGaps(ctx context.Context,
+	limit int64) ([]models.SyncGap, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var res []models.SyncGap
+	for ind := len(store.syncGaps) - 1; ind >= 0; ind-- {
+		if limit > 0 && int64(len(res)) >= limit {
+			break
 		}
+		res = append(res, store.syncGaps[ind])
 	}
+	return res, nil
+}
+
+func (store *inMemoryCodeforcesStore) AddSchedulerRun(ctx context.Context,
+	run *models.SchedulerRun) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.schedulerRuns = append(store.schedulerRuns, *run)
+	return nil
+}
 
+func (store *inMemoryCodeforcesStore) QuerySchedulerRuns(ctx context.Context,
+	limit int64) ([]models.SchedulerRun, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	res := make([]models.SchedulerRun, len(store.schedulerRuns))
+	copy(res, store.schedulerRuns)
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].StartedAt.After(res[j].StartedAt)
+	})
+	if limit > 0 && int64(len(res)) > limit {
+		res = res[:limit]
+	}
 	return res, nil
 }
 
-func (store *inMemoryCodeforcesStore) LastRecordedTimestampForRecentActions() int64 {
+func (store *inMemoryCodeforcesStore) SaveCheckpoint(ctx context.Context,
+	checkpoint *models.Checkpoint) error {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	res := int64(0)
-	for _, action := range store.recentActions {
-		if action.TimeSeconds > res {
-			res = action.TimeSeconds
+	store.checkpoints[checkpoint.Name] = *checkpoint
+	return nil
+}
+
+func (store *inMemoryCodeforcesStore) QueryCheckpoint(ctx context.Context,
+	name string) (*models.Checkpoint, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	checkpoint, ok := store.checkpoints[name]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (store *inMemoryCodeforcesStore) AddBlogRevision(ctx context.Context,
+	revision *models.BlogRevision) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	revisions := store.blogRevisions[revision.BlogId]
+	for _, existing := range revisions {
+		if existing.Id == revision.Id {
+			return false, nil
 		}
 	}
 
-	return res
+	copied := *revision
+	copied.Tags = append([]string(nil), revision.Tags...)
+	revisions = append(revisions, copied)
+	sort.SliceStable(revisions, func(i, j int) bool {
+		if revisions[i].ModificationTimeSeconds !=
+			revisions[j].ModificationTimeSeconds {
+			return revisions[i].ModificationTimeSeconds <
+				revisions[j].ModificationTimeSeconds
+		}
+		return revisions[i].SeenAt.Before(revisions[j].SeenAt)
+	})
+	store.blogRevisions[revision.BlogId] = revisions
+	return true, nil
 }
 
-func (store *inMemoryCodeforcesStore) AddUser(user *models.User) error {
+func (store *inMemoryCodeforcesStore) QueryBlogRevisions(ctx context.Context,
+	blogId int) ([]models.BlogRevision, error) {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	// TODO: Add condition to reject duplicate uuid.
-	store.uuidToUsersMap[user.Uuid] = user
+	revisions := store.blogRevisions[blogId]
+	res := make([]models.BlogRevision, len(revisions))
+	copy(res, revisions)
+	return res, nil
+}
+
+func (store *inMemoryCodeforcesStore) QueryBlogRevision(ctx context.Context,
+	blogId int, id string) (*models.BlogRevision, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
 
+	for _, revision := range store.blogRevisions[blogId] {
+		if revision.Id == id {
+			return &revision, nil
+		}
+	}
+	return nil, nil
+}
+
+func (store *inMemoryCodeforcesStore) AddProfiles(ctx context.Context,
+	profiles []models.CodeforcesUser) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, profile := range profiles {
+		store.profiles[profile.Handle] = profile
+	}
 	return nil
 }
 
-func (store *inMemoryCodeforcesStore) QueryUserByUuid(uuid string) (
-	*models.User, error) {
+func (store *inMemoryCodeforcesStore) QueryProfiles(ctx context.Context,
+	handles ...string) ([]models.CodeforcesUser, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var res []models.CodeforcesUser
+	for _, handle := range handles {
+		if profile, ok := store.profiles[handle]; ok {
+			res = append(res, profile)
+		}
+	}
+	return res, nil
+}
+
+func (store *inMemoryCodeforcesStore) AddContests(ctx context.Context,
+	contests []models.Contest) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, contest := range contests {
+		store.contests[contest.Id] = contest
+	}
+	return nil
+}
+
+func (store *inMemoryCodeforcesStore) QueryUpcomingContests(ctx context.Context,
+	timestamp int64) ([]models.Contest, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var res []models.Contest
+	for _, contest := range store.contests {
+		if contest.StartTimeSeconds != 0 &&
+			contest.EndTimeSeconds() >= timestamp {
+			res = append(res, contest)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].StartTimeSeconds != res[j].StartTimeSeconds {
+			return res[i].StartTimeSeconds < res[j].StartTimeSeconds
+		}
+		return res[i].Id < res[j].Id
+	})
+	return res, nil
+}
+
+func (store *inMemoryCodeforcesStore) AcquireLease(ctx context.Context,
+	name, holder string, now time.Time, ttl time.Duration) (
+	*models.Lease, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	lease, ok := store.leases[name]
+	switch {
+	case ok && lease.HeldBy(holder, now):
+		lease.RenewedAt = now
+		lease.ExpiresAt = now.Add(ttl)
+	case !ok || !now.Before(lease.ExpiresAt):
+		lease = models.Lease{
+			Name:       name,
+			Holder:     holder,
+			Token:      lease.Token + 1,
+			AcquiredAt: now,
+			RenewedAt:  now,
+			ExpiresAt:  now.Add(ttl),
+		}
+	}
+	store.leases[name] = lease
+	return &lease, nil
+}
+
+func (store *inMemoryCodeforcesStore) ReleaseLease(ctx context.Context,
+	name, holder string, token int64, now time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	lease, ok := store.leases[name]
+	if ok && lease.Holder == holder && lease.Token == token &&
+		now.Before(lease.ExpiresAt) {
+		lease.ExpiresAt = now
+		store.leases[name] = lease
+	}
+	return nil
+}
+
+func (store *inMemoryCodeforcesStore) QueryLease(ctx context.Context,
+	name string) (*models.Lease, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	lease, ok := store.leases[name]
+	if !ok {
+		return nil, nil
+	}
+	return &lease, nil
+}
+
+func (store *inMemoryCodeforcesStore) AddUser(ctx context.Context,
+	user *models.User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.uuidToUsersMap[user.Uuid]; ok {
+		return &AlreadyExistsError{Field: "uuid", Value: user.Uuid}
+	}
+	if _, ok := store.usernameToUsersMap[user.Username]; ok {
+		return &AlreadyExistsError{Field: "username", Value: user.Username}
+	}
+	// Both maps share the copy, so that an update through one of them is seen
+	// through the other.
+	stored := copyUser(user)
+	store.uuidToUsersMap[user.Uuid] = stored
+	store.usernameToUsersMap[user.Username] = stored
+
+	return nil
+}
+
+func (store *inMemoryCodeforcesStore) QueryUserByUsername(ctx context.Context,
+	username string) (*models.User, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	user, ok := store.usernameToUsersMap[username]
+	if !ok {
+		return nil, fmt.Errorf("user does not exist")
+	}
+
+	return copyUser(user), nil
+}
+
+func (store *inMemoryCodeforcesStore) UpdatePassword(ctx context.Context,
+	uuid, hashedPassword string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	user, ok := store.uuidToUsersMap[uuid]
+	if !ok {
+		return fmt.Errorf("user does not exist")
+	}
+
+	user.HashedPassword = hashedPassword
+	return nil
+}
+
+func (store *inMemoryCodeforcesStore) QueryUserByUuid(ctx context.Context,
+	uuid string) (*models.User, error) {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
@@ -73,11 +481,12 @@ func (store *inMemoryCodeforcesStore) QueryUserByUuid(uuid string) (
 		return nil, fmt.Errorf("user does not exist")
 	}
 
-	return user, nil
+	return copyUser(user), nil
 }
 
 func (store *inMemoryCodeforcesStore) QueryRecentActionsForUser(
-	uuid string, startTimestamp, limit int64) ([]models.RecentAction, error) {
+	ctx context.Context, uuid string, startTimestamp, limit int64,
+	after *models.Cursor) ([]models.RecentAction, error) {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
@@ -86,24 +495,25 @@ func (store *inMemoryCodeforcesStore) QueryRecentActionsForUser(
 		return nil, fmt.Errorf("user does not exist")
 	}
 
-	var res []models.RecentAction
-	// TODO: Optimize the time complexity of search.
-	ids := user.SubscribedBlogs
-	for _, action := range store.recentActions {
-		if action.TimeSeconds >= startTimestamp && action.BlogEntry != nil {
-			for _, id := range ids {
-				if action.BlogEntry.Id == id {
-					res = append(res, action)
-					break
-				}
-			}
-		}
+	if len(user.SubscribedBlogs) == 0 {
+		return nil, nil
+	}
+
+	subscribed := make(map[int]bool)
+	for _, id := range user.SubscribedBlogs {
+		subscribed[id] = true
 	}
 
+	res := store.queryLatestActions(startTimestamp, limit, after,
+		func(action *models.RecentAction) bool {
+			return action.BlogEntry != nil && action.Comment != nil &&
+				subscribed[action.BlogEntry.Id]
+		})
+
 	return res, nil
 }
 
-func (store *inMemoryCodeforcesStore) SubscribeToBlogs(
+func (store *inMemoryCodeforcesStore) SubscribeToBlogs(ctx context.Context,
 	uuid string, ids ...int) error {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
@@ -120,7 +530,7 @@ func (store *inMemoryCodeforcesStore) SubscribeToBlogs(
 	return nil
 }
 
-func (store *inMemoryCodeforcesStore) UnsubscribeFromBlogs(
+func (store *inMemoryCodeforcesStore) UnsubscribeFromBlogs(ctx context.Context,
 	uuid string, ids ...int) error {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
@@ -130,13 +540,15 @@ func (store *inMemoryCodeforcesStore) UnsubscribeFromBlogs(
 		return fmt.Errorf("user does not exist")
 	}
 
-	// TODO: Improve the time complexity.
+	toUnsubscribe := make(map[int]bool)
+	for _, id := range ids {
+		toUnsubscribe[id] = true
+	}
+
 	var newBlogsList []int
 	for _, old := range user.SubscribedBlogs {
-		for _, toUnsubscribe := range ids {
-			if old != toUnsubscribe {
-				newBlogsList = append(newBlogsList, old)
-			}
+		if !toUnsubscribe[old] {
+			newBlogsList = append(newBlogsList, old)
 		}
 	}
 
@@ -147,23 +559,189 @@ func (store *inMemoryCodeforcesStore) UnsubscribeFromBlogs(
 	return nil
 }
 
-func (store *inMemoryCodeforcesStore) QueryCommentsFromBlog(
-	id int, startTimestamp, limit int64) (
+func (store *inMemoryCodeforcesStore) AddFeedToken(ctx context.Context,
+	uuid string, token models.FeedToken) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	user, ok := store.uuidToUsersMap[uuid]
+	if !ok {
+		return fmt.Errorf("user does not exist")
+	}
+
+	user.FeedTokens = append(user.FeedTokens, token)
+
+	return nil
+}
+
+func (store *inMemoryCodeforcesStore) RevokeFeedToken(ctx context.Context, uuid,
+	tokenID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	user, ok := store.uuidToUsersMap[uuid]
+	if !ok {
+		return fmt.Errorf("user does not exist")
+	}
+
+	for ind, token := range user.FeedTokens {
+		if token.Id == tokenID {
+			user.FeedTokens = append(user.FeedTokens[:ind],
+				user.FeedTokens[ind+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("feed token does not exist")
+}
+
+// copyUser returns a deep copy of the user, so that the callers can never
+// mutate the contents of the store.
+func copyUser(user *models.User) *models.User {
+	res := *user
+	res.SubscribedBlogs = append([]int(nil), user.SubscribedBlogs...)
+	res.FeedTokens = append([]models.FeedToken(nil), user.FeedTokens...)
+	return &res
+}
+
+func (store *inMemoryCodeforcesStore) QueryUserByFeedToken(ctx context.Context,
+	hashedToken string) (*models.User, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// TODO: Optimize the time complexity of search.
+	for _, user := range store.uuidToUsersMap {
+		for _, token := range user.FeedTokens {
+			if token.HashedToken == hashedToken {
+				return copyUser(user), nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("feed token does not exist")
+}
+
+func (store *inMemoryCodeforcesStore) AddSession(ctx context.Context,
+	session *models.Session) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.sessions[session.HashedToken]; ok {
+		return &AlreadyExistsError{Field: "hashedToken",
+			Value: session.HashedToken}
+	}
+	copied := *session
+	store.sessions[session.HashedToken] = &copied
+
+	return nil
+}
+
+func (store *inMemoryCodeforcesStore) QuerySession(ctx context.Context,
+	hashedToken string) (*models.Session, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	session, ok := store.sessions[hashedToken]
+	if !ok {
+		return nil, fmt.Errorf("session does not exist")
+	}
+
+	copied := *session
+	return &copied, nil
+}
+
+func (store *inMemoryCodeforcesStore) DeleteSession(ctx context.Context,
+	hashedToken string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.sessions[hashedToken]; !ok {
+		return fmt.Errorf("session does not exist")
+	}
+	delete(store.sessions, hashedToken)
+
+	return nil
+}
+
+func (store *inMemoryCodeforcesStore) QueryCommentsFromBlog(ctx context.Context,
+	id int, startTimestamp, limit int64, after *models.Cursor) (
 	[]models.Comment, error) {
-	// TODO: Implement it.
-	return nil, nil
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// Walk the index of the blog backwards from the cursor.
+	indexed := store.blogComments[id]
+	last := len(indexed) - 1
+	if after != nil {
+		last = sort.Search(len(indexed), func(ind int) bool {
+			return !models.CursorOfComment(id, *indexed[ind].Comment).Less(
+				*after)
+		}) - 1
+	}
+
+	var actions []models.RecentAction
+	for ind := last; ind >= 0; ind-- {
+		if limit > 0 && int64(len(actions)) >= limit {
+			break
+		}
+		if indexed[ind].TimeSeconds >= startTimestamp {
+			actions = append(actions, copyAction(indexed[ind]))
+		}
+	}
+	utils.ConvertRelativeLinksToAbsoluteLinks(actions)
+
+	var comments []models.Comment
+	for _, action := range actions {
+		comments = append(comments, *action.Comment)
+	}
+
+	return comments, nil
 }
 
-func (store *inMemoryCodeforcesStore) QueryAllUniqueBlogs(
-	startTimestamp, limit int64) (
+func (store *inMemoryCodeforcesStore) QueryAllUniqueBlogs(ctx context.Context,
+	startTimestamp, limit int64, after *models.Cursor) (
 	[]models.BlogEntry, error) {
-	// TODO: Implement it.
-	return nil, nil
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var blogs []models.BlogEntry
+	for _, blog := range store.latestBlogs {
+		if blog.CreationTimeSeconds < startTimestamp {
+			continue
+		}
+		if after != nil && !models.CursorOfBlog(*blog).Less(*after) {
+			continue
+		}
+		blogs = append(blogs, *copyBlog(blog))
+	}
+
+	sort.Slice(blogs, func(i, j int) bool {
+		return models.CursorOfBlog(blogs[j]).Less(models.CursorOfBlog(blogs[i]))
+	})
+	if limit > 0 && int64(len(blogs)) > limit {
+		blogs = blogs[:limit]
+	}
+
+	return blogs, nil
+}
+
+func (store *inMemoryCodeforcesStore) Close(ctx context.Context) error {
+	return nil
 }
 
 func NewInMemoryCodeforcesStore() CodeforcesStore {
 	store := new(inMemoryCodeforcesStore)
+	store.actionKeys = make(map[string]bool)
+	store.latestBlogs = make(map[int]*models.BlogEntry)
+	store.blogComments = make(map[int][]models.RecentAction)
 	store.uuidToUsersMap = make(map[string]*models.User)
+	store.usernameToUsersMap = make(map[string]*models.User)
+	store.sessions = make(map[string]*models.Session)
+	store.profiles = make(map[string]models.CodeforcesUser)
+	store.contests = make(map[int]models.Contest)
+	store.leases = make(map[string]models.Lease)
+	store.checkpoints = make(map[string]models.Checkpoint)
+	store.blogRevisions = make(map[int][]models.BlogRevision)
 
 	return store
 }
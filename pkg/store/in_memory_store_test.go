@@ -0,0 +1,11 @@
+package store_test
+
+import (
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/storetest"
+)
+
+var _ = storetest.DescribeConformance("InMemoryStore",
+	func() store.CodeforcesStore {
+		return store.NewInMemoryCodeforcesStore()
+	})
@@ -0,0 +1,4 @@
+package mongodb
+
+// OnlyDuplicateKeys exposes onlyDuplicateKeys to the tests.
+var OnlyDuplicateKeys = onlyDuplicateKeys
@@ -2,6 +2,7 @@ package mongodb
 
 import (
 	"context"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -12,49 +13,180 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/variety-jones/cfrss/pkg/models"
-	"github.com/variety-jones/cfrss/pkg/store"
+	cfstore "github.com/variety-jones/cfrss/pkg/store"
 	"github.com/variety-jones/cfrss/pkg/utils"
 )
 
 const (
 	kRecentActionsCollectionName = "recent_actions"
 	kUsersCollectionName         = "users"
+	kSessionsCollectionName      = "sessions"
+	kSyncGapsCollectionName      = "sync_gaps"
+	kProfilesCollectionName      = "profiles"
+	kContestsCollectionName      = "contests"
+	kLeasesCollectionName        = "leases"
+	kSchedulerRunsCollectionName = "scheduler_runs"
+	kCheckpointsCollectionName   = "checkpoints"
+	kBlogRevisionsCollectionName = "blog_revisions"
+
+	kDefaultOperationTimeout = 30 * time.Second
+
+	// kDuplicateKeyCode is the code of the write errors caused by a unique
+	// index.
+	kDuplicateKeyCode = 11000
+
+	// kMigrationBatchSize is the number of documents rewritten at once by the
+	// migrations.
+	kMigrationBatchSize = 500
 )
 
+// recentActionsSortOrder sorts the recent actions in decreasing order of
+// activity time, with the blog and comment ids breaking the ties.
+var recentActionsSortOrder = bson.D{
+	{Key: "timeSeconds", Value: -1},
+	{Key: "blogEntry.id", Value: -1},
+	{Key: "comment.id", Value: -1},
+}
+
+// blogVersionsOrder groups the versions of each blog together, the latest
+// modification coming first.
+var blogVersionsOrder = bson.D{
+	{Key: "blogEntry.id", Value: 1},
+	{Key: "blogEntry.modificationTimeSeconds", Value: -1},
+	{Key: "timeSeconds", Value: -1},
+}
+
+// afterCursor returns the clauses of an $or filter that matches the documents
+// coming strictly after the cursor, when sorted in decreasing order of the
+// given fields.
+func afterCursor(fields []string, values []interface{}) bson.A {
+	var clauses bson.A
+	for ind := range fields {
+		clause := bson.M{}
+		for prev := 0; prev < ind; prev++ {
+			clause[fields[prev]] = values[prev]
+		}
+		clause[fields[ind]] = bson.M{"$lt": values[ind]}
+		clauses = append(clauses, clause)
+	}
+	return clauses
+}
+
+// afterActionCursor returns the $or clauses to resume the recent actions
+// after the cursor.
+func afterActionCursor(after *models.Cursor) bson.A {
+	return afterCursor(
+		[]string{"timeSeconds", "blogEntry.id", "comment.id"},
+		[]interface{}{after.TimeSeconds, after.BlogId, after.CommentId})
+}
+
+// onlyDuplicateKeys reports whether the error is a bulk write error, caused by
+// unique indexes only.
+func onlyDuplicateKeys(err error) bool {
+	bulkErr, ok := err.(mongo.BulkWriteException)
+	if !ok || bulkErr.WriteConcernError != nil ||
+		len(bulkErr.WriteErrors) == 0 {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != kDuplicateKeyCode {
+			return false
+		}
+	}
+	return true
+}
+
+// recentActionDocument is the representation of a recent action in MongoDB.
+type recentActionDocument struct {
+	// Key is the natural key of the action, which is unique in the collection.
+	Key string `bson:"key"`
+
+	models.RecentAction `bson:",inline"`
+}
+
+// legacyActionDocument is a recent action inserted before the natural key was
+// introduced, identified by its document id.
+type legacyActionDocument struct {
+	Id                  interface{} `bson:"_id"`
+	models.RecentAction `bson:",inline"`
+}
+
+// contestDocument is the representation of a contest in MongoDB.
+type contestDocument struct {
+	// EndTimeSeconds is persisted so that upcoming contests can be queried
+	// by their end time.
+	EndTimeSeconds int64 `bson:"endTimeSeconds"`
+
+	models.Contest `bson:",inline"`
+}
+
 // mongoStore is the concrete implementation of CodeforcesStore
 type mongoStore struct {
 	mongoClient             *mongo.Client
+	operationTimeout        time.Duration
 	recentActionsCollection *mongo.Collection
 	usersCollection         *mongo.Collection
+	sessionsCollection      *mongo.Collection
+	syncGapsCollection      *mongo.Collection
+	profilesCollection      *mongo.Collection
+	contestsCollection      *mongo.Collection
+	leasesCollection        *mongo.Collection
+	schedulerRunsCollection *mongo.Collection
+	checkpointsCollection   *mongo.Collection
+	blogRevisionsCollection *mongo.Collection
 }
 
-func (store *mongoStore) AddRecentActions(actions []models.RecentAction) error {
-	if actions == nil {
-		return nil
+func (store *mongoStore) AddRecentActions(ctx context.Context,
+	actions []models.RecentAction) (int, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	if len(actions) == 0 {
+		return 0, nil
 	}
 	zap.S().Infof("Persisting a batch of %d actions to the store",
 		len(actions))
 
-	// Convert the actions into generic interface to be compatible with
-	// InsertMany call.
-	var docs []interface{}
+	// Upsert every action by its natural key, so that actions which are
+	// already stored are left untouched.
+	var writes []mongo.WriteModel
 	for _, action := range actions {
-		docs = append(docs, action)
+		doc := recentActionDocument{
+			Key:          action.NaturalKey(),
+			RecentAction: action,
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"key": doc.Key}).
+			SetUpdate(bson.M{"$setOnInsert": doc}).
+			SetUpsert(true))
 	}
 
 	// Bulk update all these documents.
-	_, err := store.recentActionsCollection.InsertMany(context.TODO(), docs)
-	if err != nil {
+	res, err := store.recentActionsCollection.BulkWrite(ctx, writes,
+		options.BulkWrite().SetOrdered(false))
+	// A duplicate key error means that a concurrent writer inserted the same
+	// action first, which is fine since the write is unordered. Any other
+	// error fails the whole batch.
+	if err != nil && !onlyDuplicateKeys(err) {
 		// TODO: Add deep printing.
 		zap.S().Debugf("actions: %+v", actions)
-		return errors.Errorf("bulk insert failed with error [%v]", err)
+		return 0, errors.Errorf("bulk upsert failed with error [%v]", err)
 	}
 
-	return nil
+	inserted := 0
+	if res != nil {
+		inserted = int(res.UpsertedCount)
+	}
+	zap.S().Infof("Persisted %d new actions, skipped %d duplicates",
+		inserted, len(actions)-inserted)
+	return inserted, nil
 }
 
-func (store *mongoStore) QueryRecentActions(startTimestamp, limit int64) (
-	[]models.RecentAction, error) {
+func (store *mongoStore) QueryRecentActions(ctx context.Context, startTimestamp,
+	limit int64, after *models.Cursor) ([]models.RecentAction, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
 	zap.S().Infof("Retrieving all actions after timestamp %d", startTimestamp)
 
 	filter := bson.M{
@@ -68,12 +200,18 @@ func (store *mongoStore) QueryRecentActions(startTimestamp, limit int64) (
 			"$exists": true,
 		},
 	}
+	if after != nil {
+		filter["$or"] = afterActionCursor(after)
+	}
 
 	// Sort by decreasing order of activity time and add limits.
-	opt := options.Find().SetSort(bson.M{"timeSeconds": -1})
-	opt.SetLimit(limit)
+	opt := options.Find().SetSort(recentActionsSortOrder)
+	// MongoDB reads a negative limit as a single batch of that size.
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
 
-	cursor, err := store.recentActionsCollection.Find(context.TODO(), filter, opt)
+	cursor, err := store.recentActionsCollection.Find(ctx, filter, opt)
 	if err != nil {
 		zap.S().Debugf("Filter for querying recent actions: %+v", filter)
 		return nil, errors.Errorf("could not query recent actions with error [%v]",
@@ -81,7 +219,7 @@ func (store *mongoStore) QueryRecentActions(startTimestamp, limit int64) (
 	}
 
 	var actions []models.RecentAction
-	if err := cursor.All(context.TODO(), &actions); err != nil {
+	if err := cursor.All(ctx, &actions); err != nil {
 		return nil, errors.Errorf("could not parse query actions "+
 			"with error [%v]", err)
 	}
@@ -92,13 +230,18 @@ func (store *mongoStore) QueryRecentActions(startTimestamp, limit int64) (
 	return actions, nil
 }
 
-func (store *mongoStore) QueryCommentsFromBlog(id int, startTimestamp, limit int64) (
+func (store *mongoStore) QueryCommentsFromBlog(ctx context.Context, id int,
+	startTimestamp, limit int64, after *models.Cursor) (
 	[]models.Comment, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
 	zap.S().Infof("Retrieving comments from blog %d after timestamp %d",
 		id, startTimestamp)
 
 	// Create a filter to query all comments from a blog with timestamp greater
-	// than or equal to the given timestamp.
+	// than or equal to the given timestamp. Like for the recent actions, the
+	// timestamp is the one of the action.
 	filter := bson.M{
 		"timeSeconds": bson.M{
 			"$gte": startTimestamp,
@@ -108,15 +251,26 @@ func (store *mongoStore) QueryCommentsFromBlog(id int, startTimestamp, limit int
 			"$exists": true,
 		},
 	}
+	if after != nil {
+		filter["$or"] = afterCursor(
+			[]string{"comment.creationTimeSeconds", "comment.id"},
+			[]interface{}{after.TimeSeconds, after.CommentId})
+	}
 
 	// Only include the "comment" field in the output.
 	opt := options.Find().SetProjection(bson.M{"comment": 1})
 
-	// Sort by decreasing order of activity time and add limits.
-	opt.SetSort(bson.M{"timeSeconds": -1})
-	opt.SetLimit(limit)
+	// Sort by decreasing order of creation time and add limits.
+	opt.SetSort(bson.D{
+		{Key: "comment.creationTimeSeconds", Value: -1},
+		{Key: "comment.id", Value: -1},
+	})
+	// MongoDB reads a negative limit as a single batch of that size.
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
 
-	cursor, err := store.recentActionsCollection.Find(context.TODO(), filter, opt)
+	cursor, err := store.recentActionsCollection.Find(ctx, filter, opt)
 	if err != nil {
 		zap.S().Debugf("Filter for querying comments from blogs: %+v", filter)
 		return nil, errors.Errorf("could not query comments with error [%v]",
@@ -124,7 +278,7 @@ func (store *mongoStore) QueryCommentsFromBlog(id int, startTimestamp, limit int
 	}
 
 	var actions []models.RecentAction
-	if err := cursor.All(context.TODO(), &actions); err != nil {
+	if err := cursor.All(ctx, &actions); err != nil {
 		return nil, errors.Errorf("could not decode actions "+
 			"with error [%v]", err)
 	}
@@ -144,12 +298,86 @@ func (store *mongoStore) QueryCommentsFromBlog(id int, startTimestamp, limit int
 	return comments, nil
 }
 
-func (store *mongoStore) QueryAllUniqueBlogs(startTimestamp, limit int64) (
+func (store *mongoStore) QueryAllUniqueBlogs(ctx context.Context,
+	startTimestamp, limit int64, after *models.Cursor) (
 	[]models.BlogEntry, error) {
-	return nil, nil
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	zap.S().Infof("Retrieving all unique blogs created after timestamp %d",
+		startTimestamp)
+
+	// The creation time and the id of a blog are the same in all of its
+	// versions, so the cursor is matched before the versions are grouped.
+	match := bson.M{
+		"blogEntry.creationTimeSeconds": bson.M{
+			"$gte": startTimestamp,
+		},
+	}
+	if after != nil {
+		match["$or"] = afterCursor(
+			[]string{"blogEntry.creationTimeSeconds", "blogEntry.id"},
+			[]interface{}{after.TimeSeconds, after.BlogId})
+	}
+	pipeline := []bson.M{
+		{
+			"$match": match,
+		},
+		// Sort the versions of each blog so that the latest one comes first,
+		// following the blogVersionsOrder index.
+		{
+			"$sort": blogVersionsOrder,
+		},
+		{
+			"$group": bson.M{
+				"_id": "$blogEntry.id",
+				"blogEntry": bson.M{
+					"$first": "$blogEntry",
+				},
+			},
+		},
+		{
+			"$replaceRoot": bson.M{
+				"newRoot": "$blogEntry",
+			},
+		},
+	}
+	// Sort by decreasing order of creation time and add limits.
+	pipeline = append(pipeline, bson.M{
+		"$sort": bson.D{
+			{Key: "creationTimeSeconds", Value: -1},
+			{Key: "id", Value: -1},
+		},
+	})
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+
+	// The versions of all the blogs may not fit in the memory allowed for a
+	// sort, in which case it spills to disk.
+	cursor, err := store.recentActionsCollection.Aggregate(ctx,
+		pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		zap.S().Debugf("Pipeline for querying unique blogs: %+v", pipeline)
+		return nil, errors.Errorf("could not query unique blogs "+
+			"with error [%v]", err)
+	}
+
+	var blogs []models.BlogEntry
+	if err := cursor.All(ctx, &blogs); err != nil {
+		return nil, errors.Errorf("could not decode blogs with error [%v]",
+			err)
+	}
+
+	zap.S().Infof("Retrieved a batch of %d unique blogs", len(blogs))
+	return blogs, nil
 }
 
-func (store *mongoStore) LastRecordedTimestampForRecentActions() int64 {
+func (store *mongoStore) LastRecordedTimestampForRecentActions(
+	ctx context.Context) int64 {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
 	// Create the filter to compute the maximum value of a field.
 	filter := []bson.M{{
 		"$group": bson.M{
@@ -161,7 +389,7 @@ func (store *mongoStore) LastRecordedTimestampForRecentActions() int64 {
 	}
 
 	// Make an aggregation call.
-	cursor, err := store.recentActionsCollection.Aggregate(context.TODO(),
+	cursor, err := store.recentActionsCollection.Aggregate(ctx,
 		filter)
 	if err != nil {
 		zap.S().Errorf("Querying the max recorded activity timestamp failed "+
@@ -170,7 +398,7 @@ func (store *mongoStore) LastRecordedTimestampForRecentActions() int64 {
 	}
 
 	// The result set should only contain one document. Decode it.
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		res := struct {
 			Max int64 `bson:"max"`
 		}{}
@@ -184,7 +412,414 @@ func (store *mongoStore) LastRecordedTimestampForRecentActions() int64 {
 	return 0
 }
 
-func (store *mongoStore) AddUser(user *models.User) error {
+func (store *mongoStore) AddSyncGap(ctx context.Context,
+	gap *models.SyncGap) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	if gap == nil {
+		return nil
+	}
+	zap.S().Infof("Recording a gap between timestamps %d and %d",
+		gap.StartTimestamp, gap.EndTimestamp)
+
+	if _, err := store.syncGapsCollection.InsertOne(
+		ctx, gap); err != nil {
+		return errors.Errorf("could not insert sync gap with error [%v]", err)
+	}
+	return nil
+}
+
+func (store *mongoStore) QuerySyncGaps(ctx context.Context, limit int64) (
+	[]models.SyncGap, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	// Sort by decreasing order of detection time and add limits.
+	opt := options.Find().SetSort(bson.M{"detectedAt": -1})
+	// MongoDB reads a negative limit as a single batch of that size.
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
+
+	cursor, err := store.syncGapsCollection.Find(ctx, bson.M{}, opt)
+	if err != nil {
+		return nil, errors.Errorf("could not query sync gaps with error [%v]",
+			err)
+	}
+
+	var gaps []models.SyncGap
+	if err := cursor.All(ctx, &gaps); err != nil {
+		return nil, errors.Errorf("could not decode sync gaps "+
+			"with error [%v]", err)
+	}
+	return gaps, nil
+}
+
+func (store *mongoStore) AddSchedulerRun(ctx context.Context,
+	run *models.SchedulerRun) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	if run == nil {
+		return nil
+	}
+
+	if _, err := store.schedulerRunsCollection.InsertOne(
+		ctx, run); err != nil {
+		return errors.Errorf("could not insert scheduler run "+
+			"with error [%v]", err)
+	}
+	return nil
+}
+
+func (store *mongoStore) QuerySchedulerRuns(ctx context.Context,
+	limit int64) ([]models.SchedulerRun, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	// Sort by decreasing order of start time and add limits.
+	opt := options.Find().SetSort(bson.M{"startedAt": -1})
+	// MongoDB reads a negative limit as a single batch of that size.
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
+
+	cursor, err := store.schedulerRunsCollection.Find(ctx, bson.M{}, opt)
+	if err != nil {
+		return nil, errors.Errorf("could not query scheduler runs "+
+			"with error [%v]", err)
+	}
+
+	var runs []models.SchedulerRun
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, errors.Errorf("could not decode scheduler runs "+
+			"with error [%v]", err)
+	}
+	return runs, nil
+}
+
+func (store *mongoStore) SaveCheckpoint(ctx context.Context,
+	checkpoint *models.Checkpoint) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := store.checkpointsCollection.ReplaceOne(ctx,
+		bson.M{"name": checkpoint.Name}, checkpoint,
+		options.Replace().SetUpsert(true)); err != nil {
+		return errors.Errorf("could not save checkpoint %s with error [%v]",
+			checkpoint.Name, err)
+	}
+	return nil
+}
+
+func (store *mongoStore) QueryCheckpoint(ctx context.Context, name string) (
+	*models.Checkpoint, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	checkpoint := new(models.Checkpoint)
+	err := store.checkpointsCollection.FindOne(ctx,
+		bson.M{"name": name}).Decode(checkpoint)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Errorf("could not query checkpoint %s "+
+			"with error [%v]", name, err)
+	}
+	return checkpoint, nil
+}
+
+func (store *mongoStore) AddBlogRevision(ctx context.Context,
+	revision *models.BlogRevision) (bool, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	// The revision is only inserted if the blog does not have it yet, so
+	// that the time at which it was first seen is kept.
+	res, err := store.blogRevisionsCollection.UpdateOne(ctx,
+		bson.M{"blogId": revision.BlogId, "id": revision.Id},
+		bson.M{"$setOnInsert": revision},
+		options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// Another replica inserted it concurrently.
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Errorf("could not insert revision %s of blog %d "+
+			"with error [%v]", revision.Id, revision.BlogId, err)
+	}
+	return res.UpsertedCount > 0, nil
+}
+
+func (store *mongoStore) QueryBlogRevisions(ctx context.Context,
+	blogId int) ([]models.BlogRevision, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	opt := options.Find().SetSort(bson.D{
+		{Key: "modificationTimeSeconds", Value: 1},
+		{Key: "seenAt", Value: 1},
+	})
+	cursor, err := store.blogRevisionsCollection.Find(ctx,
+		bson.M{"blogId": blogId}, opt)
+	if err != nil {
+		return nil, errors.Errorf("could not query revisions of blog %d "+
+			"with error [%v]", blogId, err)
+	}
+
+	var revisions []models.BlogRevision
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, errors.Errorf("could not decode revisions of blog %d "+
+			"with error [%v]", blogId, err)
+	}
+	return revisions, nil
+}
+
+func (store *mongoStore) QueryBlogRevision(ctx context.Context, blogId int,
+	id string) (*models.BlogRevision, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	revision := new(models.BlogRevision)
+	err := store.blogRevisionsCollection.FindOne(ctx,
+		bson.M{"blogId": blogId, "id": id}).Decode(revision)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Errorf("could not query revision %s of blog %d "+
+			"with error [%v]", id, blogId, err)
+	}
+	return revision, nil
+}
+
+func (store *mongoStore) AddProfiles(ctx context.Context,
+	profiles []models.CodeforcesUser) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	if len(profiles) == 0 {
+		return nil
+	}
+
+	var writes []mongo.WriteModel
+	for _, profile := range profiles {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"handle": profile.Handle}).
+			SetReplacement(profile).
+			SetUpsert(true))
+	}
+
+	if _, err := store.profilesCollection.BulkWrite(ctx, writes,
+		options.BulkWrite().SetOrdered(false)); err != nil {
+		return errors.Errorf("could not upsert profiles with error [%v]", err)
+	}
+	return nil
+}
+
+func (store *mongoStore) QueryProfiles(ctx context.Context, handles ...string) (
+	[]models.CodeforcesUser, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	if len(handles) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := store.profilesCollection.Find(ctx,
+		bson.M{"handle": bson.M{"$in": handles}})
+	if err != nil {
+		return nil, errors.Errorf("could not query profiles with error [%v]",
+			err)
+	}
+
+	var profiles []models.CodeforcesUser
+	if err := cursor.All(ctx, &profiles); err != nil {
+		return nil, errors.Errorf("could not decode profiles "+
+			"with error [%v]", err)
+	}
+	return profiles, nil
+}
+
+func (store *mongoStore) AddContests(ctx context.Context,
+	contests []models.Contest) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	if len(contests) == 0 {
+		return nil
+	}
+
+	var writes []mongo.WriteModel
+	for _, contest := range contests {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"id": contest.Id}).
+			SetReplacement(contestDocument{
+				EndTimeSeconds: contest.EndTimeSeconds(),
+				Contest:        contest,
+			}).
+			SetUpsert(true))
+	}
+
+	if _, err := store.contestsCollection.BulkWrite(ctx, writes,
+		options.BulkWrite().SetOrdered(false)); err != nil {
+		return errors.Errorf("could not upsert contests with error [%v]", err)
+	}
+	return nil
+}
+
+func (store *mongoStore) QueryUpcomingContests(ctx context.Context,
+	timestamp int64) ([]models.Contest, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	// Contests without a start time have a zero end time, and are always
+	// filtered out.
+	filter := bson.M{
+		"startTimeSeconds": bson.M{"$gt": 0},
+		"endTimeSeconds":   bson.M{"$gte": timestamp},
+	}
+	opt := options.Find().SetSort(bson.D{
+		{Key: "startTimeSeconds", Value: 1},
+		{Key: "id", Value: 1},
+	})
+
+	cursor, err := store.contestsCollection.Find(ctx, filter, opt)
+	if err != nil {
+		return nil, errors.Errorf("could not query contests with error [%v]",
+			err)
+	}
+
+	var docs []contestDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, errors.Errorf("could not decode contests "+
+			"with error [%v]", err)
+	}
+
+	var contests []models.Contest
+	for _, doc := range docs {
+		contests = append(contests, doc.Contest)
+	}
+	return contests, nil
+}
+
+func (store *mongoStore) AcquireLease(ctx context.Context,
+	name, holder string, now time.Time, ttl time.Duration) (
+	*models.Lease, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	opt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	lease := new(models.Lease)
+
+	// Renew the lease if the holder still holds it.
+	err := store.leasesCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"name":      name,
+			"holder":    holder,
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{
+			"renewedAt": now,
+			"expiresAt": now.Add(ttl),
+		}}, opt).Decode(lease)
+	if err == nil {
+		return lease, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, errors.Errorf("could not renew lease %s "+
+			"with error [%v]", name, err)
+	}
+
+	// Otherwise, take it over if it has expired, or create it if it was
+	// never acquired. The unique index on the name makes sure that only
+	// one of the competing holders gets it.
+	err = store.leasesCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"name":      name,
+			"expiresAt": bson.M{"$lte": now},
+		},
+		bson.M{
+			"$set": bson.M{
+				"holder":     holder,
+				"acquiredAt": now,
+				"renewedAt":  now,
+				"expiresAt":  now.Add(ttl),
+			},
+			"$inc": bson.M{"token": 1},
+		}, opt).Decode(lease)
+	if err == nil {
+		return lease, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, errors.Errorf("could not take over lease %s "+
+			"with error [%v]", name, err)
+	}
+
+	created := models.Lease{
+		Name:       name,
+		Holder:     holder,
+		Token:      1,
+		AcquiredAt: now,
+		RenewedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	_, err = store.leasesCollection.InsertOne(ctx, created)
+	if err == nil {
+		return &created, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, errors.Errorf("could not create lease %s "+
+			"with error [%v]", name, err)
+	}
+
+	// Someone else holds the lease.
+	return store.QueryLease(ctx, name)
+}
+
+func (store *mongoStore) ReleaseLease(ctx context.Context,
+	name, holder string, token int64, now time.Time) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"name":      name,
+		"holder":    holder,
+		"token":     token,
+		"expiresAt": bson.M{"$gt": now},
+	}
+	if _, err := store.leasesCollection.UpdateOne(ctx, filter,
+		bson.M{"$set": bson.M{"expiresAt": now}}); err != nil {
+		return errors.Errorf("could not release lease %s with error [%v]",
+			name, err)
+	}
+	return nil
+}
+
+func (store *mongoStore) QueryLease(ctx context.Context, name string) (
+	*models.Lease, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	lease := new(models.Lease)
+	err := store.leasesCollection.FindOne(ctx,
+		bson.M{"name": name}).Decode(lease)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Errorf("could not query lease %s with error [%v]",
+			name, err)
+	}
+	return lease, nil
+}
+
+func (store *mongoStore) AddUser(ctx context.Context, user *models.User) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
 	if user == nil {
 		return nil
 	}
@@ -192,14 +827,28 @@ func (store *mongoStore) AddUser(user *models.User) error {
 		user.Username, user.Uuid)
 
 	if _, err := store.usersCollection.InsertOne(
-		context.TODO(), user); err != nil {
+		ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// The unique indexes don't tell which key clashed, hence look
+			// for the username first, and blame the uuid otherwise.
+			if _, err := store.QueryUserByUsername(ctx,
+				user.Username); err == nil {
+				return &cfstore.AlreadyExistsError{Field: "username",
+					Value: user.Username}
+			}
+			return &cfstore.AlreadyExistsError{Field: "uuid", Value: user.Uuid}
+		}
 		return errors.Errorf("could not insert user: %+v to the store "+
 			"with error [%v]", *user, err)
 	}
 	return nil
 }
 
-func (store *mongoStore) QueryUserByUuid(uuid string) (*models.User, error) {
+func (store *mongoStore) QueryUserByUuid(ctx context.Context, uuid string) (
+	*models.User, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
 	zap.S().Infof("Querying the store for uuid %s", uuid)
 	// Create the filter to query the user.
 	filter := bson.M{
@@ -207,7 +856,7 @@ func (store *mongoStore) QueryUserByUuid(uuid string) (*models.User, error) {
 	}
 
 	// Query the store.
-	res := store.usersCollection.FindOne(context.TODO(), filter)
+	res := store.usersCollection.FindOne(ctx, filter)
 	if res.Err() != nil {
 		return nil, errors.Errorf("could not query user with uuid %s "+
 			"with error [%v]", uuid, res.Err())
@@ -223,12 +872,69 @@ func (store *mongoStore) QueryUserByUuid(uuid string) (*models.User, error) {
 	return user, nil
 }
 
-func (store *mongoStore) QueryRecentActionsForUser(uuid string,
-	startTimestamp, limit int64) ([]models.RecentAction, error) {
+func (store *mongoStore) QueryUserByUsername(ctx context.Context,
+	username string) (*models.User, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	zap.S().Infof("Querying the store for username %s", username)
+	filter := bson.M{
+		"username": username,
+	}
+
+	res := store.usersCollection.FindOne(ctx, filter)
+	if res.Err() != nil {
+		return nil, errors.Errorf("could not query user with username %s "+
+			"with error [%v]", username, res.Err())
+	}
+
+	user := new(models.User)
+	if err := res.Decode(user); err != nil {
+		return nil, errors.Errorf("could not decode result to user "+
+			"with error [%v], possibly the user does not exist", err)
+	}
+
+	return user, nil
+}
+
+func (store *mongoStore) UpdatePassword(ctx context.Context, uuid,
+	hashedPassword string) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	zap.S().Infof("Updating the password of user %s", uuid)
+
+	filter := bson.M{
+		"uuid": uuid,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"hashedPassword": hashedPassword,
+		},
+	}
+
+	res, err := store.usersCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return errors.Errorf("could not update the password of user %s "+
+			"with error [%v]", uuid, err)
+	}
+	if res.MatchedCount == 0 {
+		return errors.Errorf("user %s does not exist", uuid)
+	}
+
+	return nil
+}
+
+func (store *mongoStore) QueryRecentActionsForUser(ctx context.Context,
+	uuid string, startTimestamp, limit int64, after *models.Cursor) (
+	[]models.RecentAction, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
 	zap.S().Infof("Retrieving all actions for user %s after timestamp %d",
 		uuid, startTimestamp)
 
-	user, err := store.QueryUserByUuid(uuid)
+	user, err := store.QueryUserByUuid(ctx, uuid)
 	if err != nil {
 		return nil, errors.Errorf("uuid to user conversion failed with eror [%v]",
 			err)
@@ -250,13 +956,19 @@ func (store *mongoStore) QueryRecentActionsForUser(uuid string,
 			"$exists": true,
 		},
 	}
+	if after != nil {
+		filter["$or"] = afterActionCursor(after)
+	}
 
 	// Sort by decreasing order of activity time and add limits.
-	opt := options.Find().SetSort(bson.M{"timeSeconds": -1})
-	opt.SetLimit(limit)
+	opt := options.Find().SetSort(recentActionsSortOrder)
+	// MongoDB reads a negative limit as a single batch of that size.
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
 
 	// Query all the documents.
-	cursor, err := store.recentActionsCollection.Find(context.TODO(), filter, opt)
+	cursor, err := store.recentActionsCollection.Find(ctx, filter, opt)
 	if err != nil {
 		zap.S().Debugf("Filter for querying recent actions: %+v", filter)
 		return nil,
@@ -265,7 +977,7 @@ func (store *mongoStore) QueryRecentActionsForUser(uuid string,
 
 	// Unmarshal the results.
 	var actions []models.RecentAction
-	if err := cursor.All(context.TODO(), &actions); err != nil {
+	if err := cursor.All(ctx, &actions); err != nil {
 		return nil, errors.Errorf("could not parse query actions "+
 			"with error [%v]", err)
 	}
@@ -277,7 +989,11 @@ func (store *mongoStore) QueryRecentActionsForUser(uuid string,
 	return actions, nil
 }
 
-func (store *mongoStore) SubscribeToBlogs(uuid string, ids ...int) error {
+func (store *mongoStore) SubscribeToBlogs(ctx context.Context, uuid string,
+	ids ...int) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
 	zap.S().Infof("User %s is subscribing to blogs %v", uuid, ids)
 
 	// Create the filters to query and update the user's data.
@@ -292,7 +1008,7 @@ func (store *mongoStore) SubscribeToBlogs(uuid string, ids ...int) error {
 		},
 	}
 
-	_, err := store.updateSingleUser(findFilter, updateFilter)
+	_, err := store.updateSingleUser(ctx, findFilter, updateFilter)
 	if err != nil {
 		return errors.Errorf("user %s could not subscribe to blogs "+
 			"with error [%v]", uuid, err)
@@ -301,7 +1017,11 @@ func (store *mongoStore) SubscribeToBlogs(uuid string, ids ...int) error {
 	return nil
 }
 
-func (store *mongoStore) UnsubscribeFromBlogs(uuid string, ids ...int) error {
+func (store *mongoStore) UnsubscribeFromBlogs(ctx context.Context, uuid string,
+	ids ...int) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
 	zap.S().Infof("User %s is unsubscribing from blogs %v", uuid, ids)
 
 	// Create the filters to query and update the user's data.
@@ -314,7 +1034,7 @@ func (store *mongoStore) UnsubscribeFromBlogs(uuid string, ids ...int) error {
 		},
 	}
 
-	_, err := store.updateSingleUser(findFilter, updateFilter)
+	_, err := store.updateSingleUser(ctx, findFilter, updateFilter)
 	if err != nil {
 		return errors.Errorf("user %s could not unsubscribe from blogs "+
 			"with error [%v]", uuid, err)
@@ -323,18 +1043,163 @@ func (store *mongoStore) UnsubscribeFromBlogs(uuid string, ids ...int) error {
 	return nil
 }
 
+func (store *mongoStore) AddFeedToken(ctx context.Context, uuid string,
+	token models.FeedToken) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	zap.S().Infof("Granting feed token %s to user %s", token.Id, uuid)
+
+	findFilter := bson.M{
+		"uuid": uuid,
+	}
+	updateFilter := bson.M{
+		"$push": bson.M{
+			"feedTokens": token,
+		},
+	}
+
+	if _, err := store.updateSingleUser(ctx, findFilter,
+		updateFilter); err != nil {
+		return errors.Errorf("could not grant feed token to user %s "+
+			"with error [%v]", uuid, err)
+	}
+
+	return nil
+}
+
+func (store *mongoStore) RevokeFeedToken(ctx context.Context, uuid,
+	tokenID string) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	zap.S().Infof("Revoking feed token %s of user %s", tokenID, uuid)
+
+	// Match on the token as well, so that revoking an unknown token is
+	// reported as an error.
+	findFilter := bson.M{
+		"uuid":          uuid,
+		"feedTokens.id": tokenID,
+	}
+	updateFilter := bson.M{
+		"$pull": bson.M{
+			"feedTokens": bson.M{
+				"id": tokenID,
+			},
+		},
+	}
+
+	if _, err := store.updateSingleUser(ctx, findFilter,
+		updateFilter); err != nil {
+		return errors.Errorf("could not revoke feed token %s of user %s "+
+			"with error [%v]", tokenID, uuid, err)
+	}
+
+	return nil
+}
+
+func (store *mongoStore) QueryUserByFeedToken(ctx context.Context,
+	hashedToken string) (*models.User, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	// For security reasons, don't log the token.
+	zap.S().Infof("Querying the store for a feed token")
+	filter := bson.M{
+		"feedTokens.hashedToken": hashedToken,
+	}
+
+	res := store.usersCollection.FindOne(ctx, filter)
+	if res.Err() != nil {
+		return nil, errors.Errorf("could not query user by feed token "+
+			"with error [%v]", res.Err())
+	}
+
+	user := new(models.User)
+	if err := res.Decode(user); err != nil {
+		return nil, errors.Errorf("could not decode result to user "+
+			"with error [%v], possibly the user does not exist", err)
+	}
+
+	return user, nil
+}
+
+func (store *mongoStore) AddSession(ctx context.Context,
+	session *models.Session) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	if session == nil {
+		return nil
+	}
+	zap.S().Infof("Adding a session for user %s to the store", session.Uuid)
+
+	if _, err := store.sessionsCollection.InsertOne(
+		ctx, session); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return &cfstore.AlreadyExistsError{Field: "hashedToken",
+				Value: session.HashedToken}
+		}
+		return errors.Errorf("could not insert session of user %s "+
+			"with error [%v]", session.Uuid, err)
+	}
+	return nil
+}
+
+func (store *mongoStore) QuerySession(ctx context.Context, hashedToken string) (
+	*models.Session, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"hashedToken": hashedToken,
+	}
+
+	res := store.sessionsCollection.FindOne(ctx, filter)
+	if res.Err() != nil {
+		return nil, errors.Errorf("could not query session "+
+			"with error [%v]", res.Err())
+	}
+
+	session := new(models.Session)
+	if err := res.Decode(session); err != nil {
+		return nil, errors.Errorf("could not decode result to session "+
+			"with error [%v], possibly the session does not exist", err)
+	}
+
+	return session, nil
+}
+
+func (store *mongoStore) DeleteSession(ctx context.Context,
+	hashedToken string) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"hashedToken": hashedToken,
+	}
+
+	res, err := store.sessionsCollection.DeleteOne(ctx, filter)
+	if err != nil {
+		return errors.Errorf("could not delete session with error [%v]", err)
+	}
+	if res.DeletedCount == 0 {
+		return errors.Errorf("session does not exist")
+	}
+
+	return nil
+}
+
 // updateSingleUser is a utility function to update a single user according to
 // the filter provided.
 //
-// It returns the document as it was before the update.
-func (store *mongoStore) updateSingleUser(findFilter, updateFilter interface{}) (
-	oldUser *models.User, err error) {
-	zap.S().Infof("Updating single user using the below filters")
-	zap.S().Infof("find filter %+v", findFilter)
-	zap.S().Infof("update filter %+v", updateFilter)
-
+// It returns the document as it was before the update. The filters are not
+// logged, since they can hold secrets such as the hash of a feed token: the
+// callers log the user and the operation instead.
+func (store *mongoStore) updateSingleUser(ctx context.Context, findFilter,
+	updateFilter interface{}) (oldUser *models.User, err error) {
 	// Find the user's entry and update it.
-	res := store.usersCollection.FindOneAndUpdate(context.TODO(),
+	res := store.usersCollection.FindOneAndUpdate(ctx,
 		findFilter, updateFilter)
 	if res.Err() != nil {
 		return nil, errors.Errorf("updation of single user failed "+
@@ -351,15 +1216,351 @@ func (store *mongoStore) updateSingleUser(findFilter, updateFilter interface{})
 	return oldUser, nil
 }
 
-// NewMongoStore creates a new instance of the mongo store.
-func NewMongoStore(mongoURI, databaseName string) (store.CodeforcesStore, error) {
+// migrateActionKeys sets the natural key of the recent actions inserted before
+// it was introduced. Such actions may be stored several times, in which case
+// only the first copy is kept.
+func (store *mongoStore) migrateActionKeys(ctx context.Context) error {
+	cursor, err := store.recentActionsCollection.Find(ctx, bson.M{
+		"key": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return errors.Errorf("could not query actions without a key "+
+			"with error [%v]", err)
+	}
+	defer cursor.Close(ctx)
+
+	migrated, removed := 0, 0
+	var batch []legacyActionDocument
+	flush := func() error {
+		updated, deleted, err := store.migrateActionKeysBatch(ctx, batch)
+		migrated += updated
+		removed += deleted
+		batch = batch[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		var doc legacyActionDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return errors.Errorf("could not decode action with error [%v]",
+				err)
+		}
+		batch = append(batch, doc)
+		if len(batch) == kMigrationBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return errors.Errorf("could not iterate over actions without a key "+
+			"with error [%v]", err)
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+
+	if migrated > 0 || removed > 0 {
+		zap.S().Infof("Set the key of %d legacy actions, removed %d duplicates",
+			migrated, removed)
+	}
+	return nil
+}
+
+// migrateActionKeysBatch sets the natural key of the given actions, and
+// removes the ones whose key is already taken. It returns the number of
+// actions updated and removed.
+func (store *mongoStore) migrateActionKeysBatch(ctx context.Context,
+	batch []legacyActionDocument) (int, int, error) {
+	keys := make([]string, 0, len(batch))
+	for _, doc := range batch {
+		keys = append(keys, doc.NaturalKey())
+	}
+
+	// The keys taken by the actions inserted since the key was introduced.
+	cursor, err := store.recentActionsCollection.Find(ctx,
+		bson.M{"key": bson.M{"$in": keys}},
+		options.Find().SetProjection(bson.M{"key": 1}))
+	if err != nil {
+		return 0, 0, errors.Errorf("could not query action keys "+
+			"with error [%v]", err)
+	}
+	var taken []struct {
+		Key string `bson:"key"`
+	}
+	if err := cursor.All(ctx, &taken); err != nil {
+		return 0, 0, errors.Errorf("could not decode action keys "+
+			"with error [%v]", err)
+	}
+	seen := make(map[string]bool)
+	for _, doc := range taken {
+		seen[doc.Key] = true
+	}
+
+	var writes []mongo.WriteModel
+	updated, deleted := 0, 0
+	for ind, doc := range batch {
+		filter := bson.M{"_id": doc.Id}
+		if seen[keys[ind]] {
+			writes = append(writes,
+				mongo.NewDeleteOneModel().SetFilter(filter))
+			deleted++
+			continue
+		}
+		seen[keys[ind]] = true
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(bson.M{"$set": bson.M{"key": keys[ind]}}))
+		updated++
+	}
+
+	// A replica migrating the same actions concurrently may take a key first,
+	// in which case the unique index rejects the update. The action is then
+	// left without a key, and removed by the next migration.
+	if _, err := store.recentActionsCollection.BulkWrite(ctx, writes,
+		options.BulkWrite().SetOrdered(false)); err != nil &&
+		!onlyDuplicateKeys(err) {
+		return 0, 0, errors.Errorf("could not set the key of actions "+
+			"with error [%v]", err)
+	}
+	return updated, deleted, nil
+}
+
+// checkDuplicateUsernames returns an error listing the usernames shared by
+// several users, if any.
+func (store *mongoStore) checkDuplicateUsernames(ctx context.Context) error {
+	pipeline := []bson.M{
+		{
+			"$group": bson.M{
+				"_id":   "$username",
+				"count": bson.M{"$sum": 1},
+			},
+		},
+		{
+			"$match": bson.M{
+				"count": bson.M{"$gt": 1},
+			},
+		},
+	}
+	cursor, err := store.usersCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return errors.Errorf("could not look for duplicate usernames "+
+			"with error [%v]", err)
+	}
+
+	var duplicates []struct {
+		Username string `bson:"_id"`
+		Count    int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return errors.Errorf("could not decode duplicate usernames "+
+			"with error [%v]", err)
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	var usernames []string
+	for _, duplicate := range duplicates {
+		zap.S().Errorf("Username %s is shared by %d users",
+			duplicate.Username, duplicate.Count)
+		usernames = append(usernames, duplicate.Username)
+	}
+	return errors.Errorf("usernames %v are shared by several users, rename "+
+		"them before the unique index on usernames can be created", usernames)
+}
+
+// createIndexes creates the indexes needed by the queries and the uniqueness
+// constraints of the store. It is a no-op for indexes that already exist.
+func (store *mongoStore) createIndexes(ctx context.Context) error {
+	// Documents inserted before the natural key was introduced don't have it
+	// until they are migrated, hence the uniqueness is only enforced on the
+	// documents having one.
+	if err := store.migrateActionKeys(ctx); err != nil {
+		return err
+	}
+	recentActionIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{
+					"key": bson.M{"$exists": true},
+				}),
+		},
+		{
+			Keys: recentActionsSortOrder,
+		},
+		{
+			Keys: blogVersionsOrder,
+		},
+	}
+	if _, err := store.recentActionsCollection.Indexes().CreateMany(
+		ctx, recentActionIndexes); err != nil {
+		return errors.Errorf("could not create indexes on recent actions "+
+			"with error [%v]", err)
+	}
+
+	// Users registered before usernames were unique may clash, in which case
+	// the index can't be built. Report them, they must be renamed by hand.
+	if err := store.checkDuplicateUsernames(ctx); err != nil {
+		return err
+	}
+	userIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "uuid", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "feedTokens.hashedToken", Value: 1}},
+		},
+	}
+	if _, err := store.usersCollection.Indexes().CreateMany(ctx,
+		userIndexes); err != nil {
+		return errors.Errorf("could not create indexes on users "+
+			"with error [%v]", err)
+	}
+
+	// Let MongoDB purge the sessions as soon as they expire.
+	sessionIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hashedToken", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	if _, err := store.sessionsCollection.Indexes().CreateMany(ctx,
+		sessionIndexes); err != nil {
+		return errors.Errorf("could not create indexes on sessions "+
+			"with error [%v]", err)
+	}
+
+	profileIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "handle", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := store.profilesCollection.Indexes().CreateOne(ctx,
+		profileIndex); err != nil {
+		return errors.Errorf("could not create indexes on profiles "+
+			"with error [%v]", err)
+	}
+
+	schedulerRunIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "startedAt", Value: -1}},
+	}
+	if _, err := store.schedulerRunsCollection.Indexes().CreateOne(ctx,
+		schedulerRunIndex); err != nil {
+		return errors.Errorf("could not create indexes on scheduler runs "+
+			"with error [%v]", err)
+	}
+
+	checkpointIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := store.checkpointsCollection.Indexes().CreateOne(ctx,
+		checkpointIndex); err != nil {
+		return errors.Errorf("could not create indexes on checkpoints "+
+			"with error [%v]", err)
+	}
+
+	blogRevisionIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "blogId", Value: 1},
+				{Key: "id", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "blogId", Value: 1},
+				{Key: "modificationTimeSeconds", Value: 1},
+			},
+		},
+	}
+	if _, err := store.blogRevisionsCollection.Indexes().CreateMany(ctx,
+		blogRevisionIndexes); err != nil {
+		return errors.Errorf("could not create indexes on blog revisions "+
+			"with error [%v]", err)
+	}
+
+	leaseIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := store.leasesCollection.Indexes().CreateOne(ctx,
+		leaseIndex); err != nil {
+		return errors.Errorf("could not create indexes on leases "+
+			"with error [%v]", err)
+	}
+
+	contestIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "endTimeSeconds", Value: 1}},
+		},
+	}
+	if _, err := store.contestsCollection.Indexes().CreateMany(ctx,
+		contestIndexes); err != nil {
+		return errors.Errorf("could not create indexes on contests "+
+			"with error [%v]", err)
+	}
+
+	return nil
+}
+
+// Option customizes the mongo store.
+type Option func(*mongoStore)
+
+// WithOperationTimeout sets the deadline of every store operation, on top of
+// the deadline of the context passed to it. A non-positive timeout disables
+// the deadline.
+func WithOperationTimeout(timeout time.Duration) Option {
+	return func(store *mongoStore) {
+		store.operationTimeout = timeout
+	}
+}
+
+func (store *mongoStore) Close(ctx context.Context) error {
+	zap.S().Info("Disconnecting from MongoDB")
+	if err := store.mongoClient.Disconnect(ctx); err != nil {
+		return errors.Errorf("could not disconnect from mongo "+
+			"with error [%v]", err)
+	}
+	return nil
+}
+
+// withTimeout derives the context of a single store operation.
+func (store *mongoStore) withTimeout(ctx context.Context) (
+	context.Context, context.CancelFunc) {
+	if store.operationTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, store.operationTimeout)
+}
+
+// NewMongoStore creates a new instance of the mongo store. The context only
+// bounds the connection to the server and the creation of the indexes.
+func NewMongoStore(ctx context.Context, mongoURI, databaseName string,
+	opts ...Option) (cfstore.CodeforcesStore, error) {
 	// For security reasons, don't log the mongoURI.
 	zap.S().Infof("Attempting to create a new mongo store. "+
 		"DatabaseName = %s", databaseName)
 
 	// Create a new client and connect to the server
 	client, err := mongo.Connect(
-		context.TODO(),
+		ctx,
 		options.Client().ApplyURI(mongoURI),
 	)
 	if err != nil {
@@ -368,16 +1569,41 @@ func NewMongoStore(mongoURI, databaseName string) (store.CodeforcesStore, error)
 	}
 
 	// Ping the primary
-	if err := client.Ping(context.TODO(), readpref.Primary()); err != nil {
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
 		return nil, errors.Errorf("could not ping primary with error [%v]", err)
 	}
 
 	mStore := new(mongoStore)
 	mStore.mongoClient = client
+	mStore.operationTimeout = kDefaultOperationTimeout
+	for _, opt := range opts {
+		opt(mStore)
+	}
 	mStore.recentActionsCollection = client.Database(databaseName).
 		Collection(kRecentActionsCollectionName)
 	mStore.usersCollection = client.Database(databaseName).
 		Collection(kUsersCollectionName)
+	mStore.sessionsCollection = client.Database(databaseName).
+		Collection(kSessionsCollectionName)
+	mStore.syncGapsCollection = client.Database(databaseName).
+		Collection(kSyncGapsCollectionName)
+	mStore.profilesCollection = client.Database(databaseName).
+		Collection(kProfilesCollectionName)
+	mStore.contestsCollection = client.Database(databaseName).
+		Collection(kContestsCollectionName)
+	mStore.leasesCollection = client.Database(databaseName).
+		Collection(kLeasesCollectionName)
+	mStore.schedulerRunsCollection = client.Database(databaseName).
+		Collection(kSchedulerRunsCollectionName)
+	mStore.checkpointsCollection = client.Database(databaseName).
+		Collection(kCheckpointsCollectionName)
+	mStore.blogRevisionsCollection = client.Database(databaseName).
+		Collection(kBlogRevisionsCollectionName)
+
+	if err := mStore.createIndexes(ctx); err != nil {
+		return nil, errors.Errorf("could not create indexes with error [%v]",
+			err)
+	}
 
 	return mStore, nil
 }
@@ -0,0 +1,146 @@
+package mongodb_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/store/mongodb"
+	"github.com/variety-jones/cfrss/pkg/store/storetest"
+	"github.com/variety-jones/cfrss/pkg/utils"
+)
+
+const (
+	kDefaultTestMongoAddr = "mongodb://localhost:27017"
+
+	// kTestMongoAddrEnv overrides the address of the MongoDB used by the tests.
+	kTestMongoAddrEnv = "CFRSS_TEST_MONGO_ADDR"
+)
+
+// testMongoAddr returns the address of the test MongoDB instance.
+func testMongoAddr() string {
+	if addr := os.Getenv(kTestMongoAddrEnv); addr != "" {
+		return addr
+	}
+	return kDefaultTestMongoAddr
+}
+
+// unreachable remembers a failed connection attempt, so that the remaining
+// specs are skipped without waiting for the timeout again.
+var unreachable bool
+
+// connectOrSkip connects to the test MongoDB instance, and skips the spec if
+// it is not reachable.
+func connectOrSkip() *mongo.Client {
+	if unreachable {
+		Skip("MongoDB is not available at " + testMongoAddr())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().
+		ApplyURI(testMongoAddr()).
+		SetServerSelectionTimeout(time.Second))
+	if err == nil {
+		err = client.Ping(ctx, readpref.Primary())
+	}
+	if err != nil {
+		unreachable = true
+		Skip("MongoDB is not available at " + testMongoAddr())
+	}
+	return client
+}
+
+var _ = storetest.DescribeConformance("MongoStore",
+	func() store.CodeforcesStore {
+		client := connectOrSkip()
+
+		// Every spec gets its own database, which is dropped afterwards.
+		databaseName := "cfrss-test-" +
+			strings.ReplaceAll(utils.GetNewUUID(), "-", "")[:16]
+		DeferCleanup(func() {
+			Expect(client.Database(databaseName).Drop(
+				context.Background())).Should(Succeed())
+			Expect(client.Disconnect(context.Background())).Should(Succeed())
+		})
+
+		cfStore, err := mongodb.NewMongoStore(context.Background(),
+			testMongoAddr(), databaseName)
+		Expect(err).Should(BeNil())
+		return cfStore
+	})
+
+var _ = Describe("MongoStore", func() {
+	Describe("bulk write errors", func() {
+		writeErrors := func(codes ...int) error {
+			var res mongo.BulkWriteException
+			for _, code := range codes {
+				res.WriteErrors = append(res.WriteErrors, mongo.BulkWriteError{
+					WriteError: mongo.WriteError{Code: code},
+				})
+			}
+			return res
+		}
+
+		It("should only tolerate duplicate keys", func() {
+			Expect(mongodb.OnlyDuplicateKeys(writeErrors(11000, 11000))).
+				Should(BeTrue())
+			Expect(mongodb.OnlyDuplicateKeys(writeErrors(11000, 121))).
+				Should(BeFalse())
+			Expect(mongodb.OnlyDuplicateKeys(writeErrors())).Should(BeFalse())
+			Expect(mongodb.OnlyDuplicateKeys(errors.New("fake-error"))).
+				Should(BeFalse())
+		})
+	})
+
+	Describe("migrations", func() {
+		ctx := context.Background()
+		var database *mongo.Database
+
+		BeforeEach(func() {
+			client := connectOrSkip()
+			database = client.Database("cfrss-test-" +
+				strings.ReplaceAll(utils.GetNewUUID(), "-", "")[:16])
+			DeferCleanup(func() {
+				Expect(database.Drop(ctx)).Should(Succeed())
+				Expect(client.Disconnect(ctx)).Should(Succeed())
+			})
+		})
+
+		It("should set the key of the legacy actions", func() {
+			// Before the key was introduced, overlapping batches were stored
+			// twice.
+			legacy := []interface{}{
+				storetest.Comment(1, 11, 100),
+				storetest.Comment(1, 11, 100),
+				storetest.Comment(1, 12, 200),
+			}
+			Expect(database.Collection("recent_actions").InsertMany(ctx,
+				legacy)).Error().ShouldNot(HaveOccurred())
+
+			cfStore, err := mongodb.NewMongoStore(ctx, testMongoAddr(),
+				database.Name())
+			Expect(err).Should(BeNil())
+			Expect(database.Collection("recent_actions").CountDocuments(ctx,
+				bson.M{})).Should(Equal(int64(2)))
+
+			Expect(cfStore.AddRecentActions(ctx, []models.RecentAction{
+				storetest.Comment(1, 12, 200),
+				storetest.Comment(1, 13, 300),
+			})).Should(Equal(1))
+		})
+	})
+})
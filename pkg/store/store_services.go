@@ -1,48 +1,175 @@
 package store
 
-import "github.com/variety-jones/cfrss/pkg/models"
+import (
+	"context"
+	"time"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
 
 // CodeforcesStore is the interface needed to persist data from Codeforces
 // to MongoDB.
 type CodeforcesStore interface {
-	// AddRecentActions adds a batch of actions to the store.
-	AddRecentActions(actions []models.RecentAction) error
+	// AddRecentActions adds a batch of actions to the store. It is
+	// idempotent: actions whose natural key is already stored are skipped.
+	// It returns the number of actions that were actually added.
+	AddRecentActions(ctx context.Context, actions []models.RecentAction) (
+		int, error)
 
-	// QueryRecentActions returns the list of actions that happened at or
-	// after a fixed timestamp.
-	QueryRecentActions(startTimestamp, limit int64) ([]models.RecentAction, error)
+	// QueryRecentActions returns the list of comments that happened at or
+	// after a fixed timestamp, sorted in decreasing order of activity time.
+	// Ties are broken by decreasing blog id and comment id.
+	//
+	// All the list queries share the same pagination semantics: a
+	// non-positive limit returns all the results, and a non-nil cursor only
+	// returns the results that come strictly after it in the sort order.
+	QueryRecentActions(ctx context.Context, startTimestamp, limit int64,
+		after *models.Cursor) ([]models.RecentAction, error)
 
 	// LastRecordedTimestampForRecentActions returns the latest activity
 	// timestamp of any blog/comment in the store.
 	// It returns zero if no document exists.
-	LastRecordedTimestampForRecentActions() int64
+	LastRecordedTimestampForRecentActions(ctx context.Context) int64
+
+	// AddSyncGap records a gap in the recent actions, along with the outcome
+	// of its backfill.
+	AddSyncGap(ctx context.Context, gap *models.SyncGap) error
+
+	// QuerySyncGaps returns the latest recorded gaps, most recent first.
+	// A non-positive limit returns all of them.
+	QuerySyncGaps(ctx context.Context, limit int64) ([]models.SyncGap, error)
+
+	// AddSchedulerRun records the outcome of a sync.
+	AddSchedulerRun(ctx context.Context, run *models.SchedulerRun) error
+
+	// QuerySchedulerRuns returns the latest recorded runs, most recent
+	// first. A non-positive limit returns all of them.
+	QuerySchedulerRuns(ctx context.Context, limit int64) (
+		[]models.SchedulerRun, error)
+
+	// SaveCheckpoint persists the checkpoint, replacing the checkpoint with
+	// the same name.
+	SaveCheckpoint(ctx context.Context, checkpoint *models.Checkpoint) error
+
+	// QueryCheckpoint returns the named checkpoint, or nil if it was never
+	// saved.
+	QueryCheckpoint(ctx context.Context, name string) (*models.Checkpoint,
+		error)
+
+	// AddBlogRevision persists the revision, unless the blog already has a
+	// revision with the same id. It reports whether it was inserted.
+	AddBlogRevision(ctx context.Context, revision *models.BlogRevision) (bool,
+		error)
+
+	// QueryBlogRevisions returns the revisions of the blog, in increasing
+	// order of modification time, and then of the time they were first seen.
+	QueryBlogRevisions(ctx context.Context, blogId int) (
+		[]models.BlogRevision, error)
+
+	// QueryBlogRevision returns the revision of the blog with the given id,
+	// or nil if there is none.
+	QueryBlogRevision(ctx context.Context, blogId int, id string) (
+		*models.BlogRevision, error)
+
+	// AddProfiles inserts the Codeforces profiles into the cache, replacing
+	// the cached profiles with the same handles.
+	AddProfiles(ctx context.Context, profiles []models.CodeforcesUser) error
+
+	// QueryProfiles returns the cached profiles of the given handles.
+	// Handles without a cached profile are skipped.
+	QueryProfiles(ctx context.Context, handles ...string) (
+		[]models.CodeforcesUser, error)
+
+	// AddContests inserts the contests, replacing the stored contests with
+	// the same ids.
+	AddContests(ctx context.Context, contests []models.Contest) error
+
+	// QueryUpcomingContests returns the contests which end at or after the
+	// timestamp, sorted in increasing order of start time. Contests without
+	// a start time are skipped.
+	QueryUpcomingContests(ctx context.Context, timestamp int64) (
+		[]models.Contest, error)
 
 	// QueryAllUniqueBlogs returns the metadata of all the unique blogs,
-	// filtered by the blog creation time.
-	QueryAllUniqueBlogs(startTimestamp, limit int64) ([]models.BlogEntry, error)
+	// filtered by the blog creation time and sorted in decreasing order of
+	// creation time, with ties broken by decreasing blog id. If a blog was
+	// seen several times, the version with the latest modification time is
+	// returned.
+	QueryAllUniqueBlogs(ctx context.Context, startTimestamp, limit int64,
+		after *models.Cursor) ([]models.BlogEntry, error)
 
 	// QueryCommentsFromBlog returns all the comments from a particular blog.
-	// They are filtered by creation time and sorted in decreasing order of
-	// creation time.
-	QueryCommentsFromBlog(id int, startTimestamp, limit int64) (
-		[]models.Comment, error)
+	// They are filtered by the time of their action, like the recent actions,
+	// and sorted in decreasing order of creation time, with ties broken by
+	// decreasing comment id.
+	QueryCommentsFromBlog(ctx context.Context, id int, startTimestamp,
+		limit int64, after *models.Cursor) ([]models.Comment, error)
+
+	// AcquireLease grants the named lease to the holder until now+ttl, if it
+	// is free, expired or already held by the holder. Its token changes
+	// whenever it changes hands, expired leases included, and is never
+	// reused. It returns the lease as stored, which belongs to another
+	// holder if the acquisition failed.
+	AcquireLease(ctx context.Context, name, holder string, now time.Time,
+		ttl time.Duration) (*models.Lease, error)
+
+	// ReleaseLease expires the named lease right away, provided that the
+	// holder still holds it with the given token.
+	ReleaseLease(ctx context.Context, name, holder string, token int64,
+		now time.Time) error
+
+	// QueryLease returns the named lease, or nil if it was never acquired.
+	QueryLease(ctx context.Context, name string) (*models.Lease, error)
 
 	// AddUser adds the given user to the store.
-	// TODO: Add uniqueness checks for username.
-	AddUser(user *models.User) error
+	// It returns an *AlreadyExistsError if the uuid or the username is taken.
+	AddUser(ctx context.Context, user *models.User) error
 
 	// QueryUserByUuid returns the store user matching the uuid.
-	QueryUserByUuid(uuid string) (*models.User, error)
+	QueryUserByUuid(ctx context.Context, uuid string) (*models.User, error)
 
-	// QueryRecentActionsForUser returns the list of all activities on the
-	// blogs that the user is subscribed to.
-	// TODO: Sort it according to activity time and implement pagination.
-	QueryRecentActionsForUser(uuid string, startTimestamp, limit int64) (
-		[]models.RecentAction, error)
+	// QueryUserByUsername returns the store user matching the username.
+	QueryUserByUsername(ctx context.Context, username string) (
+		*models.User, error)
+
+	// UpdatePassword replaces the stored password of the user.
+	UpdatePassword(ctx context.Context, uuid, hashedPassword string) error
+
+	// QueryRecentActionsForUser returns the list of all comments on the
+	// blogs that the user is subscribed to, sorted like QueryRecentActions.
+	QueryRecentActionsForUser(ctx context.Context, uuid string, startTimestamp,
+		limit int64, after *models.Cursor) ([]models.RecentAction, error)
 
 	// SubscribeToBlogs subscribes a user to the given blogs.
-	SubscribeToBlogs(uuid string, ids ...int) error
+	SubscribeToBlogs(ctx context.Context, uuid string, ids ...int) error
 
 	// UnsubscribeFromBlogs unsubscribes a user from the given blogs.
-	UnsubscribeFromBlogs(uuid string, ids ...int) error
+	UnsubscribeFromBlogs(ctx context.Context, uuid string, ids ...int) error
+
+	// AddFeedToken grants a new feed token to the user.
+	AddFeedToken(ctx context.Context, uuid string, token models.FeedToken) error
+
+	// RevokeFeedToken removes the feed token with the given id from the user.
+	// It returns an error if the user does not own such a token.
+	RevokeFeedToken(ctx context.Context, uuid, tokenID string) error
+
+	// QueryUserByFeedToken returns the user owning the feed token with the
+	// given hash.
+	QueryUserByFeedToken(ctx context.Context, hashedToken string) (
+		*models.User, error)
+
+	// AddSession persists a new login session.
+	AddSession(ctx context.Context, session *models.Session) error
+
+	// QuerySession returns the session matching the hashed token.
+	// Expired sessions may still be returned, callers must check the expiry.
+	QuerySession(ctx context.Context, hashedToken string) (
+		*models.Session, error)
+
+	// DeleteSession removes the session matching the hashed token.
+	DeleteSession(ctx context.Context, hashedToken string) error
+
+	// Close releases the resources held by the store, e.g. the connections
+	// to the database. The store must not be used afterwards.
+	Close(ctx context.Context) error
 }
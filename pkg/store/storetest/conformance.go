@@ -0,0 +1,857 @@
+// Package storetest contains a conformance suite that every implementation of
+// store.CodeforcesStore is expected to pass.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
+	"github.com/variety-jones/cfrss/pkg/utils"
+)
+
+// StoreFactory creates a new, empty store. It is invoked once for every spec,
+// and may register cleanups via DeferCleanup.
+type StoreFactory func() store.CodeforcesStore
+
+// Comment returns an action representing a comment on a blog.
+func Comment(blogID, commentID int, timeSeconds int64) models.RecentAction {
+	return models.RecentAction{
+		TimeSeconds: timeSeconds,
+		BlogEntry: &models.BlogEntry{
+			Id:                      blogID,
+			Title:                   "fake-blog",
+			AuthorHandle:            "fake-author",
+			CreationTimeSeconds:     timeSeconds,
+			ModificationTimeSeconds: timeSeconds,
+		},
+		Comment: &models.Comment{
+			Id:                  commentID,
+			CreationTimeSeconds: timeSeconds,
+			CommentatorHandle:   "fake-commentator",
+			Text:                "<a href=\"/profile/fake-author\">hi</a>",
+		},
+	}
+}
+
+// Blog returns an action representing the creation or an update of a blog.
+func Blog(blogID int, timeSeconds int64) models.RecentAction {
+	return models.RecentAction{
+		TimeSeconds: timeSeconds,
+		BlogEntry: &models.BlogEntry{
+			Id:                      blogID,
+			Title:                   "fake-blog",
+			AuthorHandle:            "fake-author",
+			CreationTimeSeconds:     timeSeconds,
+			ModificationTimeSeconds: timeSeconds,
+		},
+	}
+}
+
+func timestamps(actions []models.RecentAction) []int64 {
+	var res []int64
+	for _, action := range actions {
+		res = append(res, action.TimeSeconds)
+	}
+	return res
+}
+
+func newUser(username string) *models.User {
+	return &models.User{
+		Uuid:           utils.GetNewUUID(),
+		Username:       username,
+		HashedPassword: "fake-hash",
+	}
+}
+
+// DescribeConformance registers the conformance specs for the store created
+// by newStore.
+func DescribeConformance(name string, newStore StoreFactory) bool {
+	return Describe(name+" conformance", func() {
+		var cfStore store.CodeforcesStore
+		ctx := context.Background()
+
+		BeforeEach(func() {
+			cfStore = newStore()
+		})
+
+		Describe("recent actions", func() {
+			BeforeEach(func() {
+				// Insert in the same order as Codeforces, latest first, and
+				// split across two batches.
+				Expect(cfStore.AddRecentActions(ctx, []models.RecentAction{
+					Comment(2, 24, 400),
+					Blog(3, 350),
+					Comment(1, 13, 300),
+				})).Error().ShouldNot(HaveOccurred())
+				Expect(cfStore.AddRecentActions(ctx, []models.RecentAction{
+					Comment(1, 12, 200),
+					Comment(1, 11, 100),
+				})).Error().ShouldNot(HaveOccurred())
+			})
+
+			It("should ignore empty batches", func() {
+				Expect(cfStore.AddRecentActions(ctx, nil)).Error().
+					ShouldNot(HaveOccurred())
+				Expect(cfStore.AddRecentActions(ctx,
+					[]models.RecentAction{})).Error().ShouldNot(HaveOccurred())
+			})
+
+			It("should return comments in decreasing order of time", func() {
+				actions, err := cfStore.QueryRecentActions(ctx, 0, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(timestamps(actions)).Should(
+					Equal([]int64{400, 300, 200, 100}))
+			})
+
+			It("should respect the limit", func() {
+				actions, err := cfStore.QueryRecentActions(ctx, 0, 2, nil)
+				Expect(err).Should(BeNil())
+				Expect(timestamps(actions)).Should(Equal([]int64{400, 300}))
+			})
+
+			It("should return everything for a negative limit", func() {
+				actions, err := cfStore.QueryRecentActions(ctx, 0, -1, nil)
+				Expect(err).Should(BeNil())
+				Expect(timestamps(actions)).Should(
+					Equal([]int64{400, 300, 200, 100}))
+
+				comments, err := cfStore.QueryCommentsFromBlog(ctx, 1, 0, -1,
+					nil)
+				Expect(err).Should(BeNil())
+				Expect(comments).Should(HaveLen(3))
+
+				blogs, err := cfStore.QueryAllUniqueBlogs(ctx, 0, -1, nil)
+				Expect(err).Should(BeNil())
+				Expect(blogs).Should(HaveLen(3))
+			})
+
+			It("should include the start timestamp", func() {
+				actions, err := cfStore.QueryRecentActions(ctx, 200, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(timestamps(actions)).Should(
+					Equal([]int64{400, 300, 200}))
+
+				actions, err = cfStore.QueryRecentActions(ctx, 401, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(actions).Should(BeEmpty())
+			})
+
+			It("should convert relative links to absolute links", func() {
+				actions, err := cfStore.QueryRecentActions(ctx, 400, 1, nil)
+				Expect(err).Should(BeNil())
+				Expect(actions).Should(HaveLen(1))
+				Expect(actions[0].Comment.Text).Should(ContainSubstring(
+					"href=\"https://codeforces.com/profile/fake-author\""))
+			})
+
+			It("should report the last recorded timestamp", func() {
+				Expect(cfStore.LastRecordedTimestampForRecentActions(ctx)).
+					Should(Equal(int64(400)))
+				Expect(newStore().LastRecordedTimestampForRecentActions(ctx)).
+					Should(Equal(int64(0)))
+			})
+
+			It("should return the comments of a single blog", func() {
+				comments, err := cfStore.QueryCommentsFromBlog(ctx, 1, 200, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(comments).Should(HaveLen(2))
+				Expect(comments[0].Id).Should(Equal(13))
+				Expect(comments[1].Id).Should(Equal(12))
+
+				comments, err = cfStore.QueryCommentsFromBlog(ctx, 1, 0, 1, nil)
+				Expect(err).Should(BeNil())
+				Expect(comments).Should(HaveLen(1))
+				Expect(comments[0].Id).Should(Equal(13))
+
+				comments, err = cfStore.QueryCommentsFromBlog(ctx, 3, 0, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(comments).Should(BeEmpty())
+			})
+
+			It("should filter comments on the time of their action", func() {
+				// The action of an edited comment is more recent than the
+				// comment itself.
+				edited := Comment(5, 51, 100)
+				edited.TimeSeconds = 500
+				Expect(cfStore.AddRecentActions(ctx,
+					[]models.RecentAction{edited})).Error().
+					ShouldNot(HaveOccurred())
+
+				comments, err := cfStore.QueryCommentsFromBlog(ctx, 5, 500, 0,
+					nil)
+				Expect(err).Should(BeNil())
+				Expect(comments).Should(HaveLen(1))
+				Expect(comments[0].Id).Should(Equal(51))
+			})
+		})
+
+		Describe("idempotent ingestion", func() {
+			It("should skip actions that are already stored", func() {
+				batch := []models.RecentAction{
+					Comment(1, 12, 200),
+					Comment(1, 11, 100),
+					Blog(1, 100),
+				}
+				inserted, err := cfStore.AddRecentActions(ctx, batch)
+				Expect(err).Should(BeNil())
+				Expect(inserted).Should(Equal(3))
+
+				// The next poll overlaps with the previous one, and has a new
+				// comment posted in the same second as the latest one.
+				inserted, err = cfStore.AddRecentActions(ctx, []models.RecentAction{
+					Comment(1, 13, 200),
+					Comment(1, 12, 200),
+					Comment(1, 11, 100),
+				})
+				Expect(err).Should(BeNil())
+				Expect(inserted).Should(Equal(1))
+
+				actions, err := cfStore.QueryRecentActions(ctx, 0, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(timestamps(actions)).Should(
+					Equal([]int64{200, 200, 100}))
+			})
+
+			It("should tell blog revisions apart", func() {
+				edited := Blog(1, 300)
+				edited.BlogEntry.CreationTimeSeconds = 100
+
+				inserted, err := cfStore.AddRecentActions(ctx,
+					[]models.RecentAction{edited, Blog(1, 100), Blog(1, 100)})
+				Expect(err).Should(BeNil())
+				Expect(inserted).Should(Equal(2))
+			})
+		})
+
+		Describe("pagination", func() {
+			BeforeEach(func() {
+				// Several comments share the same second.
+				Expect(cfStore.AddRecentActions(ctx, []models.RecentAction{
+					Comment(2, 22, 300),
+					Comment(1, 13, 300),
+					Comment(2, 21, 300),
+					Comment(1, 12, 200),
+					Comment(1, 11, 100),
+				})).Error().ShouldNot(HaveOccurred())
+			})
+
+			ids := func(actions []models.RecentAction) []int {
+				var res []int
+				for _, action := range actions {
+					res = append(res, action.Comment.Id)
+				}
+				return res
+			}
+
+			It("should break ties by blog and comment id", func() {
+				actions, err := cfStore.QueryRecentActions(ctx, 0, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(ids(actions)).Should(Equal([]int{22, 21, 13, 12, 11}))
+			})
+
+			It("should walk through all the pages without gaps", func() {
+				var all []int
+				var after *models.Cursor
+				for page := 0; page < 10; page++ {
+					actions, err := cfStore.QueryRecentActions(ctx, 0, 2, after)
+					Expect(err).Should(BeNil())
+					if len(actions) == 0 {
+						break
+					}
+					all = append(all, ids(actions)...)
+					cursor := models.CursorOfAction(actions[len(actions)-1])
+					after = &cursor
+				}
+				Expect(all).Should(Equal([]int{22, 21, 13, 12, 11}))
+			})
+
+			It("should resume in the middle of a second", func() {
+				after := models.CursorOfAction(Comment(2, 21, 300))
+				actions, err := cfStore.QueryRecentActions(ctx, 150, 0, &after)
+				Expect(err).Should(BeNil())
+				Expect(ids(actions)).Should(Equal([]int{13, 12}))
+
+				user := newUser("fake-user")
+				Expect(cfStore.AddUser(ctx, user)).Should(Succeed())
+				Expect(cfStore.SubscribeToBlogs(ctx, user.Uuid, 1)).Should(Succeed())
+				actions, err = cfStore.QueryRecentActionsForUser(ctx, user.Uuid, 0,
+					1, &after)
+				Expect(err).Should(BeNil())
+				Expect(ids(actions)).Should(Equal([]int{13}))
+			})
+
+			It("should paginate the comments of a blog", func() {
+				after := models.CursorOfComment(1,
+					*Comment(1, 13, 300).Comment)
+				comments, err := cfStore.QueryCommentsFromBlog(ctx, 1, 0, 0, &after)
+				Expect(err).Should(BeNil())
+				Expect(comments).Should(HaveLen(2))
+				Expect(comments[0].Id).Should(Equal(12))
+				Expect(comments[1].Id).Should(Equal(11))
+			})
+
+			It("should paginate the blogs", func() {
+				blogs, err := cfStore.QueryAllUniqueBlogs(ctx, 0, 1, nil)
+				Expect(err).Should(BeNil())
+				Expect(blogs).Should(HaveLen(1))
+
+				after := models.CursorOfBlog(blogs[0])
+				blogs, err = cfStore.QueryAllUniqueBlogs(ctx, 0, 0, &after)
+				Expect(err).Should(BeNil())
+				Expect(blogs).Should(HaveLen(1))
+				Expect(blogs[0].Id).Should(Equal(1))
+			})
+		})
+
+		Describe("unique blogs", func() {
+			version := func(blogID int, creation, modification,
+				timeSeconds int64, title string) models.RecentAction {
+				action := Comment(blogID, int(timeSeconds), timeSeconds)
+				action.BlogEntry.CreationTimeSeconds = creation
+				action.BlogEntry.ModificationTimeSeconds = modification
+				action.BlogEntry.Title = title
+				return action
+			}
+
+			BeforeEach(func() {
+				Expect(cfStore.AddRecentActions(ctx, []models.RecentAction{
+					version(3, 300, 300, 700, "third"),
+					version(1, 100, 150, 600, "first-edited"),
+					version(2, 200, 200, 500, "second"),
+					version(1, 100, 100, 400, "first"),
+				})).Error().ShouldNot(HaveOccurred())
+				// A stale version arriving late must not win.
+				Expect(cfStore.AddRecentActions(ctx, []models.RecentAction{
+					version(1, 100, 120, 800, "first-stale"),
+				})).Error().ShouldNot(HaveOccurred())
+			})
+
+			It("should de-duplicate blogs keeping the latest version", func() {
+				blogs, err := cfStore.QueryAllUniqueBlogs(ctx, 0, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(blogs).Should(HaveLen(3))
+
+				var titles []string
+				for _, blog := range blogs {
+					titles = append(titles, blog.Title)
+				}
+				Expect(titles).Should(Equal(
+					[]string{"third", "second", "first-edited"}))
+			})
+
+			It("should filter on creation time and respect the limit", func() {
+				blogs, err := cfStore.QueryAllUniqueBlogs(ctx, 200, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(blogs).Should(HaveLen(2))
+
+				blogs, err = cfStore.QueryAllUniqueBlogs(ctx, 0, 1, nil)
+				Expect(err).Should(BeNil())
+				Expect(blogs).Should(HaveLen(1))
+				Expect(blogs[0].Id).Should(Equal(3))
+			})
+		})
+
+		Describe("users", func() {
+			It("should find users by uuid and username", func() {
+				user := newUser("fake-user")
+				Expect(cfStore.AddUser(ctx, user)).Should(Succeed())
+
+				byUuid, err := cfStore.QueryUserByUuid(ctx, user.Uuid)
+				Expect(err).Should(BeNil())
+				Expect(byUuid.Username).Should(Equal("fake-user"))
+
+				byUsername, err := cfStore.QueryUserByUsername(ctx, "fake-user")
+				Expect(err).Should(BeNil())
+				Expect(byUsername.Uuid).Should(Equal(user.Uuid))
+				Expect(byUsername.HashedPassword).Should(Equal("fake-hash"))
+			})
+
+			It("should reject duplicate usernames and uuids", func() {
+				user := newUser("fake-user")
+				Expect(cfStore.AddUser(ctx, user)).Should(Succeed())
+
+				var alreadyExists *store.AlreadyExistsError
+				err := cfStore.AddUser(ctx, newUser("fake-user"))
+				Expect(errors.As(err, &alreadyExists)).Should(BeTrue())
+				Expect(alreadyExists.Field).Should(Equal("username"))
+
+				duplicate := newUser("another-user")
+				duplicate.Uuid = user.Uuid
+				err = cfStore.AddUser(ctx, duplicate)
+				Expect(errors.As(err, &alreadyExists)).Should(BeTrue())
+				Expect(alreadyExists.Field).Should(Equal("uuid"))
+			})
+
+			It("should update passwords", func() {
+				user := newUser("fake-user")
+				Expect(cfStore.AddUser(ctx, user)).Should(Succeed())
+
+				Expect(cfStore.UpdatePassword(ctx, user.Uuid,
+					"fake-new-password")).Should(Succeed())
+				updated, err := cfStore.QueryUserByUuid(ctx, user.Uuid)
+				Expect(err).Should(BeNil())
+				Expect(updated.HashedPassword).Should(Equal("fake-new-password"))
+			})
+
+			It("should not share the users with the callers", func() {
+				user := newUser("fake-user")
+				Expect(cfStore.AddUser(ctx, user)).Should(Succeed())
+				Expect(cfStore.SubscribeToBlogs(ctx, user.Uuid, 1)).
+					Should(Succeed())
+
+				// Neither the added user nor the returned ones are stored.
+				user.HashedPassword = "fake-mutated-hash"
+				byUuid, err := cfStore.QueryUserByUuid(ctx, user.Uuid)
+				Expect(err).Should(BeNil())
+				byUuid.HashedPassword = "fake-mutated-hash"
+				byUuid.SubscribedBlogs[0] = 2
+				byUsername, err := cfStore.QueryUserByUsername(ctx, "fake-user")
+				Expect(err).Should(BeNil())
+				byUsername.SubscribedBlogs = nil
+
+				stored, err := cfStore.QueryUserByUuid(ctx, user.Uuid)
+				Expect(err).Should(BeNil())
+				Expect(stored.HashedPassword).Should(Equal("fake-hash"))
+				Expect(stored.SubscribedBlogs).Should(Equal([]int{1}))
+			})
+
+			It("should fail for unknown users", func() {
+				_, err := cfStore.QueryUserByUuid(ctx, "unknown")
+				Expect(err).ShouldNot(BeNil())
+				_, err = cfStore.QueryUserByUsername(ctx, "unknown")
+				Expect(err).ShouldNot(BeNil())
+				_, err = cfStore.QueryRecentActionsForUser(ctx, "unknown", 0, 0, nil)
+				Expect(err).ShouldNot(BeNil())
+				Expect(cfStore.SubscribeToBlogs(ctx, "unknown", 1)).ShouldNot(
+					Succeed())
+				Expect(cfStore.UnsubscribeFromBlogs(ctx, "unknown", 1)).ShouldNot(
+					Succeed())
+				Expect(cfStore.UpdatePassword(ctx, "unknown", "fake-password")).
+					ShouldNot(Succeed())
+			})
+		})
+
+		Describe("subscriptions", func() {
+			var user *models.User
+
+			BeforeEach(func() {
+				user = newUser("fake-user")
+				Expect(cfStore.AddUser(ctx, user)).Should(Succeed())
+				Expect(cfStore.AddRecentActions(ctx, []models.RecentAction{
+					Comment(3, 31, 500),
+					Comment(2, 21, 400),
+					Comment(1, 12, 300),
+					Blog(1, 250),
+					Comment(1, 11, 200),
+				})).Error().ShouldNot(HaveOccurred())
+			})
+
+			It("should return nothing without subscriptions", func() {
+				actions, err := cfStore.QueryRecentActionsForUser(ctx,
+					user.Uuid, 0, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(actions).Should(BeEmpty())
+			})
+
+			It("should only return comments on subscribed blogs", func() {
+				Expect(cfStore.SubscribeToBlogs(ctx, user.Uuid, 1, 3)).Should(Succeed())
+
+				actions, err := cfStore.QueryRecentActionsForUser(ctx,
+					user.Uuid, 0, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(timestamps(actions)).Should(
+					Equal([]int64{500, 300, 200}))
+
+				actions, err = cfStore.QueryRecentActionsForUser(ctx,
+					user.Uuid, 300, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(timestamps(actions)).Should(Equal([]int64{500, 300}))
+
+				actions, err = cfStore.QueryRecentActionsForUser(ctx,
+					user.Uuid, 0, 1, nil)
+				Expect(err).Should(BeNil())
+				Expect(timestamps(actions)).Should(Equal([]int64{500}))
+			})
+
+			It("should unsubscribe from multiple blogs at once", func() {
+				Expect(cfStore.SubscribeToBlogs(ctx, user.Uuid, 1, 2, 3)).
+					Should(Succeed())
+				Expect(cfStore.UnsubscribeFromBlogs(ctx, user.Uuid, 1, 3)).
+					Should(Succeed())
+
+				stored, err := cfStore.QueryUserByUuid(ctx, user.Uuid)
+				Expect(err).Should(BeNil())
+				Expect(stored.SubscribedBlogs).Should(Equal([]int{2}))
+
+				actions, err := cfStore.QueryRecentActionsForUser(ctx,
+					user.Uuid, 0, 0, nil)
+				Expect(err).Should(BeNil())
+				Expect(timestamps(actions)).Should(Equal([]int64{400}))
+			})
+		})
+
+		Describe("feed tokens", func() {
+			It("should resolve tokens until they are revoked", func() {
+				user := newUser("fake-user")
+				Expect(cfStore.AddUser(ctx, user)).Should(Succeed())
+
+				token := models.FeedToken{
+					Id:                  utils.GetNewUUID(),
+					HashedToken:         "fake-hashed-token",
+					CreationTimeSeconds: 100,
+				}
+				Expect(cfStore.AddFeedToken(ctx, user.Uuid, token)).Should(Succeed())
+
+				owner, err := cfStore.QueryUserByFeedToken(ctx, "fake-hashed-token")
+				Expect(err).Should(BeNil())
+				Expect(owner.Uuid).Should(Equal(user.Uuid))
+
+				// The owner is a copy, which the caller is free to mutate.
+				owner.FeedTokens[0].HashedToken = "fake-mutated-token"
+				Expect(cfStore.QueryUserByFeedToken(ctx, "fake-hashed-token")).
+					ShouldNot(BeNil())
+
+				Expect(cfStore.RevokeFeedToken(ctx, user.Uuid, token.Id)).
+					Should(Succeed())
+				Expect(cfStore.RevokeFeedToken(ctx, user.Uuid, token.Id)).
+					ShouldNot(Succeed())
+				_, err = cfStore.QueryUserByFeedToken(ctx, "fake-hashed-token")
+				Expect(err).ShouldNot(BeNil())
+			})
+
+			It("should fail for unknown users", func() {
+				Expect(cfStore.AddFeedToken(ctx, "unknown", models.FeedToken{
+					Id: "fake-id",
+				})).ShouldNot(Succeed())
+			})
+		})
+
+		Describe("sessions", func() {
+			It("should add, query and delete sessions", func() {
+				session := &models.Session{
+					HashedToken: "fake-hashed-token",
+					Uuid:        "fake-uuid",
+					CreatedAt:   time.Now().UTC().Truncate(time.Second),
+					ExpiresAt: time.Now().UTC().Truncate(time.Second).
+						Add(time.Hour),
+				}
+				Expect(cfStore.AddSession(ctx, session)).Should(Succeed())
+				Expect(cfStore.AddSession(ctx, session)).ShouldNot(Succeed())
+
+				stored, err := cfStore.QuerySession(ctx, "fake-hashed-token")
+				Expect(err).Should(BeNil())
+				Expect(stored.Uuid).Should(Equal("fake-uuid"))
+				Expect(stored.ExpiresAt.Equal(session.ExpiresAt)).Should(BeTrue())
+
+				// The stored session is not shared with the callers.
+				stored.Uuid = "fake-mutated-uuid"
+				session.Uuid = "fake-mutated-uuid"
+				stored, err = cfStore.QuerySession(ctx, "fake-hashed-token")
+				Expect(err).Should(BeNil())
+				Expect(stored.Uuid).Should(Equal("fake-uuid"))
+
+				Expect(cfStore.DeleteSession(ctx, "fake-hashed-token")).Should(Succeed())
+				Expect(cfStore.DeleteSession(ctx, "fake-hashed-token")).
+					ShouldNot(Succeed())
+				_, err = cfStore.QuerySession(ctx, "fake-hashed-token")
+				Expect(err).ShouldNot(BeNil())
+			})
+		})
+
+		Describe("sync gaps", func() {
+			It("should return the latest gaps first", func() {
+				now := time.Now().UTC().Truncate(time.Second)
+				for ind := int64(0); ind < 3; ind++ {
+					Expect(cfStore.AddSyncGap(ctx, &models.SyncGap{
+						StartTimestamp: 10 * ind,
+						EndTimestamp:   10*ind + 5,
+						DetectedAt:     now.Add(time.Duration(ind) * time.Minute),
+						Backfills: []models.BackfillOutcome{
+							{BlogId: 1, Fetched: 2, Inserted: 1},
+						},
+					})).Should(Succeed())
+				}
+
+				gaps, err := cfStore.QuerySyncGaps(ctx, 2)
+				Expect(err).Should(BeNil())
+				Expect(gaps).Should(HaveLen(2))
+				Expect(gaps[0].StartTimestamp).Should(Equal(int64(20)))
+				Expect(gaps[1].StartTimestamp).Should(Equal(int64(10)))
+				Expect(gaps[0].Backfills).Should(Equal([]models.BackfillOutcome{
+					{BlogId: 1, Fetched: 2, Inserted: 1},
+				}))
+
+				gaps, err = cfStore.QuerySyncGaps(ctx, 0)
+				Expect(err).Should(BeNil())
+				Expect(gaps).Should(HaveLen(3))
+
+				gaps, err = cfStore.QuerySyncGaps(ctx, -1)
+				Expect(err).Should(BeNil())
+				Expect(gaps).Should(HaveLen(3))
+			})
+		})
+
+		Describe("scheduler runs", func() {
+			It("should return the latest runs first", func() {
+				now := time.Now().UTC().Truncate(time.Second)
+				for ind := 0; ind < 3; ind++ {
+					startedAt := now.Add(time.Duration(ind) * time.Minute)
+					Expect(cfStore.AddSchedulerRun(ctx, &models.SchedulerRun{
+						StartedAt:  startedAt,
+						EndedAt:    startedAt.Add(time.Second),
+						Fetched:    100,
+						New:        ind,
+						Duplicates: 100 - ind,
+					})).Should(Succeed())
+				}
+				Expect(cfStore.AddSchedulerRun(ctx, &models.SchedulerRun{
+					StartedAt: now.Add(-time.Minute),
+					Error:     "fake-error",
+				})).Should(Succeed())
+
+				runs, err := cfStore.QuerySchedulerRuns(ctx, 2)
+				Expect(err).Should(BeNil())
+				Expect(runs).Should(HaveLen(2))
+				Expect(runs[0].New).Should(Equal(2))
+				Expect(runs[0].Duplicates).Should(Equal(98))
+				Expect(runs[0].EndedAt.Equal(now.Add(2*time.Minute + time.Second))).
+					Should(BeTrue())
+				Expect(runs[1].New).Should(Equal(1))
+
+				runs, err = cfStore.QuerySchedulerRuns(ctx, 0)
+				Expect(err).Should(BeNil())
+				Expect(runs).Should(HaveLen(4))
+				Expect(runs[3].Error).Should(Equal("fake-error"))
+
+				runs, err = cfStore.QuerySchedulerRuns(ctx, -1)
+				Expect(err).Should(BeNil())
+				Expect(runs).Should(HaveLen(4))
+			})
+		})
+
+		Describe("checkpoints", func() {
+			It("should keep the latest checkpoint", func() {
+				checkpoint, err := cfStore.QueryCheckpoint(ctx, "fake-checkpoint")
+				Expect(err).Should(BeNil())
+				Expect(checkpoint).Should(BeNil())
+
+				now := time.Now().UTC().Truncate(time.Second)
+				for _, timestamp := range []int64{10, 20} {
+					Expect(cfStore.SaveCheckpoint(ctx, &models.Checkpoint{
+						Name:      "fake-checkpoint",
+						Timestamp: timestamp,
+						UpdatedAt: now,
+					})).Should(Succeed())
+				}
+
+				checkpoint, err = cfStore.QueryCheckpoint(ctx, "fake-checkpoint")
+				Expect(err).Should(BeNil())
+				Expect(checkpoint.Timestamp).Should(Equal(int64(20)))
+				Expect(checkpoint.UpdatedAt.Equal(now)).Should(BeTrue())
+			})
+		})
+
+		Describe("blog revisions", func() {
+			It("should keep every distinct version of a blog", func() {
+				seenAt := time.Now().UTC().Truncate(time.Second)
+				edited := models.BlogEntry{
+					Id:                      1,
+					Title:                   "fake-title",
+					Content:                 "fake-edited-content",
+					Tags:                    []string{"fake-tag"},
+					ModificationTimeSeconds: 20,
+				}
+				original := edited
+				original.Content = "fake-content"
+				original.ModificationTimeSeconds = 10
+
+				for _, blog := range []models.BlogEntry{
+					edited, original, {Id: 2, ModificationTimeSeconds: 30},
+				} {
+					revision := models.RevisionOfBlog(blog, seenAt)
+					Expect(cfStore.AddBlogRevision(ctx, &revision)).Should(
+						BeTrue())
+				}
+
+				// Seeing a version again keeps the time it was first seen.
+				again := models.RevisionOfBlog(edited, seenAt.Add(time.Hour))
+				Expect(cfStore.AddBlogRevision(ctx, &again)).Should(BeFalse())
+
+				revisions, err := cfStore.QueryBlogRevisions(ctx, 1)
+				Expect(err).Should(BeNil())
+				Expect(revisions).Should(HaveLen(2))
+				Expect(revisions[0].Content).Should(Equal("fake-content"))
+				Expect(revisions[1].Content).Should(
+					Equal("fake-edited-content"))
+				Expect(revisions[1].Tags).Should(Equal([]string{"fake-tag"}))
+				Expect(revisions[1].SeenAt.Equal(seenAt)).Should(BeTrue())
+
+				revision, err := cfStore.QueryBlogRevision(ctx, 1, again.Id)
+				Expect(err).Should(BeNil())
+				Expect(revision.ModificationTimeSeconds).Should(
+					Equal(int64(20)))
+
+				revision, err = cfStore.QueryBlogRevision(ctx, 2, again.Id)
+				Expect(err).Should(BeNil())
+				Expect(revision).Should(BeNil())
+			})
+
+			It("should order the versions with the same modification time "+
+				"by the time they were seen", func() {
+				seenAt := time.Now().UTC().Truncate(time.Second)
+				retagged := models.BlogEntry{
+					Id:                      1,
+					Content:                 "fake-content",
+					Tags:                    []string{"fake-tag"},
+					ModificationTimeSeconds: 10,
+				}
+				original := retagged
+				original.Tags = nil
+
+				later := models.RevisionOfBlog(retagged, seenAt.Add(time.Hour))
+				earlier := models.RevisionOfBlog(original, seenAt)
+				for _, revision := range []models.BlogRevision{later, earlier} {
+					Expect(cfStore.AddBlogRevision(ctx, &revision)).Should(
+						BeTrue())
+				}
+
+				revisions, err := cfStore.QueryBlogRevisions(ctx, 1)
+				Expect(err).Should(BeNil())
+				Expect(revisions).Should(HaveLen(2))
+				Expect(revisions[0].Id).Should(Equal(earlier.Id))
+				Expect(revisions[1].Id).Should(Equal(later.Id))
+			})
+		})
+
+		Describe("profiles", func() {
+			It("should cache the latest profile of every handle", func() {
+				fetchedAt := time.Now().UTC().Truncate(time.Second)
+				Expect(cfStore.AddProfiles(ctx, []models.CodeforcesUser{
+					{Handle: "fake-author", Rank: "pupil", FetchedAt: fetchedAt},
+					{Handle: "fake-commentator", Rank: "expert"},
+				})).Should(Succeed())
+				Expect(cfStore.AddProfiles(ctx, []models.CodeforcesUser{
+					{Handle: "fake-author", Rank: "master", FetchedAt: fetchedAt},
+				})).Should(Succeed())
+
+				profiles, err := cfStore.QueryProfiles(ctx, "fake-author", "unknown")
+				Expect(err).Should(BeNil())
+				Expect(profiles).Should(HaveLen(1))
+				Expect(profiles[0].Rank).Should(Equal("master"))
+				Expect(profiles[0].FetchedAt.Equal(fetchedAt)).Should(BeTrue())
+
+				profiles, err = cfStore.QueryProfiles(ctx)
+				Expect(err).Should(BeNil())
+				Expect(profiles).Should(BeEmpty())
+			})
+		})
+
+		Describe("leases", func() {
+			now := time.Now().UTC().Truncate(time.Second)
+			ttl := 10 * time.Second
+
+			It("should grant a free lease and renew it", func() {
+				lease, err := cfStore.QueryLease(ctx, "fake-lease")
+				Expect(err).Should(BeNil())
+				Expect(lease).Should(BeNil())
+
+				lease, err = cfStore.AcquireLease(ctx, "fake-lease", "first",
+					now, ttl)
+				Expect(err).Should(BeNil())
+				Expect(lease.Holder).Should(Equal("first"))
+				Expect(lease.Token).Should(Equal(int64(1)))
+				Expect(lease.ExpiresAt.Equal(now.Add(ttl))).Should(BeTrue())
+
+				lease, err = cfStore.AcquireLease(ctx, "fake-lease", "first",
+					now.Add(5*time.Second), ttl)
+				Expect(err).Should(BeNil())
+				Expect(lease.Token).Should(Equal(int64(1)))
+				Expect(lease.AcquiredAt.Equal(now)).Should(BeTrue())
+				Expect(lease.ExpiresAt.Equal(now.Add(15 * time.Second))).
+					Should(BeTrue())
+			})
+
+			It("should not grant a lease held by someone else", func() {
+				Expect(cfStore.AcquireLease(ctx, "fake-lease", "first", now,
+					ttl)).Error().Should(BeNil())
+
+				lease, err := cfStore.AcquireLease(ctx, "fake-lease", "second",
+					now.Add(time.Second), ttl)
+				Expect(err).Should(BeNil())
+				Expect(lease.Holder).Should(Equal("first"))
+
+				lease, err = cfStore.QueryLease(ctx, "fake-lease")
+				Expect(err).Should(BeNil())
+				Expect(lease.Holder).Should(Equal("first"))
+			})
+
+			It("should hand an expired lease over with a new token", func() {
+				Expect(cfStore.AcquireLease(ctx, "fake-lease", "first", now,
+					ttl)).Error().Should(BeNil())
+
+				lease, err := cfStore.AcquireLease(ctx, "fake-lease", "second",
+					now.Add(ttl), ttl)
+				Expect(err).Should(BeNil())
+				Expect(lease.Holder).Should(Equal("second"))
+				Expect(lease.Token).Should(Equal(int64(2)))
+
+				// The previous holder gets a new token, even when taking the
+				// lease back.
+				lease, err = cfStore.AcquireLease(ctx, "fake-lease", "first",
+					now.Add(3*ttl), ttl)
+				Expect(err).Should(BeNil())
+				Expect(lease.Holder).Should(Equal("first"))
+				Expect(lease.Token).Should(Equal(int64(3)))
+			})
+
+			It("should only release a lease held with the token", func() {
+				lease, err := cfStore.AcquireLease(ctx, "fake-lease", "first",
+					now, ttl)
+				Expect(err).Should(BeNil())
+
+				Expect(cfStore.ReleaseLease(ctx, "fake-lease", "first",
+					lease.Token+1, now)).Should(Succeed())
+				Expect(cfStore.AcquireLease(ctx, "fake-lease", "second", now,
+					ttl)).Should(HaveField("Holder", "first"))
+
+				Expect(cfStore.ReleaseLease(ctx, "fake-lease", "first",
+					lease.Token, now)).Should(Succeed())
+				lease, err = cfStore.AcquireLease(ctx, "fake-lease", "second",
+					now, ttl)
+				Expect(err).Should(BeNil())
+				Expect(lease.Holder).Should(Equal("second"))
+				Expect(lease.Token).Should(Equal(int64(2)))
+			})
+		})
+
+		Describe("contests", func() {
+			It("should return the contests which did not end", func() {
+				Expect(cfStore.AddContests(ctx, []models.Contest{
+					{Id: 1, Name: "finished", StartTimeSeconds: 100,
+						DurationSeconds: 50},
+					{Id: 2, Name: "running", StartTimeSeconds: 150,
+						DurationSeconds: 100},
+					{Id: 3, Name: "upcoming", StartTimeSeconds: 500,
+						DurationSeconds: 100},
+					{Id: 4, Name: "unscheduled"},
+				})).Should(Succeed())
+				Expect(cfStore.AddContests(ctx, []models.Contest{
+					{Id: 3, Name: "rescheduled", StartTimeSeconds: 200,
+						DurationSeconds: 100},
+				})).Should(Succeed())
+
+				contests, err := cfStore.QueryUpcomingContests(ctx, 200)
+				Expect(err).Should(BeNil())
+				Expect(contests).Should(HaveLen(2))
+				Expect(contests[0].Name).Should(Equal("running"))
+				Expect(contests[1].Name).Should(Equal("rescheduled"))
+			})
+		})
+	})
+}
@@ -1,23 +1,108 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"strings"
 
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/variety-jones/cfrss/pkg/models"
 )
 
+const (
+	codeforcesBaseURL = "https://codeforces.com"
+
+	secretTokenBytes = 32
+)
+
 func GetNewUUID() string {
 	return uuid.New().String()
 }
 
+// GetNewSecretToken returns a random, URL safe secret.
+func GetNewSecretToken() (string, error) {
+	buf := make([]byte, secretTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("could not generate random bytes "+
+			"with error [%v]", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashSecretToken returns the digest of a secret token, which is safe to
+// persist and to look the token up by.
+func HashSecretToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+// HashPassword returns the salted bcrypt hash of a password.
+func HashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password),
+		bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("could not hash password with error [%v]", err)
+	}
+	return string(hashed), nil
+}
+
+// VerifyPassword reports whether the password matches the stored one, be it a
+// bcrypt hash or a legacy plain text password.
+func VerifyPassword(hashedPassword, password string) bool {
+	if !IsPasswordHash(hashedPassword) {
+		return hashedPassword != "" && subtle.ConstantTimeCompare([]byte(hashedPassword),
+			[]byte(password)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword),
+		[]byte(password)) == nil
+}
+
+// IsPasswordHash reports whether the stored password is a bcrypt hash, rather
+// than a plain text password stored before passwords were hashed.
+func IsPasswordHash(hashedPassword string) bool {
+	_, err := bcrypt.Cost([]byte(hashedPassword))
+	return err == nil
+}
+
+// BlogEntryURL returns the permalink of a Codeforces blog.
+func BlogEntryURL(blogID int) string {
+	return fmt.Sprintf("%s/blog/entry/%d", codeforcesBaseURL, blogID)
+}
+
+// CommentURL returns the permalink of a comment on a Codeforces blog.
+func CommentURL(blogID, commentID int) string {
+	return fmt.Sprintf("%s#comment-%d", BlogEntryURL(blogID), commentID)
+}
+
+// ProfileURL returns the link to the Codeforces profile of a handle.
+func ProfileURL(handle string) string {
+	return fmt.Sprintf("%s/profile/%s", codeforcesBaseURL, handle)
+}
+
+// ContestURL returns the link to a Codeforces contest.
+func ContestURL(contestID int) string {
+	return fmt.Sprintf("%s/contest/%d", codeforcesBaseURL, contestID)
+}
+
+// ContestRegistrationURL returns the link to register for a Codeforces
+// contest.
+func ContestRegistrationURL(contestID int) string {
+	return fmt.Sprintf("%s/contestRegistration/%d", codeforcesBaseURL,
+		contestID)
+}
+
 func ConvertRelativeLinksToAbsoluteLinks(actions []models.RecentAction) {
 	for ind := range actions {
 		if actions[ind].Comment == nil {
 			continue
 		}
 		actions[ind].Comment.Text = strings.ReplaceAll(actions[ind].Comment.Text,
-			"href=\"/", "href=\"https://codeforces.com/")
+			"href=\"/", "href=\""+codeforcesBaseURL+"/")
 	}
 }
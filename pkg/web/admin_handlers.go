@@ -0,0 +1,157 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/leader"
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/scheduler"
+)
+
+func (srv *Server) QuerySchedulerRuns(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing QuerySchedulerRuns handler...")
+
+	limit, err := parseLimit(c)
+	if err != nil {
+		zap.S().Errorf("Could not parse limit with error [%+v]", err)
+		return c.JSON(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	runs, err := srv.cfStore.QuerySchedulerRuns(ctx, limit)
+	if err != nil {
+		zap.S().Errorf("Querying of scheduler runs failed with error [%+v]",
+			err)
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	if runs == nil {
+		runs = []models.SchedulerRun{}
+	}
+	return c.JSON(http.StatusOK, runs)
+}
+
+// schedulerDisabled responds to the scheduler routes of a replica which does
+// not run the scheduler.
+func schedulerDisabled(c echo.Context) error {
+	zap.S().Info("The scheduler is not enabled on this replica")
+	return c.JSON(http.StatusServiceUnavailable,
+		http.StatusText(http.StatusServiceUnavailable))
+}
+
+func (srv *Server) SchedulerState(c echo.Context) error {
+	zap.S().Info("Executing SchedulerState handler...")
+
+	if srv.scheduler == nil {
+		return schedulerDisabled(c)
+	}
+	return c.JSON(http.StatusOK, srv.scheduler.State())
+}
+
+func (srv *Server) TriggerSync(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing TriggerSync handler...")
+
+	if srv.scheduler == nil {
+		return schedulerDisabled(c)
+	}
+
+	if err := srv.scheduler.Trigger(ctx); err != nil {
+		zap.S().Errorf("Triggered sync failed with error [%+v]", err)
+		if errors.Is(err, leader.ErrNotLeader) {
+			return c.JSON(http.StatusConflict,
+				http.StatusText(http.StatusConflict))
+		}
+		if errors.Is(err, scheduler.ErrStopped) {
+			return c.JSON(http.StatusServiceUnavailable,
+				http.StatusText(http.StatusServiceUnavailable))
+		}
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+	return c.JSON(http.StatusOK, srv.scheduler.State())
+}
+
+// PauseScheduler pauses the recent actions scheduler. The contest scheduler
+// cannot be paused, and keeps running.
+func (srv *Server) PauseScheduler(c echo.Context) error {
+	zap.S().Info("Executing PauseScheduler handler...")
+
+	if srv.scheduler == nil {
+		return schedulerDisabled(c)
+	}
+
+	srv.scheduler.Pause()
+	return c.JSON(http.StatusOK, srv.scheduler.State())
+}
+
+func (srv *Server) ResumeScheduler(c echo.Context) error {
+	zap.S().Info("Executing ResumeScheduler handler...")
+
+	if srv.scheduler == nil {
+		return schedulerDisabled(c)
+	}
+
+	srv.scheduler.Resume()
+	return c.JSON(http.StatusOK, srv.scheduler.State())
+}
+
+// UpdateSchedulerSettings changes the optional batchSize and cooldownSeconds
+// parameters. Both are validated before either is applied, so nothing is
+// changed if either of them is invalid.
+func (srv *Server) UpdateSchedulerSettings(c echo.Context) error {
+	zap.S().Info("Executing UpdateSchedulerSettings handler...")
+
+	if srv.scheduler == nil {
+		return schedulerDisabled(c)
+	}
+
+	var batchSize int
+	if value := c.FormValue("batchSize"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 || size > scheduler.MaxBatchSize {
+			zap.S().Errorf("Invalid batch size %q", value)
+			return c.JSON(http.StatusBadRequest,
+				http.StatusText(http.StatusBadRequest))
+		}
+		batchSize = size
+	}
+
+	var cooldown time.Duration
+	if value := c.FormValue("cooldownSeconds"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			zap.S().Errorf("Invalid cooldown %q", value)
+			return c.JSON(http.StatusBadRequest,
+				http.StatusText(http.StatusBadRequest))
+		}
+		cooldown = time.Duration(seconds) * time.Second
+	}
+
+	if batchSize != 0 {
+		if err := srv.scheduler.SetBatchSize(batchSize); err != nil {
+			zap.S().Errorf("Could not change the batch size "+
+				"with error [%+v]", err)
+			return c.JSON(http.StatusBadRequest,
+				http.StatusText(http.StatusBadRequest))
+		}
+	}
+	if cooldown != 0 {
+		if err := srv.scheduler.SetCooldown(cooldown); err != nil {
+			zap.S().Errorf("Could not change the cooldown "+
+				"with error [%+v]", err)
+			return c.JSON(http.StatusBadRequest,
+				http.StatusText(http.StatusBadRequest))
+		}
+	}
+
+	return c.JSON(http.StatusOK, srv.scheduler.State())
+}
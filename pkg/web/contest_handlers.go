@@ -0,0 +1,79 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/utils"
+)
+
+const (
+	kContestsPageLink = "https://codeforces.com/contests"
+)
+
+var contestsCalendarMetadata = feed.Metadata{
+	Title:       "Codeforces contests",
+	Description: "Upcoming contests on Codeforces",
+	Link:        kContestsPageLink,
+}
+
+// contestResponse is a contest along with the links needed to take part in
+// it.
+type contestResponse struct {
+	models.Contest
+	Url             string `json:"url"`
+	RegistrationUrl string `json:"registrationUrl"`
+}
+
+func (srv *Server) QueryUpcomingContests(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing QueryUpcomingContests handler...")
+
+	contests, err := srv.cfStore.QueryUpcomingContests(ctx, time.Now().Unix())
+	if err != nil {
+		zap.S().Errorf("Querying of upcoming contests failed "+
+			"with error [%+v]", err)
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	res := []contestResponse{}
+	for _, contest := range contests {
+		res = append(res, contestResponse{
+			Contest:         contest,
+			Url:             utils.ContestURL(contest.Id),
+			RegistrationUrl: utils.ContestRegistrationURL(contest.Id),
+		})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (srv *Server) ContestsCalendar(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing ContestsCalendar handler...")
+
+	now := time.Now()
+	contests, err := srv.cfStore.QueryUpcomingContests(ctx, now.Unix())
+	if err != nil {
+		zap.S().Errorf("Querying of upcoming contests failed "+
+			"with error [%+v]", err)
+		return c.String(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	meta := contestsCalendarMetadata
+	meta.SelfLink = requestURL(c)
+	body, err := feed.RenderICalendar(meta, contests, now)
+	if err != nil {
+		zap.S().Errorf("Rendering of calendar failed with error [%+v]", err)
+		return c.String(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	return c.Blob(http.StatusOK, feed.ICalendarContentType, body)
+}
@@ -0,0 +1,260 @@
+package web
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/feed"
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/utils"
+)
+
+const (
+	kRecentActionsPageLink = "https://codeforces.com/recent-actions"
+)
+
+var (
+	recentActionsFeedMetadata = feed.Metadata{
+		Title:       "Codeforces recent actions",
+		Description: "Latest comments on Codeforces blogs",
+		Link:        kRecentActionsPageLink,
+	}
+	userRecentActionsFeedMetadata = feed.Metadata{
+		Title:       "Codeforces subscriptions",
+		Description: "Latest comments on the subscribed Codeforces blogs",
+		Link:        kRecentActionsPageLink,
+	}
+)
+
+// feedRenderer renders a list of recent actions in a particular feed format.
+type feedRenderer func(feed.Metadata, []models.RecentAction) ([]byte, error)
+
+// feedFormat is a representation of recent actions that clients can ask for.
+type feedFormat struct {
+	name        string
+	extension   string
+	mediaType   string
+	contentType string
+	render      feedRenderer
+}
+
+// rawFormat is the plain JSON list of recent actions. It is not a feed, and is
+// served whenever the client does not explicitly ask for a feed format.
+const rawFormat = "json"
+
+// feedFormats lists all the formats that can be negotiated on the activity
+// routes.
+var feedFormats = []feedFormat{
+	{"jsonfeed", ".json", "application/feed+json", feed.JSONFeedContentType,
+		feed.RenderJSONFeed},
+	{"rss", ".rss", "application/rss+xml", feed.RSSContentType,
+		feed.RenderRSS},
+	{"atom", ".atom", "application/atom+xml", feed.AtomContentType,
+		feed.RenderAtom},
+}
+
+// negotiateFeedFormat picks the representation of the response. The format
+// query parameter takes precedence over the Accept header, in which the
+// supported media type with the highest quality wins. Among equal qualities,
+// the first one listed wins.
+//
+// It returns nil if the raw JSON list should be served, and an error if the
+// requested format is not supported.
+func negotiateFeedFormat(c echo.Context) (*feedFormat, error) {
+	if name := c.QueryParam("format"); name != "" {
+		if name == rawFormat {
+			return nil, nil
+		}
+		for ind := range feedFormats {
+			if feedFormats[ind].name == name {
+				return &feedFormats[ind], nil
+			}
+		}
+		return nil, echo.NewHTTPError(http.StatusBadRequest,
+			"unsupported format "+name)
+	}
+
+	var best *feedFormat
+	bestQuality := 0.0
+	for _, accepted := range strings.Split(
+		c.Request().Header.Get(echo.HeaderAccept), ",") {
+		mediaType, params, err := mime.ParseMediaType(
+			strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if quality <= bestQuality {
+			continue
+		}
+
+		// The raw list is a candidate as well, so that a client preferring
+		// JSON over a feed gets the list.
+		if mediaType == echo.MIMEApplicationJSON {
+			best, bestQuality = nil, quality
+			continue
+		}
+		for ind := range feedFormats {
+			if feedFormats[ind].mediaType == mediaType {
+				best, bestQuality = &feedFormats[ind], quality
+				break
+			}
+		}
+	}
+	return best, nil
+}
+
+// respondWithActions writes the actions in the format negotiated with the
+// client, falling back to the raw JSON list decorated with author profiles.
+func (srv *Server) respondWithActions(c echo.Context, meta feed.Metadata, page *pageRequest,
+	actions []models.RecentAction) error {
+	format, err := negotiateFeedFormat(c)
+	if err != nil {
+		zap.S().Errorf("Could not negotiate feed format with error [%+v]", err)
+		return c.JSON(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	hasNext := page.hasNext(len(actions))
+	if hasNext {
+		actions = actions[:page.limit]
+	}
+	nextCursor := setNextCursor(c, hasNext, lastActionCursor(actions))
+	if format == nil {
+		return c.JSON(http.StatusOK,
+			srv.enrichActions(c.Request().Context(), actions))
+	}
+
+	meta.SelfLink = requestURL(c)
+	meta.NextLink = nextPageURL(c, nextCursor)
+	return serveFeed(c, format.render, format.contentType, meta, actions)
+}
+
+func (srv *Server) RecentActionsRSSFeed(c echo.Context) error {
+	zap.S().Info("Executing RecentActionsRSSFeed handler...")
+	return srv.recentActionsFeed(c, feed.RenderRSS, feed.RSSContentType)
+}
+
+func (srv *Server) RecentActionsAtomFeed(c echo.Context) error {
+	zap.S().Info("Executing RecentActionsAtomFeed handler...")
+	return srv.recentActionsFeed(c, feed.RenderAtom, feed.AtomContentType)
+}
+
+func (srv *Server) UserRecentActionsFeed(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing UserRecentActionsFeed handler...")
+
+	// The parameter carries both the secret and the feed format, e.g.
+	// "<token>.atom". The secret is URL safe base64, so it never has a dot.
+	param := c.Param("token")
+	dot := strings.LastIndex(param, ".")
+	if dot < 0 {
+		return c.String(http.StatusNotFound,
+			http.StatusText(http.StatusNotFound))
+	}
+	token, extension := param[:dot], param[dot:]
+
+	var format *feedFormat
+	for ind := range feedFormats {
+		if feedFormats[ind].extension == extension {
+			format = &feedFormats[ind]
+			break
+		}
+	}
+	if format == nil {
+		return c.String(http.StatusNotFound,
+			http.StatusText(http.StatusNotFound))
+	}
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		zap.S().Errorf("Could not parse page request with error [%+v]", err)
+		return c.String(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	user, err := srv.cfStore.QueryUserByFeedToken(ctx,
+		utils.HashSecretToken(token))
+	if err != nil {
+		zap.S().Errorf("Could not resolve feed token with error [%+v]", err)
+		return c.String(http.StatusNotFound,
+			http.StatusText(http.StatusNotFound))
+	}
+
+	actions, err := srv.cfStore.QueryRecentActionsForUser(ctx, user.Uuid,
+		page.startTimestamp, page.fetchLimit(), page.after)
+	if err != nil {
+		zap.S().Errorf("Querying of recent actions for user %s failed "+
+			"with error [%+v]", user.Uuid, err)
+		return c.String(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	hasNext := page.hasNext(len(actions))
+	if hasNext {
+		actions = actions[:page.limit]
+	}
+	meta := userRecentActionsFeedMetadata
+	meta.SelfLink = requestURL(c)
+	meta.NextLink = nextPageURL(c,
+		setNextCursor(c, hasNext, lastActionCursor(actions)))
+	return serveFeed(c, format.render, format.contentType, meta, actions)
+}
+
+// recentActionsFeed serves the latest actions across all the blogs.
+func (srv *Server) recentActionsFeed(c echo.Context, render feedRenderer,
+	contentType string) error {
+	page, err := parsePageRequest(c)
+	if err != nil {
+		zap.S().Errorf("Could not parse page request with error [%+v]", err)
+		return c.String(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	actions, err := srv.cfStore.QueryRecentActions(c.Request().Context(),
+		page.startTimestamp, page.fetchLimit(), page.after)
+	if err != nil {
+		zap.S().Errorf("Querying of recent actions failed with error [%+v]", err)
+		return c.String(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	hasNext := page.hasNext(len(actions))
+	if hasNext {
+		actions = actions[:page.limit]
+	}
+	meta := recentActionsFeedMetadata
+	meta.SelfLink = requestURL(c)
+	meta.NextLink = nextPageURL(c,
+		setNextCursor(c, hasNext, lastActionCursor(actions)))
+	return serveFeed(c, render, contentType, meta, actions)
+}
+
+// serveFeed renders the actions and writes the document to the response.
+func serveFeed(c echo.Context, render feedRenderer, contentType string,
+	meta feed.Metadata, actions []models.RecentAction) error {
+	body, err := render(meta, actions)
+	if err != nil {
+		zap.S().Errorf("Rendering of feed failed with error [%+v]", err)
+		return c.String(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	return c.Blob(http.StatusOK, contentType, body)
+}
+
+// requestURL reconstructs the absolute URL of the current request.
+func requestURL(c echo.Context) string {
+	return c.Scheme() + "://" + c.Request().Host + c.Request().URL.RequestURI()
+}
@@ -0,0 +1,115 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/utils"
+)
+
+// feedTokenResponse is returned whenever a new feed token is granted.
+// It is the only time that the secret is revealed to the user.
+type feedTokenResponse struct {
+	Id          string `json:"id"`
+	Token       string `json:"token"`
+	RSSUrl      string `json:"rssUrl"`
+	AtomUrl     string `json:"atomUrl"`
+	JSONFeedUrl string `json:"jsonFeedUrl"`
+}
+
+func (srv *Server) CreateFeedToken(c echo.Context) error {
+	zap.S().Info("Executing CreateFeedToken handler...")
+
+	uuid := authenticatedUuid(c)
+
+	res, err := srv.grantFeedToken(c, uuid)
+	if err != nil {
+		zap.S().Errorf("Could not grant feed token to user %s "+
+			"with error [%+v]", uuid, err)
+		return c.JSON(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (srv *Server) RotateFeedToken(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing RotateFeedToken handler...")
+
+	uuid := authenticatedUuid(c)
+	tokenID := c.FormValue("tokenID")
+
+	// Grant the new token before revoking the old one, so that a failure
+	// midway never leaves the user without a working token.
+	res, err := srv.grantFeedToken(c, uuid)
+	if err != nil {
+		zap.S().Errorf("Could not grant feed token to user %s "+
+			"with error [%+v]", uuid, err)
+		return c.JSON(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	if err := srv.cfStore.RevokeFeedToken(ctx, uuid, tokenID); err != nil {
+		zap.S().Errorf("Could not revoke feed token %s of user %s "+
+			"with error [%+v]", tokenID, uuid, err)
+		if err := srv.cfStore.RevokeFeedToken(ctx, uuid, res.Id); err != nil {
+			zap.S().Errorf("Could not roll back feed token %s of user %s "+
+				"with error [%+v]", res.Id, uuid, err)
+		}
+		return c.JSON(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (srv *Server) RevokeFeedToken(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing RevokeFeedToken handler...")
+
+	uuid := authenticatedUuid(c)
+	tokenID := c.FormValue("tokenID")
+
+	if err := srv.cfStore.RevokeFeedToken(ctx, uuid, tokenID); err != nil {
+		zap.S().Errorf("Could not revoke feed token %s of user %s "+
+			"with error [%+v]", tokenID, uuid, err)
+		return c.JSON(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	return c.JSON(http.StatusOK, http.StatusText(http.StatusOK))
+}
+
+// grantFeedToken generates a new feed token and persists its hash for the user.
+func (srv *Server) grantFeedToken(c echo.Context, uuid string) (
+	*feedTokenResponse, error) {
+	secret, err := utils.GetNewSecretToken()
+	if err != nil {
+		return nil, err
+	}
+
+	token := models.FeedToken{
+		Id:                  utils.GetNewUUID(),
+		HashedToken:         utils.HashSecretToken(secret),
+		CreationTimeSeconds: time.Now().Unix(),
+	}
+	ctx := c.Request().Context()
+	if err := srv.cfStore.AddFeedToken(ctx, uuid, token); err != nil {
+		return nil, err
+	}
+
+	feedURL := c.Scheme() + "://" + c.Request().Host + feedGroup +
+		kUserFeedPrefix + secret
+	return &feedTokenResponse{
+		Id:          token.Id,
+		Token:       secret,
+		RSSUrl:      feedURL + ".rss",
+		AtomUrl:     feedURL + ".atom",
+		JSONFeedUrl: feedURL + ".json",
+	}, nil
+}
@@ -1,20 +1,29 @@
 package web
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/labstack/echo/v4"
 
+	"github.com/variety-jones/cfrss/pkg/metrics"
 	"github.com/variety-jones/cfrss/pkg/models"
+	"github.com/variety-jones/cfrss/pkg/store"
 	"github.com/variety-jones/cfrss/pkg/utils"
 )
 
-const (
-	defaultPageSize = 100
-)
+// loginResponse carries the session token that authenticates the protected
+// routes.
+type loginResponse struct {
+	Token     string       `json:"token"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+	User      *models.User `json:"user"`
+}
 
 func (srv *Server) HomeHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, "OK")
@@ -25,21 +34,53 @@ func (srv *Server) ListenAndServe(addr string) error {
 	return srv.ec.Start(addr)
 }
 
+// Shutdown stops accepting connections and waits for the requests in
+// progress, until the context is done. ListenAndServe then returns
+// http.ErrServerClosed.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	zap.S().Info("Shutting down the web server")
+	return srv.ec.Shutdown(ctx)
+}
+
+// Metrics reports the counters and gauges collected by the application.
+func (srv *Server) Metrics(c echo.Context) error {
+	return c.JSONBlob(http.StatusOK, []byte(metrics.JSON()))
+}
+
 func (srv *Server) UserSignup(c echo.Context) error {
+	ctx := c.Request().Context()
 	zap.S().Info("Executing UserSignup handler...")
 
 	username := c.FormValue("username")
 	password := c.FormValue("password")
+	if username == "" || password == "" {
+		zap.S().Errorf("Could not register user with empty credentials")
+		return c.JSON(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		zap.S().Errorf("Could not hash password of user %s with error [%+v]",
+			username, err)
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
 
 	user := &models.User{
 		Uuid:           utils.GetNewUUID(),
 		Username:       username,
-		HashedPassword: password,
+		HashedPassword: hashedPassword,
 	}
 
-	if err := srv.cfStore.AddUser(user); err != nil {
+	if err := srv.cfStore.AddUser(ctx, user); err != nil {
 		zap.S().Errorf("Could not register user %s with error [%+v]",
 			username, err)
+		var alreadyExists *store.AlreadyExistsError
+		if errors.As(err, &alreadyExists) {
+			return c.JSON(http.StatusConflict,
+				http.StatusText(http.StatusConflict))
+		}
 		return c.JSON(http.StatusBadRequest,
 			http.StatusText(http.StatusBadRequest))
 	}
@@ -47,10 +88,102 @@ func (srv *Server) UserSignup(c echo.Context) error {
 	return c.JSON(http.StatusOK, user)
 }
 
+// rehashPassword replaces the plain text password of the user by its hash.
+func (srv *Server) rehashPassword(ctx context.Context, user *models.User,
+	password string) {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		zap.S().Errorf("Could not hash password of user %s with error [%+v]",
+			user.Username, err)
+		return
+	}
+	if err := srv.cfStore.UpdatePassword(ctx, user.Uuid,
+		hashedPassword); err != nil {
+		zap.S().Errorf("Could not rehash password of user %s with error [%+v]",
+			user.Username, err)
+		return
+	}
+	zap.S().Infof("Rehashed the plain text password of user %s",
+		user.Username)
+}
+
+func (srv *Server) UserLogin(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing UserLogin handler...")
+
+	username := c.FormValue("username")
+	password := c.FormValue("password")
+
+	user, err := srv.cfStore.QueryUserByUsername(ctx, username)
+	if err != nil {
+		zap.S().Errorf("Could not find user %s with error [%+v]",
+			username, err)
+		return c.JSON(http.StatusUnauthorized,
+			http.StatusText(http.StatusUnauthorized))
+	}
+
+	if !utils.VerifyPassword(user.HashedPassword, password) {
+		zap.S().Errorf("Invalid password for user %s", username)
+		return c.JSON(http.StatusUnauthorized,
+			http.StatusText(http.StatusUnauthorized))
+	}
+
+	// Users registered before passwords were hashed still have them in plain
+	// text, hence hash them now that the password is known. The login goes
+	// on if it fails, the next one will try again.
+	if !utils.IsPasswordHash(user.HashedPassword) {
+		srv.rehashPassword(ctx, user, password)
+	}
+
+	token, err := utils.GetNewSecretToken()
+	if err != nil {
+		zap.S().Errorf("Could not generate session token with error [%+v]",
+			err)
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		HashedToken: utils.HashSecretToken(token),
+		Uuid:        user.Uuid,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(srv.sessionTTL),
+	}
+	if err := srv.cfStore.AddSession(ctx, session); err != nil {
+		zap.S().Errorf("Could not persist session of user %s "+
+			"with error [%+v]", username, err)
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	return c.JSON(http.StatusOK, loginResponse{
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+		User:      user,
+	})
+}
+
+func (srv *Server) UserLogout(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing UserLogout handler...")
+
+	hashedToken, _ := c.Get(kSessionContextKey).(string)
+	if err := srv.cfStore.DeleteSession(ctx, hashedToken); err != nil {
+		zap.S().Errorf("Could not delete session of user %s "+
+			"with error [%+v]", authenticatedUuid(c), err)
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	return c.JSON(http.StatusOK, http.StatusText(http.StatusOK))
+}
+
 func (srv *Server) SubscribeToBlogs(c echo.Context) error {
+	ctx := c.Request().Context()
 	zap.S().Info("Executing SubscribeToBlogs handler...")
 
-	uuid := c.FormValue("uuid")
+	uuid := authenticatedUuid(c)
 
 	// TODO: Switch to array based methods.
 	blogsIDs, err := strconv.Atoi(c.FormValue("blogIDs"))
@@ -61,7 +194,7 @@ func (srv *Server) SubscribeToBlogs(c echo.Context) error {
 			http.StatusText(http.StatusInternalServerError))
 	}
 
-	if err := srv.cfStore.SubscribeToBlogs(uuid, blogsIDs); err != nil {
+	if err := srv.cfStore.SubscribeToBlogs(ctx, uuid, blogsIDs); err != nil {
 		zap.S().Errorf("User %s could not subscribe to blogs %v "+
 			"with error [%+v]", uuid, blogsIDs, err)
 		return c.JSON(http.StatusInternalServerError,
@@ -72,9 +205,10 @@ func (srv *Server) SubscribeToBlogs(c echo.Context) error {
 }
 
 func (srv *Server) UnsubscribeFromBlogs(c echo.Context) error {
+	ctx := c.Request().Context()
 	zap.S().Info("Executing UnsubscribeFromBlogs handler...")
 
-	uuid := c.FormValue("uuid")
+	uuid := authenticatedUuid(c)
 
 	// TODO: Switch to array based methods.
 	blogsIDs, err := strconv.Atoi(c.FormValue("blogIDs"))
@@ -85,7 +219,8 @@ func (srv *Server) UnsubscribeFromBlogs(c echo.Context) error {
 			http.StatusText(http.StatusInternalServerError))
 	}
 
-	if err := srv.cfStore.UnsubscribeFromBlogs(uuid, blogsIDs); err != nil {
+	err = srv.cfStore.UnsubscribeFromBlogs(ctx, uuid, blogsIDs)
+	if err != nil {
 		zap.S().Infof("User %s could not unsubscribe from blogs %v "+
 			"with error [%+v]", uuid, blogsIDs, err)
 		return c.JSON(http.StatusInternalServerError,
@@ -96,33 +231,34 @@ func (srv *Server) UnsubscribeFromBlogs(c echo.Context) error {
 }
 
 func (srv *Server) QueryRecentActions(c echo.Context) error {
+	ctx := c.Request().Context()
 	zap.S().Info("Executing QueryRecentActions handler...")
 
-	startTimestamp, err := strconv.ParseInt(c.FormValue("startTimestamp"),
-		10, 64)
+	page, err := parsePageRequest(c)
 	if err != nil {
-		zap.S().Errorf("Could not parse startTimestamp with error [%+v]", err)
+		zap.S().Errorf("Could not parse page request with error [%+v]", err)
 		return c.JSON(http.StatusBadRequest,
 			http.StatusText(http.StatusBadRequest))
 	}
 
-	actions, err := srv.cfStore.QueryRecentActions(startTimestamp, defaultPageSize)
+	actions, err := srv.cfStore.QueryRecentActions(ctx, page.startTimestamp,
+		page.fetchLimit(), page.after)
 	if err != nil {
 		zap.S().Errorf("Querying of recent actions failed with error [%+v]", err)
 		return c.JSON(http.StatusInternalServerError,
 			http.StatusText(http.StatusInternalServerError))
 	}
 
-	return c.JSON(http.StatusOK, actions)
+	return srv.respondWithActions(c, recentActionsFeedMetadata, page, actions)
 }
 
 func (srv *Server) QueryCommentsFromBlog(c echo.Context) error {
+	ctx := c.Request().Context()
 	zap.S().Info("Executing QueryCommentsFromBlog handler...")
 
-	startTimestamp, err := strconv.ParseInt(c.FormValue("startTimestamp"),
-		10, 64)
+	page, err := parsePageRequest(c)
 	if err != nil {
-		zap.S().Errorf("Could not parse startTimestamp with error [%+v]", err)
+		zap.S().Errorf("Could not parse page request with error [%+v]", err)
 		return c.JSON(http.StatusBadRequest,
 			http.StatusText(http.StatusBadRequest))
 	}
@@ -135,30 +271,68 @@ func (srv *Server) QueryCommentsFromBlog(c echo.Context) error {
 			http.StatusText(http.StatusBadRequest))
 	}
 
-	comments, err := srv.cfStore.QueryCommentsFromBlog(id, startTimestamp, defaultPageSize)
+	comments, err := srv.cfStore.QueryCommentsFromBlog(ctx, id,
+		page.startTimestamp, page.fetchLimit(), page.after)
 	if err != nil {
 		zap.S().Errorf("Querying of comments failed with error [%+v]", err)
 		return c.JSON(http.StatusInternalServerError,
 			http.StatusText(http.StatusInternalServerError))
 	}
 
+	if page.hasNext(len(comments)) {
+		comments = comments[:page.limit]
+		setNextCursor(c, true,
+			models.CursorOfComment(id, comments[len(comments)-1]))
+	}
+	if comments == nil {
+		comments = []models.Comment{}
+	}
 	return c.JSON(http.StatusOK, comments)
 }
 
+func (srv *Server) QueryAllUniqueBlogs(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing QueryAllUniqueBlogs handler...")
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		zap.S().Errorf("Could not parse page request with error [%+v]", err)
+		return c.JSON(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	blogs, err := srv.cfStore.QueryAllUniqueBlogs(ctx, page.startTimestamp,
+		page.fetchLimit(), page.after)
+	if err != nil {
+		zap.S().Errorf("Querying of unique blogs failed with error [%+v]", err)
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	if page.hasNext(len(blogs)) {
+		blogs = blogs[:page.limit]
+		setNextCursor(c, true, models.CursorOfBlog(blogs[len(blogs)-1]))
+	}
+	if blogs == nil {
+		blogs = []models.BlogEntry{}
+	}
+	return c.JSON(http.StatusOK, blogs)
+}
+
 func (srv *Server) QueryRecentActionsForUser(c echo.Context) error {
+	ctx := c.Request().Context()
 	zap.S().Info("Executing QueryRecentActionsFromUser handler...")
 
-	uuid := c.FormValue("uuid")
-	startTimestamp, err := strconv.ParseInt(c.FormValue("startTimestamp"),
-		10, 64)
+	uuid := authenticatedUuid(c)
+	page, err := parsePageRequest(c)
 	if err != nil {
-		zap.S().Errorf("Could not parse startTimestamp with error [%+v]", err)
+		zap.S().Errorf("Could not parse page request with error [%+v]", err)
 		return c.JSON(http.StatusBadRequest,
 			http.StatusText(http.StatusBadRequest))
 	}
 
-	actions, err := srv.cfStore.QueryRecentActionsForUser(uuid, startTimestamp,
-		defaultPageSize)
+	actions, err := srv.cfStore.QueryRecentActionsForUser(ctx, uuid,
+		page.startTimestamp, page.fetchLimit(), page.after)
 	if err != nil {
 		zap.S().Errorf("Querying of recent actions for user %s failed "+
 			"with error [%+v]", uuid, err)
@@ -166,5 +340,5 @@ func (srv *Server) QueryRecentActionsForUser(c echo.Context) error {
 			http.StatusText(http.StatusInternalServerError))
 	}
 
-	return c.JSON(http.StatusOK, actions)
+	return srv.respondWithActions(c, userRecentActionsFeedMetadata, page, actions)
 }
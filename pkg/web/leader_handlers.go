@@ -0,0 +1,39 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/leader"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// leaderResponse describes the lease of the replica running the schedulers.
+type leaderResponse struct {
+	*models.Lease
+
+	// Active is false if the lease expired, e.g. when no replica runs the
+	// schedulers, or if it was never acquired.
+	Active bool `json:"active"`
+}
+
+func (srv *Server) SchedulerLeader(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing SchedulerLeader handler...")
+
+	lease, err := srv.cfStore.QueryLease(ctx, leader.SchedulerLease)
+	if err != nil {
+		zap.S().Errorf("Querying of the scheduler lease failed "+
+			"with error [%+v]", err)
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	return c.JSON(http.StatusOK, leaderResponse{
+		Lease:  lease,
+		Active: lease != nil && time.Now().Before(lease.ExpiresAt),
+	})
+}
@@ -0,0 +1,88 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/utils"
+)
+
+const (
+	kBearerPrefix = "Bearer "
+
+	// kUuidContextKey stores the uuid of the authenticated user in the
+	// echo context.
+	kUuidContextKey = "uuid"
+
+	// kSessionContextKey stores the hashed session token in the echo context.
+	kSessionContextKey = "session"
+)
+
+// Authenticate is a middleware that only lets requests with a valid session
+// token through. The token is expected as a bearer token in the Authorization
+// header.
+func (srv *Server) Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		header := c.Request().Header.Get(echo.HeaderAuthorization)
+		if !strings.HasPrefix(header, kBearerPrefix) {
+			return c.JSON(http.StatusUnauthorized,
+				http.StatusText(http.StatusUnauthorized))
+		}
+
+		hashedToken := utils.HashSecretToken(
+			strings.TrimPrefix(header, kBearerPrefix))
+		session, err := srv.cfStore.QuerySession(ctx, hashedToken)
+		if err != nil {
+			zap.S().Errorf("Could not find session with error [%+v]", err)
+			return c.JSON(http.StatusUnauthorized,
+				http.StatusText(http.StatusUnauthorized))
+		}
+
+		if !time.Now().Before(session.ExpiresAt) {
+			zap.S().Infof("Session of user %s has expired", session.Uuid)
+			if err := srv.cfStore.DeleteSession(ctx, hashedToken); err != nil {
+				zap.S().Errorf("Could not delete expired session "+
+					"with error [%+v]", err)
+			}
+			return c.JSON(http.StatusUnauthorized,
+				http.StatusText(http.StatusUnauthorized))
+		}
+
+		c.Set(kUuidContextKey, session.Uuid)
+		c.Set(kSessionContextKey, hashedToken)
+		return next(c)
+	}
+}
+
+// RequireAdmin is a middleware that only lets the admins through. It must be
+// chained after Authenticate.
+func (srv *Server) RequireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		user, err := srv.cfStore.QueryUserByUuid(ctx, authenticatedUuid(c))
+		if err != nil {
+			zap.S().Errorf("Could not find user with error [%+v]", err)
+			return c.JSON(http.StatusForbidden,
+				http.StatusText(http.StatusForbidden))
+		}
+
+		if !srv.admins[user.Username] {
+			zap.S().Infof("User %s is not an admin", user.Username)
+			return c.JSON(http.StatusForbidden,
+				http.StatusText(http.StatusForbidden))
+		}
+		return next(c)
+	}
+}
+
+// authenticatedUuid returns the uuid of the user that made the request.
+// It must only be called from handlers behind the Authenticate middleware.
+func authenticatedUuid(c echo.Context) string {
+	uuid, _ := c.Get(kUuidContextKey).(string)
+	return uuid
+}
@@ -0,0 +1,147 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 500
+
+	// kNextCursorHeader carries the cursor of the next page, so that the JSON
+	// lists stay plain arrays.
+	kNextCursorHeader = "X-Next-Cursor"
+	kLinkHeader       = "Link"
+)
+
+// pageRequest is the window of a list requested by the client.
+type pageRequest struct {
+	startTimestamp int64
+	limit          int64
+	after          *models.Cursor
+}
+
+// fetchLimit returns the number of items to query from the store. It is one
+// more than the limit, so that the extra item tells whether a next page exists.
+func (page *pageRequest) fetchLimit() int64 {
+	return page.limit + 1
+}
+
+// hasNext reports whether the fetched items overflow the page, in which case
+// the extra item must be dropped from the response.
+func (page *pageRequest) hasNext(count int) bool {
+	return int64(count) > page.limit
+}
+
+// parsePageRequest extracts the optional startTimestamp, limit and cursor
+// parameters of the request.
+func parsePageRequest(c echo.Context) (*pageRequest, error) {
+	page := &pageRequest{limit: defaultPageSize}
+
+	if value := c.FormValue("startTimestamp"); value != "" {
+		startTimestamp, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("could not parse startTimestamp "+
+				"with error [%v]", err)
+		}
+		page.startTimestamp = startTimestamp
+	}
+
+	limit, err := parseLimit(c)
+	if err != nil {
+		return nil, err
+	}
+	page.limit = limit
+
+	if value := c.FormValue("cursor"); value != "" {
+		after, err := decodeCursor(value)
+		if err != nil {
+			return nil, err
+		}
+		page.after = after
+	}
+
+	return page, nil
+}
+
+// parseLimit extracts the optional limit parameter of the request, which
+// defaults to defaultPageSize.
+func parseLimit(c echo.Context) (int64, error) {
+	value := c.FormValue("limit")
+	if value == "" {
+		return defaultPageSize, nil
+	}
+
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit <= 0 || limit > maxPageSize {
+		return 0, errors.Errorf("limit must be between 1 and %d, got %q",
+			maxPageSize, value)
+	}
+	return limit, nil
+}
+
+// encodeCursor turns the cursor into an opaque, URL safe token.
+func encodeCursor(cursor models.Cursor) string {
+	// Marshalling a struct of integers cannot fail.
+	body, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(body)
+}
+
+// decodeCursor parses a token produced by encodeCursor.
+func decodeCursor(token string) (*models.Cursor, error) {
+	body, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.Errorf("could not decode cursor with error [%v]",
+			err)
+	}
+
+	cursor := new(models.Cursor)
+	if err := json.Unmarshal(body, cursor); err != nil {
+		return nil, errors.Errorf("could not parse cursor with error [%v]", err)
+	}
+	return cursor, nil
+}
+
+// setNextCursor advertises the next page in the response headers, provided
+// that there is one, and returns its cursor. The last page advertises nothing,
+// in which case the cursor is empty.
+func setNextCursor(c echo.Context, hasNext bool, last models.Cursor) string {
+	if !hasNext {
+		return ""
+	}
+
+	token := encodeCursor(last)
+	c.Response().Header().Set(kNextCursorHeader, token)
+	c.Response().Header().Add(kLinkHeader,
+		"<"+nextPageURL(c, token)+">; rel=\"next\"")
+	return token
+}
+
+// nextPageURL returns the URL of the page starting after the cursor, or an
+// empty URL if there is no cursor.
+func nextPageURL(c echo.Context, token string) string {
+	if token == "" {
+		return ""
+	}
+
+	next := *c.Request().URL
+	query := next.Query()
+	query.Set("cursor", token)
+	next.RawQuery = query.Encode()
+	return c.Scheme() + "://" + c.Request().Host + next.RequestURI()
+}
+
+// lastActionCursor returns the position of the last action of a page.
+func lastActionCursor(actions []models.RecentAction) models.Cursor {
+	if len(actions) == 0 {
+		return models.Cursor{}
+	}
+	return models.CursorOfAction(actions[len(actions)-1])
+}
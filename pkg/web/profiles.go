@@ -0,0 +1,74 @@
+package web
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+// authorProfile is the part of a Codeforces profile displayed alongside an
+// action.
+type authorProfile struct {
+	Handle string `json:"handle"`
+	Rank   string `json:"rank,omitempty"`
+	Rating int    `json:"rating"`
+	Color  string `json:"color"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+// enrichedAction is a recent action decorated with the cached profiles of the
+// blog author and the commentator. Profiles which are not cached yet are
+// omitted.
+type enrichedAction struct {
+	models.RecentAction
+	BlogAuthor  *authorProfile `json:"blogAuthor,omitempty"`
+	Commentator *authorProfile `json:"commentator,omitempty"`
+}
+
+// enrichActions looks up the cached profiles of everyone involved in the
+// actions. The actions are returned undecorated if the lookup fails.
+func (srv *Server) enrichActions(ctx context.Context,
+	actions []models.RecentAction) []enrichedAction {
+	var handles []string
+	for _, action := range actions {
+		if action.BlogEntry != nil {
+			handles = append(handles, action.BlogEntry.AuthorHandle)
+		}
+		if action.Comment != nil {
+			handles = append(handles, action.Comment.CommentatorHandle)
+		}
+	}
+
+	profiles := make(map[string]*authorProfile)
+	cached, err := srv.cfStore.QueryProfiles(ctx, handles...)
+	if err != nil {
+		zap.S().Errorf("Could not query profiles with error [%+v]", err)
+	}
+	for _, user := range cached {
+		if user.Missing {
+			continue
+		}
+		profiles[user.Handle] = &authorProfile{
+			Handle: user.Handle,
+			Rank:   user.Rank,
+			Rating: user.Rating,
+			Color:  user.Color(),
+			Avatar: user.Avatar,
+		}
+	}
+
+	res := make([]enrichedAction, 0, len(actions))
+	for _, action := range actions {
+		enriched := enrichedAction{RecentAction: action}
+		if action.BlogEntry != nil {
+			enriched.BlogAuthor = profiles[action.BlogEntry.AuthorHandle]
+		}
+		if action.Comment != nil {
+			enriched.Commentator = profiles[action.Comment.CommentatorHandle]
+		}
+		res = append(res, enriched)
+	}
+	return res
+}
@@ -0,0 +1,141 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/variety-jones/cfrss/pkg/diff"
+	"github.com/variety-jones/cfrss/pkg/models"
+)
+
+const (
+	kLineDiff = "line"
+	kWordDiff = "word"
+
+	// kMaxDiffContentBytes bounds the content of the revisions that can be
+	// diffed, since the diffs are computed on every request.
+	kMaxDiffContentBytes = 256 * 1024
+)
+
+// revisionSummary identifies a revision in a diff.
+type revisionSummary struct {
+	Id                      string   `json:"id"`
+	Tags                    []string `json:"tags"`
+	ModificationTimeSeconds int64    `json:"modificationTimeSeconds"`
+}
+
+// revisionDiffResponse lists the edits between two revisions of a blog. The
+// title is always compared word by word.
+type revisionDiffResponse struct {
+	From    revisionSummary `json:"from"`
+	To      revisionSummary `json:"to"`
+	Mode    string          `json:"mode"`
+	Title   []diff.Edit     `json:"title"`
+	Content []diff.Edit     `json:"content"`
+}
+
+func summarizeRevision(revision *models.BlogRevision) revisionSummary {
+	return revisionSummary{
+		Id:                      revision.Id,
+		Tags:                    revision.Tags,
+		ModificationTimeSeconds: revision.ModificationTimeSeconds,
+	}
+}
+
+func (srv *Server) QueryBlogRevisions(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing QueryBlogRevisions handler...")
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		zap.S().Errorf("Could not parse id from parameters with error [%+v]",
+			err)
+		return c.JSON(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	revisions, err := srv.cfStore.QueryBlogRevisions(ctx, id)
+	if err != nil {
+		zap.S().Errorf("Querying of blog revisions failed with error [%+v]",
+			err)
+		return c.JSON(http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+	}
+
+	if revisions == nil {
+		revisions = []models.BlogRevision{}
+	}
+	return c.JSON(http.StatusOK, revisions)
+}
+
+func (srv *Server) DiffBlogRevisions(c echo.Context) error {
+	ctx := c.Request().Context()
+	zap.S().Info("Executing DiffBlogRevisions handler...")
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		zap.S().Errorf("Could not parse id from parameters with error [%+v]",
+			err)
+		return c.JSON(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	mode := c.FormValue("mode")
+	if mode == "" {
+		mode = kLineDiff
+	}
+	if mode != kLineDiff && mode != kWordDiff {
+		zap.S().Errorf("Unknown diff mode %q", mode)
+		return c.JSON(http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest))
+	}
+
+	var revisions []*models.BlogRevision
+	for _, param := range []string{"from", "to"} {
+		revisionId := c.FormValue(param)
+		if revisionId == "" {
+			zap.S().Errorf("Missing the %s revision", param)
+			return c.JSON(http.StatusBadRequest,
+				http.StatusText(http.StatusBadRequest))
+		}
+
+		revision, err := srv.cfStore.QueryBlogRevision(ctx, id, revisionId)
+		if err != nil {
+			zap.S().Errorf("Querying of blog revision failed "+
+				"with error [%+v]", err)
+			return c.JSON(http.StatusInternalServerError,
+				http.StatusText(http.StatusInternalServerError))
+		}
+		if revision == nil {
+			zap.S().Infof("Blog %d has no revision %s", id, revisionId)
+			return c.JSON(http.StatusNotFound,
+				http.StatusText(http.StatusNotFound))
+		}
+		revisions = append(revisions, revision)
+	}
+	from, to := revisions[0], revisions[1]
+
+	if len(from.Content) > kMaxDiffContentBytes ||
+		len(to.Content) > kMaxDiffContentBytes {
+		zap.S().Infof("Revisions %s and %s of blog %d are too long to diff",
+			from.Id, to.Id, id)
+		return c.JSON(http.StatusUnprocessableEntity,
+			http.StatusText(http.StatusUnprocessableEntity))
+	}
+
+	res := revisionDiffResponse{
+		From:  summarizeRevision(from),
+		To:    summarizeRevision(to),
+		Mode:  mode,
+		Title: diff.Words(from.Title, to.Title),
+	}
+	if mode == kWordDiff {
+		res.Content = diff.Words(from.Content, to.Content)
+	} else {
+		res.Content = diff.Lines(from.Content, to.Content)
+	}
+	return c.JSON(http.StatusOK, res)
+}
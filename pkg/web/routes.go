@@ -1,11 +1,19 @@
 package web
 
 const (
-	v1PublicGroup = "/api/v1/public"
+	v1PublicGroup    = "/api/v1/public"
+	v1ProtectedGroup = "/api/v1/protected"
+	v1AdminGroup     = "/api/v1/admin"
+
+	feedGroup = "/feed"
 
 	kHome = "/"
 
+	kMetrics = "/metrics"
+
 	kUserSignup = "/user/signup"
+	kUserLogin  = "/user/login"
+	kUserLogout = "/user/logout"
 
 	kRecentActions = "/activity/recent-actions"
 
@@ -14,5 +22,31 @@ const (
 	kSubscribeToBlogs     = "/user/blogs/subscribe"
 	kUnsubscribeFromBlogs = "/user/blogs/unsubscribe"
 
+	kAllUniqueBlogs   = "/blogs"
 	kCommentsFromBlog = "/blogs/:id/comments"
+	kBlogRevisions    = "/blogs/:id/revisions"
+	kBlogRevisionDiff = "/blogs/:id/revisions/diff"
+
+	kUpcomingContests = "/contests"
+
+	kSchedulerLeader = "/scheduler/leader"
+	kSchedulerRuns   = "/scheduler/runs"
+
+	kSchedulerState    = "/scheduler/state"
+	kSchedulerSync     = "/scheduler/sync"
+	kSchedulerPause    = "/scheduler/pause"
+	kSchedulerResume   = "/scheduler/resume"
+	kSchedulerSettings = "/scheduler/settings"
+
+	kRecentActionsRSSFeed  = "/recent.rss"
+	kRecentActionsAtomFeed = "/recent.atom"
+
+	kContestsCalendar = "/contests.ics"
+
+	kUserFeedPrefix        = "/u/"
+	kUserRecentActionsFeed = kUserFeedPrefix + ":token"
+
+	kCreateFeedToken = "/user/feed-tokens"
+	kRotateFeedToken = "/user/feed-tokens/rotate"
+	kRevokeFeedToken = "/user/feed-tokens/revoke"
 )
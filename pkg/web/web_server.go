@@ -1,20 +1,70 @@
 package web
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/labstack/echo/v4"
 
+	"github.com/variety-jones/cfrss/pkg/scheduler"
 	"github.com/variety-jones/cfrss/pkg/store"
 )
 
+const (
+	kDefaultSessionTTL = 7 * 24 * time.Hour
+)
+
 type Server struct {
-	ec      *echo.Echo
-	cfStore store.CodeforcesStore
+	ec         *echo.Echo
+	cfStore    store.CodeforcesStore
+	sessionTTL time.Duration
+
+	// admins holds the usernames allowed through RequireAdmin.
+	admins map[string]bool
+
+	// scheduler is the scheduler driven by the admin routes, if it runs on
+	// this replica.
+	scheduler scheduler.ControllableSchedulerInterface
+}
+
+// ServerOption customizes the web server created by CreateWebServer.
+type ServerOption func(*Server)
+
+// WithSessionTTL sets the duration after which login sessions expire.
+func WithSessionTTL(ttl time.Duration) ServerOption {
+	return func(srv *Server) {
+		srv.sessionTTL = ttl
+	}
+}
+
+// WithAdmins grants the users with the given usernames access to the admin
+// routes.
+func WithAdmins(usernames ...string) ServerOption {
+	return func(srv *Server) {
+		for _, username := range usernames {
+			srv.admins[username] = true
+		}
+	}
+}
+
+// WithScheduler lets the admins control the scheduler.
+func WithScheduler(
+	sch scheduler.ControllableSchedulerInterface) ServerOption {
+	return func(srv *Server) {
+		srv.scheduler = sch
+	}
 }
 
-func CreateWebServer(cfStore store.CodeforcesStore) *Server {
+func CreateWebServer(cfStore store.CodeforcesStore,
+	opts ...ServerOption) *Server {
 	srv := &Server{
-		ec:      echo.New(),
-		cfStore: cfStore,
+		ec:         echo.New(),
+		cfStore:    cfStore,
+		sessionTTL: kDefaultSessionTTL,
+		admins:     make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(srv)
 	}
 
 	srv.ec.Static("/", "frontend/build")
@@ -25,16 +75,59 @@ func CreateWebServer(cfStore store.CodeforcesStore) *Server {
 	v1Public.GET(kHome, srv.HomeHandler)
 
 	v1Public.GET(kRecentActions, srv.QueryRecentActions)
+	v1Public.GET(kAllUniqueBlogs, srv.QueryAllUniqueBlogs)
 	v1Public.GET(kCommentsFromBlog, srv.QueryCommentsFromBlog)
+	v1Public.GET(kBlogRevisions, srv.QueryBlogRevisions)
+	v1Public.GET(kBlogRevisionDiff, srv.DiffBlogRevisions)
+
+	v1Public.GET(kUpcomingContests, srv.QueryUpcomingContests)
 
 	v1Public.POST(kUserSignup, srv.UserSignup)
+	v1Public.POST(kUserLogin, srv.UserLogin)
 
 	// Protected routes.
+	v1Protected := srv.ec.Group(v1ProtectedGroup, srv.Authenticate)
+
+	v1Protected.POST(kUserLogout, srv.UserLogout)
+
+	v1Protected.POST(kSubscribeToBlogs, srv.SubscribeToBlogs)
+	v1Protected.POST(kUnsubscribeFromBlogs, srv.UnsubscribeFromBlogs)
+
+	v1Protected.GET(kRecentActionsForUser, srv.QueryRecentActionsForUser)
+
+	v1Protected.POST(kCreateFeedToken, srv.CreateFeedToken)
+	v1Protected.POST(kRotateFeedToken, srv.RotateFeedToken)
+	v1Protected.POST(kRevokeFeedToken, srv.RevokeFeedToken)
+
+	// Admin routes.
+	v1Admin := srv.ec.Group(v1AdminGroup, srv.Authenticate, srv.RequireAdmin)
 
-	v1Public.POST(kSubscribeToBlogs, srv.SubscribeToBlogs)
-	v1Public.POST(kUnsubscribeFromBlogs, srv.UnsubscribeFromBlogs)
+	v1Admin.GET(kMetrics, srv.Metrics)
 
-	v1Public.GET(kRecentActionsForUser, srv.QueryRecentActionsForUser)
+	v1Admin.GET(kSchedulerLeader, srv.SchedulerLeader)
+	v1Admin.GET(kSchedulerRuns, srv.QuerySchedulerRuns)
+
+	v1Admin.GET(kSchedulerState, srv.SchedulerState)
+	v1Admin.POST(kSchedulerSync, srv.TriggerSync)
+	// Only the recent actions scheduler can be paused, not the contest one.
+	v1Admin.POST(kSchedulerPause, srv.PauseScheduler)
+	v1Admin.POST(kSchedulerResume, srv.ResumeScheduler)
+	v1Admin.POST(kSchedulerSettings, srv.UpdateSchedulerSettings)
+
+	// Syndication feeds, meant to be consumed by feed readers.
+	feeds := srv.ec.Group(feedGroup)
+
+	feeds.GET(kRecentActionsRSSFeed, srv.RecentActionsRSSFeed)
+	feeds.GET(kRecentActionsAtomFeed, srv.RecentActionsAtomFeed)
+
+	feeds.GET(kContestsCalendar, srv.ContestsCalendar)
+
+	feeds.GET(kUserRecentActionsFeed, srv.UserRecentActionsFeed)
 
 	return srv
 }
+
+// ServeHTTP lets the server handle requests without listening on a port.
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.ec.ServeHTTP(w, r)
+}
@@ -1,8 +1,12 @@
 package web_test
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -11,19 +15,23 @@ import (
 	"github.com/labstack/echo/v4"
 
 	"github.com/variety-jones/cfrss/pkg/cfapi"
+	"github.com/variety-jones/cfrss/pkg/diff"
+	"github.com/variety-jones/cfrss/pkg/leader"
+	"github.com/variety-jones/cfrss/pkg/models"
 	"github.com/variety-jones/cfrss/pkg/scheduler"
 	"github.com/variety-jones/cfrss/pkg/store"
 	"github.com/variety-jones/cfrss/pkg/web"
 )
 
 var _ = Describe("WebServer", func() {
+	ctx := context.Background()
 	inMemoryStore := store.NewInMemoryCodeforcesStore()
 	dummyCfClient := cfapi.NewDummyCodeforcesClient()
 	dummyScheduler := scheduler.NewScheduler(dummyCfClient, inMemoryStore,
 		100, 1*time.Second)
 
 	for cnt := 0; cnt <= 100; cnt++ {
-		dummyScheduler.Sync()
+		dummyScheduler.Sync(ctx)
 	}
 
 	e := echo.New()
@@ -43,6 +51,676 @@ var _ = Describe("WebServer", func() {
 		c := e.NewContext(httpReq, rec)
 		Expect(webServer.UserSignup(c)).Should(BeNil())
 		Expect(rec.Code).Should(Equal(http.StatusOK))
+		Expect(rec.Body.String()).ShouldNot(ContainSubstring("fake-password"))
 	})
 
+	Describe("login", Ordered, func() {
+		form := func(username, password string) echo.Context {
+			httpReq := httptest.NewRequest(http.MethodPost, "/", nil)
+			q := httpReq.URL.Query()
+			q.Add("username", username)
+			q.Add("password", password)
+			httpReq.URL.RawQuery = q.Encode()
+			return e.NewContext(httpReq, httptest.NewRecorder())
+		}
+		code := func(c echo.Context) int {
+			return c.Response().Status
+		}
+
+		BeforeAll(func() {
+			c := form("login-user", "correct-password")
+			Expect(webServer.UserSignup(c)).Should(Succeed())
+			Expect(code(c)).Should(Equal(http.StatusOK))
+		})
+
+		It("should reject a duplicate username", func() {
+			c := form("login-user", "another-password")
+			Expect(webServer.UserSignup(c)).Should(Succeed())
+			Expect(code(c)).Should(Equal(http.StatusConflict))
+		})
+
+		It("should only accept the correct password", func() {
+			c := form("login-user", "correct-password")
+			Expect(webServer.UserLogin(c)).Should(Succeed())
+			Expect(code(c)).Should(Equal(http.StatusOK))
+
+			c = form("login-user", "wrong-password")
+			Expect(webServer.UserLogin(c)).Should(Succeed())
+			Expect(code(c)).Should(Equal(http.StatusUnauthorized))
+
+			c = form("unknown-user", "correct-password")
+			Expect(webServer.UserLogin(c)).Should(Succeed())
+			Expect(code(c)).Should(Equal(http.StatusUnauthorized))
+		})
+
+		It("should hash legacy plain text passwords on login", func() {
+			Expect(inMemoryStore.AddUser(ctx, &models.User{
+				Uuid:           "fake-legacy-uuid",
+				Username:       "legacy-user",
+				HashedPassword: "legacy-password",
+			})).Should(Succeed())
+
+			c := form("legacy-user", "wrong-password")
+			Expect(webServer.UserLogin(c)).Should(Succeed())
+			Expect(code(c)).Should(Equal(http.StatusUnauthorized))
+
+			c = form("legacy-user", "legacy-password")
+			Expect(webServer.UserLogin(c)).Should(Succeed())
+			Expect(code(c)).Should(Equal(http.StatusOK))
+
+			user, err := inMemoryStore.QueryUserByUsername(ctx, "legacy-user")
+			Expect(err).Should(BeNil())
+			Expect(user.HashedPassword).ShouldNot(Equal("legacy-password"))
+
+			c = form("legacy-user", "legacy-password")
+			Expect(webServer.UserLogin(c)).Should(Succeed())
+			Expect(code(c)).Should(Equal(http.StatusOK))
+		})
+	})
+
+	Describe("recent actions", func() {
+		BeforeEach(func() {
+			Expect(inMemoryStore.AddRecentActions(ctx, []models.RecentAction{{
+				TimeSeconds: 1660000000,
+				BlogEntry:   &models.BlogEntry{Id: 107000, Title: "fake-blog"},
+				Comment:     &models.Comment{Id: 42, CommentatorHandle: "fake-user"},
+			}})).Error().ShouldNot(HaveOccurred())
+			Expect(inMemoryStore.AddProfiles(ctx, []models.CodeforcesUser{
+				{Handle: "fake-user", Rank: "expert", Rating: 1700},
+			})).Should(Succeed())
+		})
+
+		query := func(format, accept string) *httptest.ResponseRecorder {
+			httpReq := httptest.NewRequest(http.MethodGet,
+				"/activity/recent-actions?startTimestamp=0&format="+format, nil)
+			if accept != "" {
+				httpReq.Header.Set(echo.HeaderAccept, accept)
+			}
+			rec := httptest.NewRecorder()
+			Expect(webServer.QueryRecentActions(
+				e.NewContext(httpReq, rec))).Should(Succeed())
+			return rec
+		}
+
+		It("should return the raw list by default", func() {
+			rec := query("", "application/json")
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+
+			var actions []models.RecentAction
+			Expect(json.Unmarshal(rec.Body.Bytes(), &actions)).Should(Succeed())
+			Expect(actions).Should(HaveLen(1))
+		})
+
+		It("should decorate the actions with the cached profiles", func() {
+			rec := query("", "")
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+
+			var actions []struct {
+				BlogAuthor  *struct{} `json:"blogAuthor"`
+				Commentator *struct {
+					Handle string `json:"handle"`
+					Rating int    `json:"rating"`
+					Color  string `json:"color"`
+				} `json:"commentator"`
+			}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &actions)).Should(Succeed())
+			Expect(actions).Should(HaveLen(1))
+			Expect(actions[0].BlogAuthor).Should(BeNil())
+			Expect(actions[0].Commentator).ShouldNot(BeNil())
+			Expect(actions[0].Commentator.Handle).Should(Equal("fake-user"))
+			Expect(actions[0].Commentator.Rating).Should(Equal(1700))
+			Expect(actions[0].Commentator.Color).Should(Equal("blue"))
+		})
+
+		It("should negotiate JSON Feed via the Accept header", func() {
+			rec := query("", "text/html, application/feed+json;q=0.9")
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+			Expect(rec.Header().Get(echo.HeaderContentType)).Should(
+				HavePrefix("application/feed+json"))
+
+			doc := struct {
+				Version string `json:"version"`
+				Items   []struct {
+					Id string `json:"id"`
+				} `json:"items"`
+			}{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &doc)).Should(Succeed())
+			Expect(doc.Version).Should(Equal("https://jsonfeed.org/version/1.1"))
+			Expect(doc.Items).Should(HaveLen(1))
+			Expect(doc.Items[0].Id).Should(Equal(
+				"https://codeforces.com/blog/entry/107000#comment-42"))
+		})
+
+		It("should pick the format with the highest quality", func() {
+			rec := query("", "application/rss+xml;q=0.5, "+
+				"application/atom+xml;q=0.8, application/feed+json;q=0")
+			Expect(rec.Header().Get(echo.HeaderContentType)).Should(
+				HavePrefix("application/atom+xml"))
+
+			rec = query("", "application/feed+json;q=0.5, application/json")
+			Expect(rec.Header().Get(echo.HeaderContentType)).Should(
+				HavePrefix(echo.MIMEApplicationJSON))
+		})
+
+		It("should prefer the format query parameter", func() {
+			rec := query("atom", "application/feed+json")
+			Expect(rec.Header().Get(echo.HeaderContentType)).Should(
+				HavePrefix("application/atom+xml"))
+		})
+
+		It("should reject unknown formats", func() {
+			Expect(query("yaml", "").Code).Should(Equal(http.StatusBadRequest))
+		})
+	})
+
+	// serve sends a request through the routes and middlewares of the server.
+	serve := func(method, target string, params url.Values,
+		sessionToken string) *httptest.ResponseRecorder {
+		httpReq := httptest.NewRequest(method, target+"?"+params.Encode(), nil)
+		if sessionToken != "" {
+			httpReq.Header.Set(echo.HeaderAuthorization,
+				"Bearer "+sessionToken)
+		}
+		rec := httptest.NewRecorder()
+		webServer.ServeHTTP(rec, httpReq)
+		return rec
+	}
+
+	// signupAndLogin registers a new user and returns a fresh session token.
+	signupAndLogin := func(srv *web.Server, username string) string {
+		credentials := url.Values{
+			"username": {username},
+			"password": {"fake-password"},
+		}
+		httpReq := httptest.NewRequest(http.MethodPost,
+			"/api/v1/public/user/signup?"+credentials.Encode(), nil)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httpReq)
+		Expect(rec.Code).Should(Equal(http.StatusOK))
+
+		httpReq = httptest.NewRequest(http.MethodPost,
+			"/api/v1/public/user/login?"+credentials.Encode(), nil)
+		rec = httptest.NewRecorder()
+		srv.ServeHTTP(rec, httpReq)
+		Expect(rec.Code).Should(Equal(http.StatusOK))
+
+		res := struct {
+			Token string `json:"token"`
+		}{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(Succeed())
+		Expect(res.Token).ShouldNot(BeEmpty())
+		return res.Token
+	}
+
+	Describe("blogs", func() {
+		It("should list the discovered blogs", func() {
+			rec := serve(http.MethodGet, "/api/v1/public/blogs",
+				url.Values{"startTimestamp": {"0"}}, "")
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+
+			var blogs []models.BlogEntry
+			Expect(json.Unmarshal(rec.Body.Bytes(), &blogs)).Should(Succeed())
+			Expect(blogs).Should(HaveLen(1))
+			Expect(blogs[0].Id).Should(Equal(107000))
+		})
+
+		Describe("revisions", Ordered, func() {
+			var revisions []models.BlogRevision
+			BeforeAll(func() {
+				for _, blog := range []models.BlogEntry{
+					{Id: 42, Title: "fake title", Content: "a\nb c\n",
+						ModificationTimeSeconds: 10},
+					{Id: 42, Title: "fake new title", Content: "a\nb d\n",
+						ModificationTimeSeconds: 20},
+					{Id: 42, Title: "fake new title",
+						Content:                 strings.Repeat("a\n", 200*1024),
+						ModificationTimeSeconds: 30},
+				} {
+					revision := models.RevisionOfBlog(blog, time.Now())
+					Expect(inMemoryStore.AddBlogRevision(ctx, &revision)).
+						Should(BeTrue())
+					revisions = append(revisions, revision)
+				}
+			})
+			revisionsURL := "/api/v1/public/blogs/42/revisions"
+
+			It("should list the revisions of a blog", func() {
+				rec := serve(http.MethodGet, revisionsURL, nil, "")
+				Expect(rec.Code).Should(Equal(http.StatusOK))
+
+				var res []models.BlogRevision
+				Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(Succeed())
+				Expect(res).Should(HaveLen(3))
+				Expect(res[0].Id).Should(Equal(revisions[0].Id))
+				Expect(res[1].Content).Should(Equal("a\nb d\n"))
+			})
+
+			It("should diff two revisions", func() {
+				query := func(mode string) (res struct {
+					Title   []diff.Edit `json:"title"`
+					Content []diff.Edit `json:"content"`
+				}) {
+					rec := serve(http.MethodGet, revisionsURL+"/diff",
+						url.Values{
+							"from": {revisions[0].Id},
+							"to":   {revisions[1].Id},
+							"mode": {mode},
+						}, "")
+					Expect(rec.Code).Should(Equal(http.StatusOK))
+					Expect(json.Unmarshal(rec.Body.Bytes(), &res)).
+						Should(Succeed())
+					return res
+				}
+
+				res := query("line")
+				Expect(res.Title).Should(Equal([]diff.Edit{
+					{Kind: diff.Equal, Text: "fake "},
+					{Kind: diff.Insert, Text: "new "},
+					{Kind: diff.Equal, Text: "title"},
+				}))
+				Expect(res.Content).Should(Equal([]diff.Edit{
+					{Kind: diff.Equal, Text: "a\n"},
+					{Kind: diff.Delete, Text: "b c\n"},
+					{Kind: diff.Insert, Text: "b d\n"},
+				}))
+
+				Expect(query("word").Content).Should(Equal([]diff.Edit{
+					{Kind: diff.Equal, Text: "a\nb "},
+					{Kind: diff.Delete, Text: "c"},
+					{Kind: diff.Insert, Text: "d"},
+					{Kind: diff.Equal, Text: "\n"},
+				}))
+			})
+
+			It("should reject unknown revisions and modes", func() {
+				Expect(serve(http.MethodGet, revisionsURL+"/diff",
+					url.Values{
+						"from": {revisions[0].Id},
+						"to":   {"unknown"},
+					}, "").Code).Should(Equal(http.StatusNotFound))
+				Expect(serve(http.MethodGet, revisionsURL+"/diff",
+					url.Values{
+						"from": {revisions[0].Id},
+						"to":   {revisions[1].Id},
+						"mode": {"char"},
+					}, "").Code).Should(Equal(http.StatusBadRequest))
+			})
+
+			It("should reject revisions too long to diff", func() {
+				Expect(serve(http.MethodGet, revisionsURL+"/diff",
+					url.Values{
+						"from": {revisions[1].Id},
+						"to":   {revisions[2].Id},
+					}, "").Code).Should(Equal(http.StatusUnprocessableEntity))
+			})
+		})
+	})
+
+	Describe("contests", func() {
+		BeforeEach(func() {
+			start := time.Now().Add(time.Hour).Unix()
+			Expect(inMemoryStore.AddContests(ctx, []models.Contest{
+				{Id: 1700, Name: "fake-contest", Phase: "BEFORE",
+					StartTimeSeconds: start, DurationSeconds: 7200},
+				{Id: 1600, Name: "finished-contest", Phase: "FINISHED",
+					StartTimeSeconds: 1600000000, DurationSeconds: 7200},
+			})).Should(Succeed())
+		})
+
+		It("should list the upcoming contests with their links", func() {
+			rec := serve(http.MethodGet, "/api/v1/public/contests", nil, "")
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+
+			var contests []struct {
+				Id              int    `json:"id"`
+				Phase           string `json:"phase"`
+				DurationSeconds int64  `json:"durationSeconds"`
+				RegistrationUrl string `json:"registrationUrl"`
+			}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &contests)).Should(Succeed())
+			Expect(contests).Should(HaveLen(1))
+			Expect(contests[0].Id).Should(Equal(1700))
+			Expect(contests[0].Phase).Should(Equal("BEFORE"))
+			Expect(contests[0].DurationSeconds).Should(Equal(int64(7200)))
+			Expect(contests[0].RegistrationUrl).Should(Equal(
+				"https://codeforces.com/contestRegistration/1700"))
+		})
+
+		It("should serve the upcoming contests as a calendar", func() {
+			rec := serve(http.MethodGet, "/feed/contests.ics", nil, "")
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+			Expect(rec.Header().Get(echo.HeaderContentType)).Should(
+				HavePrefix("text/calendar"))
+			Expect(rec.Body.String()).Should(ContainSubstring(
+				"UID:contest-1700@cfrss"))
+			Expect(rec.Body.String()).ShouldNot(ContainSubstring(
+				"finished-contest"))
+		})
+	})
+
+	Describe("admin", Ordered, func() {
+		controlledStore := store.NewInMemoryCodeforcesStore()
+		controlled := scheduler.NewScheduler(cfapi.NewDummyCodeforcesClient(),
+			controlledStore, 10, time.Hour)
+		adminServer := web.CreateWebServer(inMemoryStore,
+			web.WithAdmins("admin-user"), web.WithScheduler(controlled))
+		var adminToken, userToken string
+		BeforeAll(func() {
+			adminToken = signupAndLogin(adminServer, "admin-user")
+			userToken = signupAndLogin(adminServer, "regular-user")
+		})
+
+		call := func(srv *web.Server, method, target,
+			sessionToken string) *httptest.ResponseRecorder {
+			httpReq := httptest.NewRequest(method, target, nil)
+			httpReq.Header.Set(echo.HeaderAuthorization, "Bearer "+sessionToken)
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httpReq)
+			return rec
+		}
+		get := func(target, sessionToken string) *httptest.ResponseRecorder {
+			return call(adminServer, http.MethodGet, target, sessionToken)
+		}
+		post := func(target string) scheduler.State {
+			rec := call(adminServer, http.MethodPost, target, adminToken)
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+
+			var state scheduler.State
+			Expect(json.Unmarshal(rec.Body.Bytes(), &state)).Should(Succeed())
+			return state
+		}
+
+		It("should only let the admins through", func() {
+			Expect(get("/api/v1/admin/scheduler/runs", "").Code).Should(
+				Equal(http.StatusUnauthorized))
+			Expect(get("/api/v1/admin/scheduler/runs", userToken).Code).Should(
+				Equal(http.StatusForbidden))
+		})
+
+		It("should only report the metrics to the admins", func() {
+			Expect(get("/api/v1/admin/metrics", userToken).Code).Should(
+				Equal(http.StatusForbidden))
+
+			rec := get("/api/v1/admin/metrics", adminToken)
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+			var counters map[string]interface{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &counters)).Should(
+				Succeed())
+		})
+
+		It("should report the replica holding the lease", func() {
+			query := func() (res struct {
+				Holder string `json:"holder"`
+				Token  int64  `json:"token"`
+				Active bool   `json:"active"`
+			}) {
+				rec := get("/api/v1/admin/scheduler/leader", adminToken)
+				Expect(rec.Code).Should(Equal(http.StatusOK))
+				Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(Succeed())
+				return res
+			}
+			Expect(query().Active).Should(BeFalse())
+
+			Expect(inMemoryStore.AcquireLease(ctx, leader.SchedulerLease,
+				"fake-replica", time.Now(), time.Minute)).Error().
+				ShouldNot(HaveOccurred())
+			res := query()
+			Expect(res.Holder).Should(Equal("fake-replica"))
+			Expect(res.Token).Should(Equal(int64(1)))
+			Expect(res.Active).Should(BeTrue())
+
+			Expect(get("/api/v1/admin/scheduler/leader", userToken).Code).
+				Should(Equal(http.StatusForbidden))
+		})
+
+		It("should list the latest scheduler runs", func() {
+			rec := get("/api/v1/admin/scheduler/runs?limit=2", adminToken)
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+
+			var runs []models.SchedulerRun
+			Expect(json.Unmarshal(rec.Body.Bytes(), &runs)).Should(Succeed())
+			Expect(runs).Should(HaveLen(2))
+			Expect(runs[0].StartedAt).ShouldNot(BeTemporally("<",
+				runs[1].StartedAt))
+
+			Expect(get("/api/v1/admin/scheduler/runs?limit=0",
+				adminToken).Code).Should(Equal(http.StatusBadRequest))
+		})
+
+		It("should control the scheduler", func() {
+			Expect(post("/api/v1/admin/scheduler/pause").Paused).Should(BeTrue())
+			Expect(post("/api/v1/admin/scheduler/resume").Paused).Should(
+				BeFalse())
+
+			state := post("/api/v1/admin/scheduler/sync")
+			Expect(state.LastAttempt).ShouldNot(BeNil())
+			Expect(controlledStore.QuerySchedulerRuns(ctx, 0)).Should(HaveLen(1))
+
+			state = post("/api/v1/admin/scheduler/settings" +
+				"?batchSize=50&cooldownSeconds=90")
+			Expect(state.BatchSize).Should(Equal(50))
+			Expect(state.CooldownSeconds).Should(Equal(90.0))
+
+			Expect(call(adminServer, http.MethodPost,
+				"/api/v1/admin/scheduler/settings?batchSize=500&cooldownSeconds=1",
+				adminToken).Code).Should(Equal(http.StatusBadRequest))
+			rec := get("/api/v1/admin/scheduler/state", adminToken)
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+			Expect(json.Unmarshal(rec.Body.Bytes(), &state)).Should(Succeed())
+			Expect(state.BatchSize).Should(Equal(50))
+			Expect(state.CooldownSeconds).Should(Equal(90.0))
+		})
+
+		It("should report a replica without a scheduler", func() {
+			withoutScheduler := web.CreateWebServer(inMemoryStore,
+				web.WithAdmins("admin-user"))
+			Expect(call(withoutScheduler, http.MethodGet,
+				"/api/v1/admin/scheduler/state", adminToken).Code).Should(
+				Equal(http.StatusServiceUnavailable))
+		})
+	})
+
+	Describe("pagination", func() {
+		pagedStore := store.NewInMemoryCodeforcesStore()
+		pagedServer := web.CreateWebServer(pagedStore)
+		BeforeEach(func() {
+			Expect(pagedStore.AddRecentActions(ctx, []models.RecentAction{
+				{
+					TimeSeconds: 300,
+					BlogEntry:   &models.BlogEntry{Id: 2},
+					Comment:     &models.Comment{Id: 21},
+				},
+				{
+					TimeSeconds: 300,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 12},
+				},
+				{
+					TimeSeconds: 200,
+					BlogEntry:   &models.BlogEntry{Id: 1},
+					Comment:     &models.Comment{Id: 11},
+				},
+			})).Error().ShouldNot(HaveOccurred())
+		})
+
+		fetch := func(params url.Values) (*httptest.ResponseRecorder, []int,
+			string) {
+			httpReq := httptest.NewRequest(http.MethodGet,
+				"/api/v1/public/activity/recent-actions?"+params.Encode(), nil)
+			rec := httptest.NewRecorder()
+			pagedServer.ServeHTTP(rec, httpReq)
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+
+			var actions []models.RecentAction
+			Expect(json.Unmarshal(rec.Body.Bytes(), &actions)).Should(Succeed())
+			nextCursor := rec.Header().Get("X-Next-Cursor")
+			var ids []int
+			for _, action := range actions {
+				ids = append(ids, action.Comment.Id)
+			}
+			return rec, ids, nextCursor
+		}
+
+		It("should follow the next cursor until the last page", func() {
+			rec, ids, cursor := fetch(url.Values{"limit": {"2"}})
+			Expect(ids).Should(Equal([]int{21, 12}))
+			Expect(cursor).ShouldNot(BeEmpty())
+			Expect(rec.Header().Get("Link")).Should(ContainSubstring(
+				"cursor=" + cursor))
+
+			_, ids, cursor = fetch(url.Values{"limit": {"2"}, "cursor": {cursor}})
+			Expect(ids).Should(Equal([]int{11}))
+			Expect(cursor).Should(BeEmpty())
+		})
+
+		It("should not advertise a next page after a full last page", func() {
+			rec, ids, cursor := fetch(url.Values{"limit": {"3"}})
+			Expect(ids).Should(Equal([]int{21, 12, 11}))
+			Expect(cursor).Should(BeEmpty())
+			Expect(rec.Header().Get("Link")).Should(BeEmpty())
+		})
+
+		It("should advertise the next page in feeds", func() {
+			httpReq := httptest.NewRequest(http.MethodGet,
+				"/feed/recent.atom?limit=1", nil)
+			rec := httptest.NewRecorder()
+			pagedServer.ServeHTTP(rec, httpReq)
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+			Expect(rec.Body.String()).Should(ContainSubstring("rel=\"next\""))
+		})
+
+		It("should reject invalid pages", func() {
+			for _, params := range []url.Values{
+				{"limit": {"0"}},
+				{"limit": {"100000"}},
+				{"cursor": {"not-a-cursor"}},
+			} {
+				httpReq := httptest.NewRequest(http.MethodGet,
+					"/api/v1/public/activity/recent-actions?"+params.Encode(),
+					nil)
+				rec := httptest.NewRecorder()
+				pagedServer.ServeHTTP(rec, httpReq)
+				Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+			}
+		})
+	})
+
+	Describe("authentication", func() {
+		subscriptions := "/api/v1/protected/user/activity/recent-actions"
+
+		It("should reject protected routes without a valid session", func() {
+			Expect(serve(http.MethodGet, subscriptions,
+				url.Values{"startTimestamp": {"0"}}, "").Code).Should(
+				Equal(http.StatusUnauthorized))
+			Expect(serve(http.MethodGet, subscriptions,
+				url.Values{"startTimestamp": {"0"}}, "forged-token").Code).Should(
+				Equal(http.StatusUnauthorized))
+		})
+
+		It("should derive the user from the session", func() {
+			token := signupAndLogin(webServer, "session-user")
+
+			// The uuid parameter is ignored in favour of the session.
+			Expect(serve(http.MethodPost,
+				"/api/v1/protected/user/blogs/subscribe",
+				url.Values{"blogIDs": {"107000"}, "uuid": {"unknown"}},
+				token).Code).Should(Equal(http.StatusOK))
+
+			rec := serve(http.MethodGet, subscriptions,
+				url.Values{"startTimestamp": {"0"}}, token)
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+
+			var actions []models.RecentAction
+			Expect(json.Unmarshal(rec.Body.Bytes(), &actions)).Should(Succeed())
+			Expect(actions).Should(HaveLen(1))
+			Expect(actions[0].BlogEntry.Id).Should(Equal(107000))
+		})
+
+		It("should invalidate the session on logout", func() {
+			token := signupAndLogin(webServer, "logout-user")
+
+			Expect(serve(http.MethodPost, "/api/v1/protected/user/logout",
+				nil, token).Code).Should(Equal(http.StatusOK))
+			Expect(serve(http.MethodGet, subscriptions,
+				url.Values{"startTimestamp": {"0"}}, token).Code).Should(
+				Equal(http.StatusUnauthorized))
+		})
+
+		It("should reject expired sessions", func() {
+			shortLived := web.CreateWebServer(store.NewInMemoryCodeforcesStore(),
+				web.WithSessionTTL(time.Nanosecond))
+			token := signupAndLogin(shortLived, "expired-user")
+
+			httpReq := httptest.NewRequest(http.MethodGet,
+				subscriptions+"?startTimestamp=0", nil)
+			httpReq.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			rec := httptest.NewRecorder()
+			shortLived.ServeHTTP(rec, httpReq)
+			Expect(rec.Code).Should(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Describe("feed tokens", Ordered, func() {
+		var sessionToken string
+		BeforeAll(func() {
+			sessionToken = signupAndLogin(webServer, "feed-user")
+		})
+		post := func(target string, params url.Values) *httptest.ResponseRecorder {
+			return serve(http.MethodPost, "/api/v1/protected"+target, params,
+				sessionToken)
+		}
+		fetchFeed := func(token string) *httptest.ResponseRecorder {
+			return serve(http.MethodGet, "/feed/u/"+token, nil, "")
+		}
+
+		It("should serve the feed until the token is revoked", func() {
+			rec := post("/user/feed-tokens", nil)
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+
+			token := struct {
+				Id      string `json:"id"`
+				Token   string `json:"token"`
+				AtomUrl string `json:"atomUrl"`
+			}{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &token)).Should(Succeed())
+			Expect(token.AtomUrl).Should(HaveSuffix(
+				"/feed/u/" + token.Token + ".atom"))
+
+			rec = fetchFeed(token.Token + ".atom")
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+			Expect(rec.Header().Get(echo.HeaderContentType)).Should(
+				HavePrefix("application/atom+xml"))
+
+			Expect(fetchFeed(token.Token + ".yaml").Code).Should(
+				Equal(http.StatusNotFound))
+
+			Expect(post("/user/feed-tokens/revoke",
+				url.Values{"tokenID": {token.Id}}).Code).Should(
+				Equal(http.StatusOK))
+			Expect(fetchFeed(token.Token + ".atom").Code).Should(
+				Equal(http.StatusNotFound))
+		})
+
+		It("should invalidate the old token on rotation", func() {
+			rec := post("/user/feed-tokens", nil)
+			oldToken := struct {
+				Id    string `json:"id"`
+				Token string `json:"token"`
+			}{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &oldToken)).Should(Succeed())
+
+			rec = post("/user/feed-tokens/rotate",
+				url.Values{"tokenID": {oldToken.Id}})
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+			newToken := struct {
+				Token string `json:"token"`
+			}{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &newToken)).Should(Succeed())
+
+			Expect(fetchFeed(oldToken.Token + ".rss").Code).Should(
+				Equal(http.StatusNotFound))
+			Expect(fetchFeed(newToken.Token + ".rss").Code).Should(
+				Equal(http.StatusOK))
+		})
+	})
 })